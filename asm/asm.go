@@ -0,0 +1,719 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+// Package asm is a small two-pass assembler for RV64IM assembly,
+// so that tests and demos can embed risbee programs inline instead
+// of depending on an external RISC-V toolchain.
+//
+// The syntax follows GNU as: statements are separated by newlines
+// or ';', labels end in a colon, comments start with '#' or "//",
+// registers go by their ABI or xN names, and memory operands are
+// written "imm(reg)". Besides the base instructions it understands
+// the common pseudo-instructions (nop, li, la, mv, not, neg, negw,
+// sext.w, seqz, snez, sltz, sgtz, j, jr, call, tail, ret, beqz,
+// bnez, blez, bgez, bltz, bgtz, bgt, ble, bgtu, bleu, csrr, csrw,
+// csrs, csrc), %hi()/%lo() relocations and the data directives
+// .byte, .half, .word, .dword, .ascii, .asciz, .zero, .align,
+// .balign and .equ. Symbols, labels and constants alike, can be
+// defined only once.
+//
+// Everything is assembled into a single flat image, in source
+// order, starting at the base address; the default base matches
+// the load offset of RisbeeVm.LoadFromBytes, so the first
+// statement of the source is the entry point.
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultBase is the address LoadFromBytes loads images at.
+const DefaultBase = 0x1000
+
+// Error reports a problem in the assembly source.
+type Error struct {
+	Line    int    // 1-based source line
+	Message string // Description of the problem
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("asm: line %d: %s", err.Line, err.Message)
+}
+
+// Program is the result of assembling a source text.
+type Program struct {
+	Base    uint64            // Address of the first byte of Code
+	Code    []byte            // Flat image
+	Symbols map[string]uint64 // Labels and .equ constants
+}
+
+// Assemble translates Source into a flat image to be loaded
+// at DefaultBase, e.g. with RisbeeVm.LoadFromBytes.
+func Assemble(Source string) ([]byte, error) {
+	program, err := AssembleAt(Source, DefaultBase)
+	if err != nil {
+		return nil, err
+	}
+
+	return program.Code, nil
+}
+
+// AssembleAt translates Source into an image to be loaded at
+// Base, and returns it along with its symbols.
+func AssembleAt(Source string, Base uint64) (*Program, error) {
+	assembler := &assembler{
+		base:    Base,
+		symbols: map[string]uint64{},
+	}
+
+	if err := assembler.layout(Source); err != nil {
+		return nil, err
+	}
+
+	code, err := assembler.emit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Program{
+		Base:    Base,
+		Code:    code,
+		Symbols: assembler.symbols,
+	}, nil
+}
+
+// A statement is one instruction or directive of the source.
+type statement struct {
+	line     int      // Source line
+	address  uint64   // Address assigned by layout
+	size     uint64   // Size in bytes
+	mnemonic string   // Lower-cased mnemonic or directive
+	operands []string // Comma-separated operands
+	data     []byte   // Contents of string and fill directives
+}
+
+// Holds the state shared by both passes.
+type assembler struct {
+	base       uint64
+	symbols    map[string]uint64
+	statements []statement
+}
+
+// Parses the source, assigns addresses to every statement
+// and defines labels and constants.
+func (assembler *assembler) layout(source string) error {
+	address := assembler.base
+
+	for index, text := range strings.Split(source, "\n") {
+		line := index + 1
+
+		for _, text := range splitStatements(stripComment(text)) {
+			size, err := assembler.layoutStatement(line, address, text)
+			if err != nil {
+				return err
+			}
+
+			address += size
+		}
+	}
+
+	return nil
+}
+
+// Defines the labels of one statement and lays it out at
+// address.
+//
+// Returns its size.
+func (assembler *assembler) layoutStatement(
+	line int,
+	address uint64,
+	text string,
+) (uint64, error) {
+	text = strings.TrimSpace(text)
+
+	for {
+		colon := labelEnd(text)
+		if colon < 0 {
+			break
+		}
+
+		name := text[:colon]
+		if _, ok := assembler.symbols[name]; ok {
+			return 0, &Error{line, "symbol " + name + " redefined"}
+		}
+
+		assembler.symbols[name] = address
+		text = strings.TrimSpace(text[colon+1:])
+	}
+
+	if text == "" {
+		return 0, nil
+	}
+
+	mnemonic, rest := text, ""
+	if space := strings.IndexAny(text, " \t"); space >= 0 {
+		mnemonic, rest = text[:space], text[space+1:]
+	}
+
+	operands, err := splitOperands(rest)
+	if err != nil {
+		return 0, &Error{line, err.Error()}
+	}
+
+	stmt := statement{
+		line:     line,
+		address:  address,
+		mnemonic: strings.ToLower(mnemonic),
+		operands: operands,
+	}
+
+	if strings.HasPrefix(stmt.mnemonic, ".") {
+		err = assembler.directive(&stmt)
+	} else {
+		err = assembler.measure(&stmt)
+	}
+
+	if err != nil {
+		return 0, &Error{line, err.Error()}
+	}
+
+	assembler.statements = append(assembler.statements, stmt)
+	return stmt.size, nil
+}
+
+// Encodes every statement now that all symbols are known.
+func (assembler *assembler) emit() ([]byte, error) {
+	var code []byte
+
+	for index := range assembler.statements {
+		stmt := &assembler.statements[index]
+
+		var err error
+		if strings.HasPrefix(stmt.mnemonic, ".") {
+			code, err = assembler.emitData(code, stmt)
+		} else {
+			var words []uint32
+			words, err = assembler.encode(stmt)
+
+			for _, word := range words {
+				code = append(code,
+					byte(word), byte(word>>8),
+					byte(word>>16), byte(word>>24))
+			}
+		}
+
+		if err != nil {
+			return nil, &Error{stmt.line, err.Error()}
+		}
+	}
+
+	return code, nil
+}
+
+// Handles a directive during layout.
+func (assembler *assembler) directive(stmt *statement) error {
+	switch stmt.mnemonic {
+	case ".text", ".data", ".rodata", ".bss", ".section",
+		".globl", ".global", ".local", ".type", ".size",
+		".option", ".file", ".ident", ".attribute":
+		return nil
+
+	case ".equ", ".set":
+		if len(stmt.operands) != 2 {
+			return fmt.Errorf("%s needs a name and a value", stmt.mnemonic)
+		}
+
+		value, err := assembler.constant(stmt.operands[1])
+		if err != nil {
+			return err
+		}
+
+		name := stmt.operands[0]
+		if _, ok := assembler.symbols[name]; ok {
+			return fmt.Errorf("symbol %s redefined", name)
+		}
+
+		assembler.symbols[name] = uint64(value)
+		return nil
+
+	case ".align", ".p2align", ".balign":
+		if len(stmt.operands) < 1 {
+			return fmt.Errorf("%s needs an alignment", stmt.mnemonic)
+		}
+
+		value, err := assembler.constant(stmt.operands[0])
+		if err != nil {
+			return err
+		}
+
+		alignment := uint64(value)
+		if stmt.mnemonic != ".balign" {
+			if value < 0 || value > 16 {
+				return fmt.Errorf("alignment %d out of range", value)
+			}
+
+			alignment = 1 << value
+		}
+
+		if alignment == 0 || alignment&(alignment-1) != 0 {
+			return fmt.Errorf("alignment %d is not a power of two", alignment)
+		}
+
+		stmt.size = (alignment - stmt.address%alignment) % alignment
+		stmt.data = make([]byte, stmt.size)
+		return nil
+
+	case ".zero", ".space", ".skip":
+		if len(stmt.operands) != 1 {
+			return fmt.Errorf("%s needs a size", stmt.mnemonic)
+		}
+
+		value, err := assembler.constant(stmt.operands[0])
+		if err != nil {
+			return err
+		}
+
+		if value < 0 {
+			return fmt.Errorf("negative size %d", value)
+		}
+
+		stmt.size = uint64(value)
+		stmt.data = make([]byte, stmt.size)
+		return nil
+
+	case ".ascii", ".asciz", ".string":
+		for _, operand := range stmt.operands {
+			text, err := unquote(operand)
+			if err != nil {
+				return err
+			}
+
+			stmt.data = append(stmt.data, text...)
+			if stmt.mnemonic != ".ascii" {
+				stmt.data = append(stmt.data, 0)
+			}
+		}
+
+		stmt.size = uint64(len(stmt.data))
+		return nil
+	}
+
+	width, ok := dataWidth(stmt.mnemonic)
+	if !ok {
+		return fmt.Errorf("unknown directive %s", stmt.mnemonic)
+	}
+
+	stmt.size = width * uint64(len(stmt.operands))
+	return nil
+}
+
+// Returns the element size of a data directive.
+func dataWidth(directive string) (uint64, bool) {
+	switch directive {
+	case ".byte":
+		return 1, true
+
+	case ".half", ".short", ".2byte":
+		return 2, true
+
+	case ".word", ".long", ".4byte":
+		return 4, true
+
+	case ".dword", ".quad", ".8byte":
+		return 8, true
+	}
+
+	return 0, false
+}
+
+// Appends the bytes of a directive to code.
+func (assembler *assembler) emitData(code []byte, stmt *statement) ([]byte, error) {
+	width, ok := dataWidth(stmt.mnemonic)
+	if !ok {
+		return append(code, stmt.data...), nil
+	}
+
+	for _, operand := range stmt.operands {
+		value, err := assembler.value(operand)
+		if err != nil {
+			return nil, err
+		}
+
+		for index := uint64(0); index < width; index++ {
+			code = append(code, byte(uint64(value)>>(8*index)))
+		}
+	}
+
+	return code, nil
+}
+
+// Removes a trailing comment, ignoring comment markers
+// inside string and character literals. Unlike some
+// assemblers, ';' separates statements rather than
+// starting a comment.
+func stripComment(text string) string {
+	var quote byte
+
+	for index := 0; index < len(text); index++ {
+		switch char := text[index]; {
+		case quote != 0:
+			if char == '\\' {
+				index++
+			} else if char == quote {
+				quote = 0
+			}
+
+		case char == '"' || char == '\'':
+			quote = char
+
+		case char == '#',
+			char == '/' && strings.HasPrefix(text[index:], "//"):
+			return text[:index]
+		}
+	}
+
+	return text
+}
+
+// Splits a line at the semicolons outside of literals.
+func splitStatements(text string) []string {
+	var statements []string
+	var quote byte
+	start := 0
+
+	for index := 0; index < len(text); index++ {
+		switch char := text[index]; {
+		case quote != 0:
+			if char == '\\' {
+				index++
+			} else if char == quote {
+				quote = 0
+			}
+
+		case char == '"' || char == '\'':
+			quote = char
+
+		case char == ';':
+			statements = append(statements, text[start:index])
+			start = index + 1
+		}
+	}
+
+	return append(statements, text[start:])
+}
+
+// Returns the position of the colon ending a leading label,
+// or -1 if the text does not start with one.
+func labelEnd(text string) int {
+	for index := 0; index < len(text); index++ {
+		char := text[index]
+		if char == ':' && index > 0 {
+			return index
+		}
+
+		if !isSymbolChar(char) || (index == 0 && char >= '0' && char <= '9') {
+			return -1
+		}
+	}
+
+	return -1
+}
+
+// Checks whether char may appear in a symbol name.
+func isSymbolChar(char byte) bool {
+	return char == '_' || char == '.' || char == '$' ||
+		(char >= 'a' && char <= 'z') ||
+		(char >= 'A' && char <= 'Z') ||
+		(char >= '0' && char <= '9')
+}
+
+// Splits operands at commas outside of literals and parentheses.
+func splitOperands(text string) ([]string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+
+	var operands []string
+	var quote byte
+	depth, start := 0, 0
+
+	for index := 0; index < len(text); index++ {
+		switch char := text[index]; {
+		case quote != 0:
+			if char == '\\' {
+				index++
+			} else if char == quote {
+				quote = 0
+			}
+
+		case char == '"' || char == '\'':
+			quote = char
+
+		case char == '(':
+			depth++
+
+		case char == ')':
+			depth--
+
+		case char == ',' && depth == 0:
+			operands = append(operands, strings.TrimSpace(text[start:index]))
+			start = index + 1
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated literal")
+	}
+
+	return append(operands, strings.TrimSpace(text[start:])), nil
+}
+
+// Decodes a double-quoted string literal with C escapes.
+func unquote(literal string) ([]byte, error) {
+	if len(literal) < 2 || literal[0] != '"' || literal[len(literal)-1] != '"' {
+		return nil, fmt.Errorf("expected string literal, got %q", literal)
+	}
+
+	return unescape(literal[1 : len(literal)-1])
+}
+
+// Expands the C escape sequences of a literal body.
+func unescape(body string) ([]byte, error) {
+	var result []byte
+
+	for index := 0; index < len(body); index++ {
+		char := body[index]
+		if char != '\\' {
+			result = append(result, char)
+			continue
+		}
+
+		index++
+		if index == len(body) {
+			return nil, fmt.Errorf("incomplete escape sequence")
+		}
+
+		switch escape := body[index]; escape {
+		case 'n':
+			result = append(result, '\n')
+
+		case 't':
+			result = append(result, '\t')
+
+		case 'r':
+			result = append(result, '\r')
+
+		case 'a':
+			result = append(result, '\a')
+
+		case 'b':
+			result = append(result, '\b')
+
+		case 'f':
+			result = append(result, '\f')
+
+		case 'v':
+			result = append(result, '\v')
+
+		case 'x':
+			end := index + 1
+			for end < len(body) && end < index+3 && isHexDigit(body[end]) {
+				end++
+			}
+
+			value, err := strconv.ParseUint(body[index+1:end], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid escape \\x%s", body[index+1:end])
+			}
+
+			result = append(result, byte(value))
+			index = end - 1
+
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			end := index
+			for end < len(body) && end < index+3 && body[end] >= '0' && body[end] <= '7' {
+				end++
+			}
+
+			value, _ := strconv.ParseUint(body[index:end], 8, 16)
+			result = append(result, byte(value))
+			index = end - 1
+
+		default:
+			result = append(result, escape)
+		}
+	}
+
+	return result, nil
+}
+
+// Checks whether char is a hexadecimal digit.
+func isHexDigit(char byte) bool {
+	return (char >= '0' && char <= '9') ||
+		(char >= 'a' && char <= 'f') ||
+		(char >= 'A' && char <= 'F')
+}
+
+// Evaluates an expression whose symbols must already be
+// defined, as needed during layout.
+func (assembler *assembler) constant(expression string) (int64, error) {
+	return assembler.evaluate(expression, true)
+}
+
+// Evaluates an expression once all symbols are known.
+func (assembler *assembler) value(expression string) (int64, error) {
+	return assembler.evaluate(expression, false)
+}
+
+// Evaluates a sum of terms: numbers, character literals,
+// symbols, and %hi()/%lo() of a nested expression.
+func (assembler *assembler) evaluate(expression string, early bool) (int64, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return 0, fmt.Errorf("missing expression")
+	}
+
+	var total int64
+	sign := int64(1)
+	pending := true
+
+	for index := 0; index < len(expression); {
+		char := expression[index]
+
+		switch {
+		case char == ' ' || char == '\t':
+			index++
+			continue
+
+		case char == '+' || char == '-':
+			if char == '-' {
+				sign = -sign
+			}
+
+			pending = true
+			index++
+			continue
+		}
+
+		if !pending {
+			return 0, fmt.Errorf("malformed expression %q", expression)
+		}
+
+		term, length, err := assembler.term(expression[index:], early)
+		if err != nil {
+			return 0, err
+		}
+
+		total += sign * term
+		sign, pending = 1, false
+		index += length
+	}
+
+	if pending {
+		return 0, fmt.Errorf("malformed expression %q", expression)
+	}
+
+	return total, nil
+}
+
+// Evaluates the single term at the start of text.
+//
+// Returns its value and length.
+func (assembler *assembler) term(text string, early bool) (int64, int, error) {
+	for _, relocation := range []string{"%hi(", "%lo("} {
+		if !strings.HasPrefix(text, relocation) {
+			continue
+		}
+
+		end := strings.IndexByte(text, ')')
+		if end < 0 {
+			return 0, 0, fmt.Errorf("unterminated %s", relocation)
+		}
+
+		value, err := assembler.evaluate(text[len(relocation):end], early)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if relocation == "%hi(" {
+			return hi20(value), end + 1, nil
+		}
+
+		return lo12(value), end + 1, nil
+	}
+
+	if text[0] == '\'' {
+		end := 2
+		if len(text) > 1 && text[1] == '\\' {
+			end = strings.IndexByte(text[2:], '\'') + 2
+		}
+
+		if end < 2 || end >= len(text) || text[end] != '\'' {
+			return 0, 0, fmt.Errorf("malformed character literal")
+		}
+
+		body, err := unescape(text[1:end])
+		if err != nil || len(body) != 1 {
+			return 0, 0, fmt.Errorf("invalid character literal %s", text[:end+1])
+		}
+
+		return int64(body[0]), end + 1, nil
+	}
+
+	length := 0
+	for length < len(text) && isSymbolChar(text[length]) {
+		length++
+	}
+
+	if length == 0 {
+		return 0, 0, fmt.Errorf("unexpected %q", text)
+	}
+
+	word := text[:length]
+	if word[0] >= '0' && word[0] <= '9' {
+		value, err := strconv.ParseUint(word, 0, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid number %s", word)
+		}
+
+		return int64(value), length, nil
+	}
+
+	value, ok := assembler.symbols[word]
+	if !ok {
+		return 0, 0, &undefinedError{word, early}
+	}
+
+	return int64(value), length, nil
+}
+
+// Reports a symbol used before, or without, its definition.
+type undefinedError struct {
+	symbol string
+	early  bool
+}
+
+func (err *undefinedError) Error() string {
+	if err.early {
+		return fmt.Sprintf("symbol %s must be defined before use here", err.symbol)
+	}
+
+	return fmt.Sprintf("undefined symbol %s", err.symbol)
+}
+
+// Returns the upper 20 bits of value for LUI or AUIPC,
+// rounded so that adding lo12(value) restores it.
+func hi20(value int64) int64 {
+	return ((value + 0x800) >> 12) & 0xFFFFF
+}
+
+// Returns the sign-extended lower 12 bits of value.
+func lo12(value int64) int64 {
+	return int64(int32(uint32(value)<<20) >> 20)
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package asm
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// Splits an image into little-endian instruction words.
+func words(code []byte) []uint32 {
+	result := make([]uint32, len(code)/4)
+	for index := range result {
+		result[index] = binary.LittleEndian.Uint32(code[4*index:])
+	}
+
+	return result
+}
+
+// Encodings as printed by GNU objdump -d for the same
+// source assembled with GNU as, relaxation disabled.
+func TestEncoding(t *testing.T) {
+	cases := []struct {
+		source string
+		want   []uint32
+	}{
+		{"addi a0, a0, 1", []uint32{0x00150513}},
+		{"add a0, a1, a2", []uint32{0x00c58533}},
+		{"sub a0, a1, a2", []uint32{0x40c58533}},
+		{"mul a0, a0, a1", []uint32{0x02b50533}},
+		{"slli a0, a0, 32", []uint32{0x02051513}},
+		{"srai a0, a0, 63", []uint32{0x43f55513}},
+		{"lui a0, 0x12345", []uint32{0x12345537}},
+		{"auipc ra, 0", []uint32{0x00000097}},
+		{"ld a0, 8(sp)", []uint32{0x00813503}},
+		{"sd ra, 8(sp)", []uint32{0x00113423}},
+		{"sw a1, 0(a0)", []uint32{0x00b52023}},
+		{"ret", []uint32{0x00008067}},
+		{"nop", []uint32{0x00000013}},
+		{"ecall", []uint32{0x00000073}},
+		{"ebreak", []uint32{0x00100073}},
+		{"fence", []uint32{0x0ff0000f}},
+		{"csrr a0, mhartid", []uint32{0xf1402573}},
+		{"li a0, -1", []uint32{0xfff00513}},
+		{"li a0, 0x800", []uint32{0x00001537, 0x80050513}},
+		{"li a0, 0x12345678", []uint32{0x12345537, 0x67850513}},
+		{"beq a0, a1, target; nop; target: nop", []uint32{0x00b50463, 0x00000013, 0x00000013}},
+		{"jal ra, target; nop; nop; nop; target: nop", []uint32{0x010000ef, 0x13, 0x13, 0x13, 0x13}},
+	}
+
+	for _, test := range cases {
+		code, err := Assemble(test.source)
+		if err != nil {
+			t.Errorf("%s: %v", test.source, err)
+			continue
+		}
+
+		got := words(code)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %08x, want %08x", test.source, got, test.want)
+			continue
+		}
+
+		for index := range got {
+			if got[index] != test.want[index] {
+				t.Errorf("%s: got %08x, want %08x", test.source, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSemicolonSeparatesStatements(t *testing.T) {
+	code, err := Assemble(`li a0, 1; li a1, 2 # comment; not a statement
+    .ascii "a;b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := words(code[:8]); got[0] != 0x00100513 || got[1] != 0x00200593 {
+		t.Fatalf("got %08x", got)
+	}
+
+	if string(code[8:]) != "a;b" {
+		t.Fatalf("string %q", code[8:])
+	}
+}
+
+func TestSymbolRedefinition(t *testing.T) {
+	sources := []string{
+		"start: nop\n.equ start, 4",
+		".equ size, 4\n.equ size, 8",
+		".set size, 4\nsize: nop",
+	}
+
+	for _, source := range sources {
+		if _, err := Assemble(source); err == nil || !strings.Contains(err.Error(), "redefined") {
+			t.Errorf("%q: %v", source, err)
+		}
+	}
+}
+
+func TestLoadImmediateForward(t *testing.T) {
+	program, err := AssembleAt(`
+    li a0, data
+    li a1, small
+    ret
+    .equ small, 5
+data:
+    .dword 0
+`, 0x1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if program.Symbols["data"] != 0x1014 {
+		t.Fatalf("data at 0x%x", program.Symbols["data"])
+	}
+
+	want := []uint32{0x00001537, 0x01450513, 0x00500593, 0x00000013, 0x00008067}
+	got := words(program.Code[:20])
+	for index := range want {
+		if got[index] != want[index] {
+			t.Fatalf("got %08x, want %08x", got, want)
+		}
+	}
+
+	if _, err := Assemble("li a0, big\n.equ big, 0x123456789"); err == nil {
+		t.Fatal("forward li of a 64-bit value assembled")
+	}
+}
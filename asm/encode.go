@@ -0,0 +1,892 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/nthnn/risbee"
+)
+
+// Register numbers by ABI name.
+var registers = map[string]uint32{
+	"fp": 8,
+}
+
+// Control and status register addresses by name.
+var csrs = map[string]uint32{
+	"mstatus":   0x300,
+	"misa":      0x301,
+	"mie":       0x304,
+	"mtvec":     0x305,
+	"mscratch":  0x340,
+	"mepc":      0x341,
+	"mcause":    0x342,
+	"mtval":     0x343,
+	"mip":       0x344,
+	"cycle":     0xC00,
+	"time":      0xC01,
+	"instret":   0xC02,
+	"mvendorid": 0xF11,
+	"marchid":   0xF12,
+	"mimpid":    0xF13,
+	"mhartid":   risbee.RISBEE_CSR_MHARTID,
+}
+
+func init() {
+	for index, name := range risbee.RisbeeRegisterNames {
+		registers[name] = uint32(index)
+		registers["x"+strconv.Itoa(index)] = uint32(index)
+	}
+}
+
+// Register-register operations, as funct7 and funct3
+// combined the way risbee decodes them.
+var registerOps = map[string]struct {
+	opcode uint32
+	code   uint32
+}{
+	"add":    {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_ADD},
+	"sub":    {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_SUB},
+	"sll":    {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_SLL},
+	"slt":    {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_SLT},
+	"sltu":   {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_SLTU},
+	"xor":    {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_XOR},
+	"srl":    {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_SRL},
+	"sra":    {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_SRA},
+	"or":     {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_OR},
+	"and":    {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_AND},
+	"mul":    {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_MUL},
+	"mulh":   {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_MULH},
+	"mulhsu": {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_MULHSU},
+	"mulhu":  {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_MULHU},
+	"div":    {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_DIV},
+	"divu":   {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_DIVU},
+	"rem":    {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_REM},
+	"remu":   {risbee.RISBEE_OPINST_RT64, risbee.RISBEE_OPINST_RT64_REMU},
+	"addw":   {risbee.RISBEE_OPINST_RT32, risbee.RISBEE_OPINST_RT32_ADDW},
+	"subw":   {risbee.RISBEE_OPINST_RT32, risbee.RISBEE_OPINST_RT32_SUBW},
+	"sllw":   {risbee.RISBEE_OPINST_RT32, risbee.RISBEE_OPINST_RT32_SLLW},
+	"srlw":   {risbee.RISBEE_OPINST_RT32, risbee.RISBEE_OPINST_RT32_SRLW},
+	"sraw":   {risbee.RISBEE_OPINST_RT32, risbee.RISBEE_OPINST_RT32_SRAW},
+	"mulw":   {risbee.RISBEE_OPINST_RT32, risbee.RISBEE_OPINST_RT32_MULW},
+	"divw":   {risbee.RISBEE_OPINST_RT32, risbee.RISBEE_OPINST_RT32_DIVW},
+	"divuw":  {risbee.RISBEE_OPINST_RT32, risbee.RISBEE_OPINST_RT32_DIVUW},
+	"remw":   {risbee.RISBEE_OPINST_RT32, risbee.RISBEE_OPINST_RT32_REMW},
+	"remuw":  {risbee.RISBEE_OPINST_RT32, risbee.RISBEE_OPINST_RT32_REMUW},
+}
+
+// Register-immediate operations and their funct3.
+var immediateOps = map[string]uint32{
+	"addi":  risbee.RISBEE_FC3_ADDI,
+	"slti":  risbee.RISBEE_FC3_SLTI,
+	"sltiu": risbee.RISBEE_FC3_SLTIU,
+	"xori":  risbee.RISBEE_FC3_XORI,
+	"ori":   risbee.RISBEE_FC3_ORI,
+	"andi":  risbee.RISBEE_FC3_ANDI,
+}
+
+// Loads and stores and their funct3.
+var (
+	loadOps = map[string]uint32{
+		"lb":  risbee.RISBEE_FC3_LB,
+		"lh":  risbee.RISBEE_FC3_LHW,
+		"lw":  risbee.RISBEE_FC3_LW,
+		"ld":  risbee.RISBEE_FC3_LDW,
+		"lbu": risbee.RISBEE_FC3_LBU,
+		"lhu": risbee.RISBEE_FC3_LHU,
+		"lwu": risbee.RISBEE_FC3_LRES,
+	}
+
+	storeOps = map[string]uint32{
+		"sb": risbee.RISBEE_FC3_SB,
+		"sh": risbee.RISBEE_FC3_SHW,
+		"sw": risbee.RISBEE_FC3_SW,
+		"sd": risbee.RISBEE_FC3_SDW,
+	}
+)
+
+// Conditional branches and their funct3. The swapped forms
+// exchange their register operands.
+var branchOps = map[string]struct {
+	code    uint32
+	swapped bool
+}{
+	"beq":  {risbee.RISBEE_FC3_BEQ, false},
+	"bne":  {risbee.RISBEE_FC3_BNE, false},
+	"blt":  {risbee.RISBEE_FC3_BLT, false},
+	"bge":  {risbee.RISBEE_FC3_BGE, false},
+	"bltu": {risbee.RISBEE_FC3_BLTU, false},
+	"bgeu": {risbee.RISBEE_FC3_BGEU, false},
+	"bgt":  {risbee.RISBEE_FC3_BLT, true},
+	"ble":  {risbee.RISBEE_FC3_BGE, true},
+	"bgtu": {risbee.RISBEE_FC3_BLTU, true},
+	"bleu": {risbee.RISBEE_FC3_BGEU, true},
+}
+
+// Branches against zero, expanded to a branch above.
+var zeroBranchOps = map[string]struct {
+	branch   string
+	zeroLeft bool
+}{
+	"beqz": {"beq", false},
+	"bnez": {"bne", false},
+	"bltz": {"blt", false},
+	"bgez": {"bge", false},
+	"blez": {"bge", true},
+	"bgtz": {"blt", true},
+}
+
+// CSR instructions and their funct3.
+var csrOps = map[string]uint32{
+	"csrrw":  risbee.RISBEE_FC3_CSRRW,
+	"csrrs":  risbee.RISBEE_FC3_CSRRS,
+	"csrrc":  risbee.RISBEE_FC3_CSRRC,
+	"csrrwi": risbee.RISBEE_FC3_CSRRWI,
+	"csrrsi": risbee.RISBEE_FC3_CSRRSI,
+	"csrrci": risbee.RISBEE_FC3_CSRRCI,
+}
+
+// Assigns the size of an instruction during layout.
+func (assembler *assembler) measure(stmt *statement) error {
+	switch stmt.mnemonic {
+	case "li":
+		if len(stmt.operands) != 2 {
+			return fmt.Errorf("li needs a register and a value")
+		}
+
+		// A value defined further down, typically a label, is
+		// given room for LUI and ADDI.
+		value, err := assembler.constant(stmt.operands[1])
+		if undefined := (*undefinedError)(nil); errors.As(err, &undefined) {
+			stmt.size = 8
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		stmt.size = 4 * uint64(len(loadImmediate(0, value)))
+
+	case "la", "call", "tail":
+		stmt.size = 8
+
+	default:
+		stmt.size = 4
+	}
+
+	return nil
+}
+
+// Encodes an instruction into machine words.
+func (assembler *assembler) encode(stmt *statement) ([]uint32, error) {
+	mnemonic, operands := stmt.mnemonic, stmt.operands
+
+	expect := func(count int) error {
+		if len(operands) != count {
+			return fmt.Errorf("%s takes %d operands, got %d", mnemonic, count, len(operands))
+		}
+
+		return nil
+	}
+
+	// Pseudo-instructions are rewritten into base instructions
+	// and encoded recursively.
+	rewrite := func(mnemonic string, operands ...string) ([]uint32, error) {
+		return assembler.encode(&statement{
+			line:     stmt.line,
+			address:  stmt.address,
+			mnemonic: mnemonic,
+			operands: operands,
+		})
+	}
+
+	if op, ok := registerOps[mnemonic]; ok {
+		if err := expect(3); err != nil {
+			return nil, err
+		}
+
+		rd, rs1, rs2, err := registers3(operands)
+		if err != nil {
+			return nil, err
+		}
+
+		return []uint32{rType(op.opcode, op.code>>3, op.code&7, rd, rs1, rs2)}, nil
+	}
+
+	if funct3, ok := immediateOps[mnemonic]; ok {
+		if err := expect(3); err != nil {
+			return nil, err
+		}
+
+		return assembler.iTypeOperands(risbee.RISBEE_OPINST_IMM, funct3, operands)
+	}
+
+	if funct3, ok := loadOps[mnemonic]; ok {
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		rd, err := register(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		offset, rs1, err := assembler.memory(operands[1])
+		if err != nil {
+			return nil, err
+		}
+
+		word, err := iType(risbee.RISBEE_OPINST_LOAD, funct3, rd, rs1, offset)
+		return []uint32{word}, err
+	}
+
+	if funct3, ok := storeOps[mnemonic]; ok {
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		rs2, err := register(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		offset, rs1, err := assembler.memory(operands[1])
+		if err != nil {
+			return nil, err
+		}
+
+		word, err := sType(funct3, rs1, rs2, offset)
+		return []uint32{word}, err
+	}
+
+	if op, ok := branchOps[mnemonic]; ok {
+		if err := expect(3); err != nil {
+			return nil, err
+		}
+
+		rs1, err := register(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		rs2, err := register(operands[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if op.swapped {
+			rs1, rs2 = rs2, rs1
+		}
+
+		target, err := assembler.value(operands[2])
+		if err != nil {
+			return nil, err
+		}
+
+		word, err := bType(op.code, rs1, rs2, target-int64(stmt.address))
+		return []uint32{word}, err
+	}
+
+	if op, ok := zeroBranchOps[mnemonic]; ok {
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		if op.zeroLeft {
+			return rewrite(op.branch, "zero", operands[0], operands[1])
+		}
+
+		return rewrite(op.branch, operands[0], "zero", operands[1])
+	}
+
+	if funct3, ok := csrOps[mnemonic]; ok {
+		if err := expect(3); err != nil {
+			return nil, err
+		}
+
+		return assembler.csr(funct3, operands[0], operands[1], operands[2])
+	}
+
+	switch mnemonic {
+	case "slli", "srli", "srai":
+		return assembler.shift(risbee.RISBEE_OPINST_IMM, mnemonic, operands, 63)
+
+	case "slliw", "srliw", "sraiw":
+		return assembler.shift(risbee.RISBEE_OPINST_IALU, mnemonic, operands, 31)
+
+	case "addiw":
+		if err := expect(3); err != nil {
+			return nil, err
+		}
+
+		return assembler.iTypeOperands(risbee.RISBEE_OPINST_IALU, 0, operands)
+
+	case "lui", "auipc":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		rd, err := register(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := assembler.value(operands[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if value < 0 || value > 0xFFFFF {
+			return nil, fmt.Errorf("immediate %d out of range for %s", value, mnemonic)
+		}
+
+		opcode := uint32(risbee.RISBEE_OPINST_LUI)
+		if mnemonic == "auipc" {
+			opcode = risbee.RISBEE_OPINST_AUIPC
+		}
+
+		return []uint32{uint32(value)<<12 | rd<<7 | opcode}, nil
+
+	case "jal":
+		rd, target := "ra", ""
+		switch len(operands) {
+		case 1:
+			target = operands[0]
+
+		case 2:
+			rd, target = operands[0], operands[1]
+
+		default:
+			return nil, fmt.Errorf("jal takes 1 or 2 operands, got %d", len(operands))
+		}
+
+		return assembler.jal(stmt, rd, target)
+
+	case "j":
+		if err := expect(1); err != nil {
+			return nil, err
+		}
+
+		return assembler.jal(stmt, "zero", operands[0])
+
+	case "jalr":
+		switch len(operands) {
+		case 1:
+			return rewrite("jalr", "ra", "0("+operands[0]+")")
+
+		case 2:
+			rd, err := register(operands[0])
+			if err != nil {
+				return nil, err
+			}
+
+			offset, rs1, err := assembler.memory(operands[1])
+			if err != nil {
+				return nil, err
+			}
+
+			word, err := iType(risbee.RISBEE_OPINST_JALR, 0, rd, rs1, offset)
+			return []uint32{word}, err
+
+		case 3:
+			return rewrite("jalr", operands[0], operands[2]+"("+operands[1]+")")
+		}
+
+		return nil, fmt.Errorf("jalr takes 1 to 3 operands, got %d", len(operands))
+
+	case "jr":
+		if err := expect(1); err != nil {
+			return nil, err
+		}
+
+		return rewrite("jalr", "zero", "0("+operands[0]+")")
+
+	case "ret":
+		if err := expect(0); err != nil {
+			return nil, err
+		}
+
+		return rewrite("jalr", "zero", "0(ra)")
+
+	case "call", "tail":
+		if err := expect(1); err != nil {
+			return nil, err
+		}
+
+		link, scratch := "ra", "ra"
+		if mnemonic == "tail" {
+			link, scratch = "zero", "t1"
+		}
+
+		return assembler.pcRelative(stmt, operands[0], scratch,
+			func(offset int64) (uint32, error) {
+				return iType(risbee.RISBEE_OPINST_JALR, 0,
+					registers[link], registers[scratch], offset)
+			})
+
+	case "la":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		rd, err := register(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return assembler.pcRelative(stmt, operands[1], operands[0],
+			func(offset int64) (uint32, error) {
+				return iType(risbee.RISBEE_OPINST_IMM, risbee.RISBEE_FC3_ADDI, rd, rd, offset)
+			})
+
+	case "li":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		rd, err := register(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := assembler.value(operands[1])
+		if err != nil {
+			return nil, err
+		}
+
+		words := loadImmediate(rd, value)
+		if uint64(len(words))*4 > stmt.size {
+			return nil, fmt.Errorf("li of 0x%x needs its value defined before use", value)
+		}
+
+		// Pads a forward reference that fits in fewer words.
+		for uint64(len(words))*4 < stmt.size {
+			nop, _ := iType(risbee.RISBEE_OPINST_IMM, risbee.RISBEE_FC3_ADDI, 0, 0, 0)
+			words = append(words, nop)
+		}
+
+		return words, nil
+
+	case "nop":
+		return rewrite("addi", "zero", "zero", "0")
+
+	case "mv":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		return rewrite("addi", operands[0], operands[1], "0")
+
+	case "not":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		return rewrite("xori", operands[0], operands[1], "-1")
+
+	case "neg", "negw":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		return rewrite(strings.Replace(mnemonic, "neg", "sub", 1), operands[0], "zero", operands[1])
+
+	case "sext.w":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		return rewrite("addiw", operands[0], operands[1], "0")
+
+	case "seqz":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		return rewrite("sltiu", operands[0], operands[1], "1")
+
+	case "snez":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		return rewrite("sltu", operands[0], "zero", operands[1])
+
+	case "sltz":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		return rewrite("slt", operands[0], operands[1], "zero")
+
+	case "sgtz":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		return rewrite("slt", operands[0], "zero", operands[1])
+
+	case "csrr":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		return rewrite("csrrs", operands[0], operands[1], "zero")
+
+	case "csrw", "csrs", "csrc", "csrwi", "csrsi", "csrci":
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+
+		return rewrite("csrr"+mnemonic[3:], "zero", operands[0], operands[1])
+
+	case "fence":
+		predecessor, successor := uint32(0xF), uint32(0xF)
+
+		if len(operands) == 2 {
+			var err error
+			if predecessor, err = fenceSet(operands[0]); err != nil {
+				return nil, err
+			}
+
+			if successor, err = fenceSet(operands[1]); err != nil {
+				return nil, err
+			}
+		} else if err := expect(0); err != nil {
+			return nil, err
+		}
+
+		return []uint32{predecessor<<24 | successor<<20 | risbee.RISBEE_OPINST_FENCE}, nil
+
+	case "fence.i":
+		return []uint32{1<<12 | risbee.RISBEE_OPINST_FENCE}, expect(0)
+
+	case "ecall":
+		return []uint32{risbee.RISBEE_OPINST_CALL}, expect(0)
+
+	case "ebreak":
+		return []uint32{1<<20 | risbee.RISBEE_OPINST_CALL}, expect(0)
+	}
+
+	return nil, fmt.Errorf("unknown instruction %s", mnemonic)
+}
+
+// Parses a register name.
+func register(name string) (uint32, error) {
+	number, ok := registers[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return 0, fmt.Errorf("unknown register %q", name)
+	}
+
+	return number, nil
+}
+
+// Parses three register operands.
+func registers3(operands []string) (uint32, uint32, uint32, error) {
+	var numbers [3]uint32
+
+	for index := range numbers {
+		number, err := register(operands[index])
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		numbers[index] = number
+	}
+
+	return numbers[0], numbers[1], numbers[2], nil
+}
+
+// Parses an "offset(register)" memory operand; the offset
+// may be omitted.
+func (assembler *assembler) memory(operand string) (int64, uint32, error) {
+	open := strings.LastIndexByte(operand, '(')
+	if open < 0 || !strings.HasSuffix(operand, ")") {
+		return 0, 0, fmt.Errorf("expected offset(register), got %q", operand)
+	}
+
+	rs1, err := register(operand[open+1 : len(operand)-1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if strings.TrimSpace(operand[:open]) == "" {
+		return 0, rs1, nil
+	}
+
+	offset, err := assembler.value(operand[:open])
+	return offset, rs1, err
+}
+
+// Encodes "rd, rs1, imm" operands as an I-type instruction.
+func (assembler *assembler) iTypeOperands(
+	opcode uint32,
+	funct3 uint32,
+	operands []string,
+) ([]uint32, error) {
+	rd, err := register(operands[0])
+	if err != nil {
+		return nil, err
+	}
+
+	rs1, err := register(operands[1])
+	if err != nil {
+		return nil, err
+	}
+
+	immediate, err := assembler.value(operands[2])
+	if err != nil {
+		return nil, err
+	}
+
+	word, err := iType(opcode, funct3, rd, rs1, immediate)
+	return []uint32{word}, err
+}
+
+// Encodes an immediate shift.
+func (assembler *assembler) shift(
+	opcode uint32,
+	mnemonic string,
+	operands []string,
+	limit int64,
+) ([]uint32, error) {
+	if len(operands) != 3 {
+		return nil, fmt.Errorf("%s takes 3 operands, got %d", mnemonic, len(operands))
+	}
+
+	rd, err := register(operands[0])
+	if err != nil {
+		return nil, err
+	}
+
+	rs1, err := register(operands[1])
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := assembler.value(operands[2])
+	if err != nil {
+		return nil, err
+	}
+
+	if amount < 0 || amount > limit {
+		return nil, fmt.Errorf("shift amount %d out of range", amount)
+	}
+
+	funct3, funct6 := uint32(1), uint32(0)
+	if strings.HasPrefix(mnemonic, "sr") {
+		funct3 = 5
+	}
+
+	if strings.HasPrefix(mnemonic, "sra") {
+		funct6 = 0x10
+	}
+
+	return []uint32{funct6<<26 | uint32(amount)<<20 |
+		rs1<<15 | funct3<<12 | rd<<7 | opcode}, nil
+}
+
+// Encodes a CSR instruction.
+func (assembler *assembler) csr(
+	funct3 uint32,
+	destination string,
+	name string,
+	source string,
+) ([]uint32, error) {
+	rd, err := register(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	address, ok := csrs[strings.ToLower(name)]
+	if !ok {
+		value, err := assembler.value(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if value < 0 || value > 0xFFF {
+			return nil, fmt.Errorf("CSR address %d out of range", value)
+		}
+
+		address = uint32(value)
+	}
+
+	var rs1 uint32
+	if funct3 >= risbee.RISBEE_FC3_CSRRWI {
+		value, err := assembler.value(source)
+		if err != nil {
+			return nil, err
+		}
+
+		if value < 0 || value > 31 {
+			return nil, fmt.Errorf("CSR immediate %d out of range", value)
+		}
+
+		rs1 = uint32(value)
+	} else if rs1, err = register(source); err != nil {
+		return nil, err
+	}
+
+	return []uint32{address<<20 | rs1<<15 | funct3<<12 | rd<<7 | risbee.RISBEE_OPINST_CALL}, nil
+}
+
+// Encodes a JAL to target.
+func (assembler *assembler) jal(
+	stmt *statement,
+	destination string,
+	target string,
+) ([]uint32, error) {
+	rd, err := register(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := assembler.value(target)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := address - int64(stmt.address)
+	if offset&1 != 0 || offset < -(1<<20) || offset >= 1<<20 {
+		return nil, fmt.Errorf("jump target out of range")
+	}
+
+	word := uint32(offset)
+	return []uint32{(word>>20&1)<<31 |
+		(word>>1&0x3FF)<<21 |
+		(word>>11&1)<<20 |
+		(word>>12&0xFF)<<12 |
+		rd<<7 | risbee.RISBEE_OPINST_JAL}, nil
+}
+
+// Encodes an AUIPC into scratch followed by the instruction
+// built by second from the low part of the offset to target.
+func (assembler *assembler) pcRelative(
+	stmt *statement,
+	target string,
+	scratch string,
+	second func(offset int64) (uint32, error),
+) ([]uint32, error) {
+	rd, err := register(scratch)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := assembler.value(target)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := address - int64(stmt.address)
+	if offset < -(1<<31) || offset >= 1<<31-0x800 {
+		return nil, fmt.Errorf("target out of range")
+	}
+
+	low, err := second(lo12(offset))
+	if err != nil {
+		return nil, err
+	}
+
+	return []uint32{
+		uint32(hi20(offset))<<12 | rd<<7 | risbee.RISBEE_OPINST_AUIPC,
+		low,
+	}, nil
+}
+
+// Builds the shortest LUI/ADDI/SLLI sequence loading value
+// into rd. ADDIW is avoided on purpose, so that the result
+// does not depend on 32-bit sign extension.
+func loadImmediate(rd uint32, value int64) []uint32 {
+	addi := func(rs1 uint32, immediate int64) uint32 {
+		word, _ := iType(risbee.RISBEE_OPINST_IMM, risbee.RISBEE_FC3_ADDI, rd, rs1, immediate)
+		return word
+	}
+
+	if value >= -2048 && value < 2048 {
+		return []uint32{addi(0, value)}
+	}
+
+	low := lo12(value)
+	high := value - low
+
+	var sequence []uint32
+	if high >= -(1<<31) && high < 1<<31 {
+		sequence = []uint32{uint32(high)&0xFFFFF000 | rd<<7 | risbee.RISBEE_OPINST_LUI}
+	} else {
+		upper := high >> 12
+		shift := bits.TrailingZeros64(uint64(upper))
+		upper >>= shift
+
+		sequence = loadImmediate(rd, upper)
+		slli, _ := iType(risbee.RISBEE_OPINST_IMM, risbee.RISBEE_FC3_SLLI, rd, rd, int64(12+shift))
+		sequence = append(sequence, slli)
+	}
+
+	if low != 0 {
+		sequence = append(sequence, addi(rd, low))
+	}
+
+	return sequence
+}
+
+// Parses the predecessor or successor set of a FENCE.
+func fenceSet(set string) (uint32, error) {
+	var bits uint32
+
+	for _, char := range strings.ToLower(set) {
+		index := strings.IndexRune("iorw", char)
+		if index < 0 {
+			return 0, fmt.Errorf("invalid fence set %q", set)
+		}
+
+		bits |= 8 >> index
+	}
+
+	return bits, nil
+}
+
+// Encodes an R-type instruction.
+func rType(opcode, funct7, funct3, rd, rs1, rs2 uint32) uint32 {
+	return funct7<<25 | rs2<<20 | rs1<<15 | funct3<<12 | rd<<7 | opcode
+}
+
+// Encodes an I-type instruction.
+func iType(opcode, funct3, rd, rs1 uint32, immediate int64) (uint32, error) {
+	if immediate < -2048 || immediate > 2047 {
+		return 0, fmt.Errorf("immediate %d out of range", immediate)
+	}
+
+	return uint32(immediate)<<20 | rs1<<15 | funct3<<12 | rd<<7 | opcode, nil
+}
+
+// Encodes an S-type instruction.
+func sType(funct3, rs1, rs2 uint32, offset int64) (uint32, error) {
+	if offset < -2048 || offset > 2047 {
+		return 0, fmt.Errorf("offset %d out of range", offset)
+	}
+
+	word := uint32(offset)
+	return (word>>5&0x7F)<<25 | rs2<<20 | rs1<<15 | funct3<<12 |
+		(word&0x1F)<<7 | risbee.RISBEE_OPINST_STORE, nil
+}
+
+// Encodes a B-type instruction.
+func bType(funct3, rs1, rs2 uint32, offset int64) (uint32, error) {
+	if offset&1 != 0 || offset < -4096 || offset > 4094 {
+		return 0, fmt.Errorf("branch target out of range")
+	}
+
+	word := uint32(offset)
+	return (word>>12&1)<<31 | (word>>5&0x3F)<<25 | rs2<<20 | rs1<<15 |
+		funct3<<12 | (word>>1&0xF)<<8 | (word>>11&1)<<7 |
+		risbee.RISBEE_OPINST_BRANCH, nil
+}
@@ -0,0 +1,34 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Measures the check executeBlock makes on every entry,
+// comparing the block with the memory it came from, for
+// the 9 instructions of a typical loop and for a block of
+// the maximum size.
+func BenchmarkBlockValid(b *testing.B) {
+	for _, size := range []int{9, RISBEE_BLOCK_SIZE} {
+		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
+			vm := &RisbeeVm{Memory: make([]byte, 0x2000)}
+			for pc := 0x1000; pc < 0x1000+4*size; pc += 4 {
+				putUint32(vm.Memory[pc:], 0x00150513) // addi a0, a0, 1
+			}
+
+			block := vm.translate(0x1000)
+			for b.Loop() {
+				if !block.valid(vm) {
+					b.Fatal("block invalid")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RISBEE_CALL_RETURN_ADDRESS is the sentinel placed in the
+// return address register by Call. The guest function
+// "returns to the host" when it jumps there.
+const RISBEE_CALL_RETURN_ADDRESS = 0xFFFFFFFFFFFFFFF0
+
+// ErrCallStopped is returned by Call when the VM stopped,
+// through exit or a fault, before the guest function
+// returned to the host.
+var ErrCallStopped = errors.New("risbee: VM stopped before guest function returned")
+
+// ErrCallSuspended is returned by Call when a syscall
+// handler suspended the VM inside the guest function.
+var ErrCallSuspended = errors.New("risbee: guest function suspended during Call")
+
+// Call invokes the guest function at Address with up to
+// eight integer arguments placed in a0–a7, following the
+// RISC-V calling convention, and runs the VM until the
+// function returns. The register file, program counter
+// and running state are restored afterwards, so Call can
+// be used repeatedly, even from inside a syscall handler.
+// If the VM stops instead, its state is left untouched for
+// inspection.
+//
+// Suspension is not supported inside Call, since the host
+// is waiting for the result: if a syscall handler suspends
+// the VM, the suspension is cancelled, a later Resume does
+// nothing, the VM state is restored and ErrCallSuspended
+// is returned.
+//
+// Returns the values of a0 and a1 at return.
+func (vm *RisbeeVm) Call(
+	Address uint64,
+	Args ...uint64,
+) (uint64, uint64, error) {
+	if len(Args) > 8 {
+		return 0, 0, errors.New("risbee: at most eight call arguments fit in a0–a7")
+	}
+
+	registers := vm.Registers
+	pc := vm.Pc
+	running := vm.Running
+
+	copy(vm.Registers[10:18], Args)
+	vm.Registers[1] = RISBEE_CALL_RETURN_ADDRESS
+	vm.Pc = Address
+	vm.Running = true
+
+	for vm.Running && vm.Pc != RISBEE_CALL_RETURN_ADDRESS {
+		vm.Step()
+	}
+
+	suspended := vm.suspended.Swap(false)
+	if !suspended && vm.Pc != RISBEE_CALL_RETURN_ADDRESS {
+		return 0, 0, ErrCallStopped
+	}
+
+	a0, a1 := vm.Registers[10], vm.Registers[11]
+
+	vm.Registers = registers
+	vm.Pc = pc
+	vm.Running = running
+
+	if suspended {
+		return 0, 0, ErrCallSuspended
+	}
+
+	return a0, a1, nil
+}
+
+// CallSymbol invokes the guest function exported under
+// Name in the loaded ELF executable, like Call.
+func (vm *RisbeeVm) CallSymbol(
+	Name string,
+	Args ...uint64,
+) (uint64, uint64, error) {
+	address, ok := vm.LookupSymbol(Name)
+	if !ok {
+		return 0, 0, fmt.Errorf("risbee: unknown guest symbol %q", Name)
+	}
+
+	return vm.Call(address, Args...)
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+// Command risbee-objdump disassembles risbee programs in the
+// style of GNU objdump -d.
+//
+// Usage:
+//
+//	risbee-objdump [-base address] <file>
+//
+// ELF executables are disassembled section by section, with
+// symbol labels and symbolized branch targets. Any other file
+// is treated as a flat image loaded at -base, which defaults
+// to the 0x1000 load offset of LoadFromBytes.
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nthnn/risbee"
+)
+
+func main() {
+	base := flag.Uint64("base", 0x1000, "load address of flat images")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: risbee-objdump [-base address] <file>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if risbee.IsElf(data) {
+		err = dumpElf(data)
+	} else {
+		dumpCode(&risbee.RisbeeVm{}, data, *base)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// dumpElf disassembles every executable section of an ELF file.
+func dumpElf(data []byte) error {
+	file, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if file.Machine != elf.EM_RISCV {
+		return fmt.Errorf("not a RISC-V executable (%s)", file.Machine)
+	}
+
+	vm := &risbee.RisbeeVm{Symbols: risbee.ElfSymbols(file)}
+
+	for _, section := range file.Sections {
+		if section.Type != elf.SHT_PROGBITS ||
+			section.Flags&elf.SHF_EXECINSTR == 0 {
+			continue
+		}
+
+		code, err := section.Data()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\nDisassembly of section %s:\n", section.Name)
+		dumpCode(vm, code, section.Addr)
+	}
+
+	return nil
+}
+
+// dumpCode disassembles code located at base, labelling the
+// symbols known to vm.
+func dumpCode(vm *risbee.RisbeeVm, code []byte, base uint64) {
+	for offset := 0; offset+4 <= len(code); offset += 4 {
+		pc := base + uint64(offset)
+		inst := uint32(code[offset]) |
+			uint32(code[offset+1])<<8 |
+			uint32(code[offset+2])<<16 |
+			uint32(code[offset+3])<<24
+
+		for _, symbol := range vm.Symbols {
+			if symbol.Address == pc {
+				fmt.Printf("\n%016x <%s>:\n", pc, symbol.Name)
+				break
+			}
+		}
+
+		mnemonic, operands, _ := strings.Cut(risbee.Disassemble(inst, pc), " ")
+		line := fmt.Sprintf("%8x:\t%08x          \t%s", pc, inst, mnemonic)
+
+		if operands != "" {
+			line += "\t" + operands
+		}
+
+		if target, ok := risbee.BranchTarget(inst, pc); ok {
+			line += symbolize(vm, target)
+		}
+
+		fmt.Println(line)
+	}
+}
+
+// symbolize formats an address as " <symbol+offset>", or
+// returns an empty string if no symbol covers it.
+func symbolize(vm *risbee.RisbeeVm, address uint64) string {
+	symbol, ok := vm.SymbolAt(address)
+	if !ok {
+		return ""
+	}
+
+	if address == symbol.Address {
+		return fmt.Sprintf(" <%s>", symbol.Name)
+	}
+
+	return fmt.Sprintf(" <%s+0x%x>", symbol.Name, address-symbol.Address)
+}
@@ -0,0 +1,385 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RisbeeCoverage records which instructions a guest program
+// executed and which way each conditional branch went. It
+// accumulates across runs and VMs until Reset is called, so
+// a whole test suite can share one. Reports map the
+// addresses to source lines through the DWARF line table
+// of the VM passed in, see LineAt.
+type RisbeeCoverage struct {
+	hits     map[uint64]uint64
+	branches map[uint64][2]uint64
+	lock     sync.Mutex
+}
+
+// RisbeeBranchCoverage counts the outcomes of a conditional
+// branch instruction.
+type RisbeeBranchCoverage struct {
+	Pc       uint64 // Address of the branch
+	Taken    uint64 // Times the branch was taken
+	NotTaken uint64 // Times it fell through
+}
+
+// RisbeeLineCoverage is the coverage of one source line.
+// Hits is the largest execution count among its
+// instructions.
+type RisbeeLineCoverage struct {
+	Line     int
+	Hits     uint64
+	Branches []RisbeeBranchCoverage
+}
+
+// RisbeeFileCoverage is the coverage of one source file,
+// with its lines in ascending order.
+type RisbeeFileCoverage struct {
+	File  string
+	Lines []RisbeeLineCoverage
+}
+
+// SetCoverage starts collecting coverage of the VM into
+// Coverage. Passing nil stops collecting.
+func (vm *RisbeeVm) SetCoverage(Coverage *RisbeeCoverage) {
+	vm.Coverage = Coverage
+}
+
+// Reset discards the collected coverage.
+func (coverage *RisbeeCoverage) Reset() {
+	coverage.lock.Lock()
+	defer coverage.lock.Unlock()
+
+	coverage.hits = nil
+	coverage.branches = nil
+}
+
+// Hits returns how many times each address was executed.
+func (coverage *RisbeeCoverage) Hits() map[uint64]uint64 {
+	coverage.lock.Lock()
+	defer coverage.lock.Unlock()
+
+	hits := make(map[uint64]uint64, len(coverage.hits))
+	for pc, count := range coverage.hits {
+		hits[pc] = count
+	}
+
+	return hits
+}
+
+// Counts the instruction at pc, which was just executed,
+// and the direction of a conditional branch.
+func (coverage *RisbeeCoverage) record(vm *RisbeeVm, pc uint64) {
+	coverage.lock.Lock()
+	defer coverage.lock.Unlock()
+
+	if coverage.hits == nil {
+		coverage.hits = map[uint64]uint64{}
+		coverage.branches = map[uint64][2]uint64{}
+	}
+
+	coverage.hits[pc]++
+	if !vm.inMemory(pc, 4) || uint32LittleEndian(vm.Memory[pc:])&0x7F != RISBEE_OPINST_BRANCH {
+		return
+	}
+
+	counts := coverage.branches[pc]
+	if vm.Pc != pc+4 {
+		counts[0]++
+	} else {
+		counts[1]++
+	}
+
+	coverage.branches[pc] = counts
+}
+
+// Report maps the collected coverage to the source lines of
+// the line table of vm. Every line that has instructions is
+// listed, executed or not, and every conditional branch in
+// the loaded code is listed under its line.
+func (coverage *RisbeeCoverage) Report(vm *RisbeeVm) []RisbeeFileCoverage {
+	coverage.lock.Lock()
+	defer coverage.lock.Unlock()
+
+	type lineKey struct {
+		file string
+		line int
+	}
+
+	lines := map[lineKey]*RisbeeLineCoverage{}
+	for index, row := range vm.Lines {
+		if row.Line == 0 {
+			continue
+		}
+
+		key := lineKey{row.File, row.Line}
+		line := lines[key]
+
+		if line == nil {
+			line = &RisbeeLineCoverage{Line: row.Line}
+			lines[key] = line
+		}
+
+		end := row.Address + 4
+		if index+1 < len(vm.Lines) {
+			end = vm.Lines[index+1].Address
+		}
+
+		for pc := row.Address; pc < end; pc += 4 {
+			line.Hits = max(line.Hits, coverage.hits[pc])
+
+			if vm.inMemory(pc, 4) &&
+				uint32LittleEndian(vm.Memory[pc:])&0x7F == RISBEE_OPINST_BRANCH {
+				counts := coverage.branches[pc]
+				line.Branches = append(line.Branches, RisbeeBranchCoverage{
+					Pc:       pc,
+					Taken:    counts[0],
+					NotTaken: counts[1],
+				})
+			}
+		}
+	}
+
+	files := map[string]*RisbeeFileCoverage{}
+	for key, line := range lines {
+		file := files[key.file]
+		if file == nil {
+			file = &RisbeeFileCoverage{File: key.file}
+			files[key.file] = file
+		}
+
+		file.Lines = append(file.Lines, *line)
+	}
+
+	report := make([]RisbeeFileCoverage, 0, len(files))
+	for _, file := range files {
+		sort.Slice(file.Lines, func(i, j int) bool {
+			return file.Lines[i].Line < file.Lines[j].Line
+		})
+
+		report = append(report, *file)
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].File < report[j].File
+	})
+
+	return report
+}
+
+// WriteLcov writes the coverage of vm as an lcov tracefile,
+// as read by genhtml. Each conditional branch becomes a
+// block with a taken and a not-taken branch.
+func (coverage *RisbeeCoverage) WriteLcov(vm *RisbeeVm, Writer io.Writer) error {
+	output := bufio.NewWriter(Writer)
+	fmt.Fprintln(output, "TN:")
+
+	for _, file := range coverage.Report(vm) {
+		var linesHit, branches, branchesHit int
+		fmt.Fprintf(output, "SF:%s\n", file.File)
+
+		for _, line := range file.Lines {
+			for block, branch := range line.Branches {
+				for index, count := range [2]uint64{branch.Taken, branch.NotTaken} {
+					taken := "-"
+					if line.Hits > 0 {
+						taken = fmt.Sprint(count)
+					}
+
+					if count > 0 {
+						branchesHit++
+					}
+
+					branches++
+					fmt.Fprintf(output, "BRDA:%d,%d,%d,%s\n", line.Line, block, index, taken)
+				}
+			}
+		}
+
+		for _, line := range file.Lines {
+			if line.Hits > 0 {
+				linesHit++
+			}
+
+			fmt.Fprintf(output, "DA:%d,%d\n", line.Line, line.Hits)
+		}
+
+		fmt.Fprintf(output, "BRF:%d\nBRH:%d\n", branches, branchesHit)
+		fmt.Fprintf(output, "LF:%d\nLH:%d\n", len(file.Lines), linesHit)
+		fmt.Fprintln(output, "end_of_record")
+	}
+
+	return output.Flush()
+}
+
+// The elements of a Cobertura report.
+type coberturaReport struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        string             `xml:"line-rate,attr"`
+	BranchRate      string             `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      int                `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Complexity int              `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   string          `xml:"line-rate,attr"`
+	BranchRate string          `xml:"branch-rate,attr"`
+	Complexity int             `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number            int    `xml:"number,attr"`
+	Hits              uint64 `xml:"hits,attr"`
+	Branch            bool   `xml:"branch,attr"`
+	ConditionCoverage string `xml:"condition-coverage,attr,omitempty"`
+}
+
+// Counts covered and coverable lines and branch outcomes
+// of a Cobertura element.
+type coberturaCounts struct {
+	lines, linesHit, branches, branchesHit int
+}
+
+// Formats the rate of covered items.
+func coberturaRate(covered int, valid int) string {
+	if valid == 0 {
+		return "1"
+	}
+
+	return fmt.Sprintf("%.4f", float64(covered)/float64(valid))
+}
+
+// WriteCobertura writes the coverage of vm as a Cobertura
+// XML report, with a package per source directory and a
+// class per source file.
+func (coverage *RisbeeCoverage) WriteCobertura(vm *RisbeeVm, Writer io.Writer) error {
+	report := coberturaReport{
+		Version:   "risbee",
+		Timestamp: time.Now().Unix(),
+		Sources:   []string{"."},
+	}
+
+	var total coberturaCounts
+	packages := map[string]*coberturaPackage{}
+	packageCounts := map[string]*coberturaCounts{}
+
+	for _, file := range coverage.Report(vm) {
+		var counts coberturaCounts
+		class := coberturaClass{
+			Name:     filepath.Base(file.File),
+			Filename: file.File,
+		}
+
+		for _, line := range file.Lines {
+			entry := coberturaLine{Number: line.Line, Hits: line.Hits}
+			if line.Hits > 0 {
+				counts.linesHit++
+			}
+
+			if len(line.Branches) > 0 {
+				covered := 0
+				for _, branch := range line.Branches {
+					covered += min(int(branch.Taken), 1) + min(int(branch.NotTaken), 1)
+				}
+
+				valid := 2 * len(line.Branches)
+				entry.Branch = true
+				entry.ConditionCoverage = fmt.Sprintf("%d%% (%d/%d)",
+					covered*100/valid, covered, valid)
+
+				counts.branches += valid
+				counts.branchesHit += covered
+			}
+
+			counts.lines++
+			class.Lines = append(class.Lines, entry)
+		}
+
+		class.LineRate = coberturaRate(counts.linesHit, counts.lines)
+		class.BranchRate = coberturaRate(counts.branchesHit, counts.branches)
+
+		name := filepath.Dir(file.File)
+		if packages[name] == nil {
+			packages[name] = &coberturaPackage{Name: name}
+			packageCounts[name] = &coberturaCounts{}
+		}
+
+		packages[name].Classes = append(packages[name].Classes, class)
+		packageCounts[name].add(counts)
+		total.add(counts)
+	}
+
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		counts := packageCounts[name]
+		packages[name].LineRate = coberturaRate(counts.linesHit, counts.lines)
+		packages[name].BranchRate = coberturaRate(counts.branchesHit, counts.branches)
+
+		report.Packages = append(report.Packages, *packages[name])
+	}
+
+	report.LinesCovered, report.LinesValid = total.linesHit, total.lines
+	report.BranchesCovered, report.BranchesValid = total.branchesHit, total.branches
+	report.LineRate = coberturaRate(total.linesHit, total.lines)
+	report.BranchRate = coberturaRate(total.branchesHit, total.branches)
+
+	if _, err := io.WriteString(Writer, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(Writer)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(Writer, "\n")
+	return err
+}
+
+// Adds the counts of a nested element.
+func (counts *coberturaCounts) add(other coberturaCounts) {
+	counts.lines += other.lines
+	counts.linesHit += other.linesHit
+	counts.branches += other.branches
+	counts.branchesHit += other.branchesHit
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"testing"
+
+	"github.com/nthnn/risbee"
+	"github.com/nthnn/risbee/asm"
+)
+
+// Loops twice, so that the branch on line 11 goes both
+// ways, and never reaches the code of lib/b.c.
+const coverageSource = `
+    li s1, 2            # src/a.c:10
+loop:
+    andi t0, s1, 1      # src/a.c:11
+    beqz t0, even
+    addi s2, s2, 1      # src/a.c:12
+even:
+    addi s1, s1, -1     # src/a.c:13
+    bnez s1, loop
+    bltz s2, never      # src/a.c:14
+    li a0, 0
+    li a7, 0
+    ecall
+never:
+    beq zero, zero, never # lib/b.c:3
+`
+
+// Runs coverageSource with a hand-made line table.
+func runCovered(t *testing.T) (*risbee.RisbeeVm, *risbee.RisbeeCoverage) {
+	t.Helper()
+
+	code, err := asm.Assemble(coverageSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := &risbee.RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(message string) {
+		t.Errorf("panic: %s", message)
+	})
+	vm.LoadFromBytes(code)
+
+	vm.Lines = []risbee.RisbeeLine{
+		{Address: 0x1000, File: "src/a.c", Line: 10},
+		{Address: 0x1004, File: "src/a.c", Line: 11},
+		{Address: 0x100c, File: "src/a.c", Line: 12},
+		{Address: 0x1010, File: "src/a.c", Line: 13},
+		{Address: 0x1018, File: "src/a.c", Line: 14},
+		{Address: 0x1028, File: "src/a.c", Line: 0},
+		{Address: 0x1028, File: "lib/b.c", Line: 3},
+		{Address: 0x102c, File: "lib/b.c", Line: 0},
+	}
+
+	coverage := &risbee.RisbeeCoverage{}
+	vm.SetCoverage(coverage)
+	vm.Run()
+
+	return vm, coverage
+}
+
+func TestCoverageReport(t *testing.T) {
+	vm, coverage := runCovered(t)
+
+	want := []risbee.RisbeeFileCoverage{
+		{File: "lib/b.c", Lines: []risbee.RisbeeLineCoverage{
+			{Line: 3, Hits: 0, Branches: []risbee.RisbeeBranchCoverage{{Pc: 0x1028}}},
+		}},
+		{File: "src/a.c", Lines: []risbee.RisbeeLineCoverage{
+			{Line: 10, Hits: 1},
+			{Line: 11, Hits: 2, Branches: []risbee.RisbeeBranchCoverage{
+				{Pc: 0x1008, Taken: 1, NotTaken: 1},
+			}},
+			{Line: 12, Hits: 1},
+			{Line: 13, Hits: 2, Branches: []risbee.RisbeeBranchCoverage{
+				{Pc: 0x1014, Taken: 1, NotTaken: 1},
+			}},
+			{Line: 14, Hits: 1, Branches: []risbee.RisbeeBranchCoverage{
+				{Pc: 0x1018, Taken: 0, NotTaken: 1},
+			}},
+		}},
+	}
+
+	if report := coverage.Report(vm); !reflect.DeepEqual(report, want) {
+		t.Errorf("report\n%+v\nwant\n%+v", report, want)
+	}
+
+	if line, ok := vm.LineAt(0x100c); !ok || line.File != "src/a.c" || line.Line != 12 {
+		t.Errorf("LineAt(0x100c) = %+v, %v", line, ok)
+	}
+
+	if _, ok := vm.LineAt(0x102c); ok {
+		t.Error("LineAt found a line past the end of a sequence")
+	}
+}
+
+func TestCoverageLcov(t *testing.T) {
+	vm, coverage := runCovered(t)
+
+	var output bytes.Buffer
+	if err := coverage.WriteLcov(vm, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `TN:
+SF:lib/b.c
+BRDA:3,0,0,-
+BRDA:3,0,1,-
+DA:3,0
+BRF:2
+BRH:0
+LF:1
+LH:0
+end_of_record
+SF:src/a.c
+BRDA:11,0,0,1
+BRDA:11,0,1,1
+BRDA:13,0,0,1
+BRDA:13,0,1,1
+BRDA:14,0,0,0
+BRDA:14,0,1,1
+DA:10,1
+DA:11,2
+DA:12,1
+DA:13,2
+DA:14,1
+BRF:6
+BRH:5
+LF:5
+LH:5
+end_of_record
+`
+
+	if output.String() != want {
+		t.Errorf("tracefile\n%s\nwant\n%s", output.String(), want)
+	}
+}
+
+func TestCoverageCobertura(t *testing.T) {
+	vm, coverage := runCovered(t)
+
+	var output bytes.Buffer
+	if err := coverage.WriteCobertura(vm, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	type line struct {
+		Number    int    `xml:"number,attr"`
+		Hits      uint64 `xml:"hits,attr"`
+		Branch    bool   `xml:"branch,attr"`
+		Condition string `xml:"condition-coverage,attr"`
+	}
+
+	type class struct {
+		Filename   string `xml:"filename,attr"`
+		LineRate   string `xml:"line-rate,attr"`
+		BranchRate string `xml:"branch-rate,attr"`
+		Lines      []line `xml:"lines>line"`
+	}
+
+	type pkg struct {
+		Name       string  `xml:"name,attr"`
+		LineRate   string  `xml:"line-rate,attr"`
+		BranchRate string  `xml:"branch-rate,attr"`
+		Classes    []class `xml:"classes>class"`
+	}
+
+	var report struct {
+		LineRate        string `xml:"line-rate,attr"`
+		BranchRate      string `xml:"branch-rate,attr"`
+		LinesCovered    int    `xml:"lines-covered,attr"`
+		LinesValid      int    `xml:"lines-valid,attr"`
+		BranchesCovered int    `xml:"branches-covered,attr"`
+		BranchesValid   int    `xml:"branches-valid,attr"`
+		Packages        []pkg  `xml:"packages>package"`
+	}
+
+	if err := xml.Unmarshal(output.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.LineRate != "0.8333" || report.BranchRate != "0.6250" ||
+		report.LinesCovered != 5 || report.LinesValid != 6 ||
+		report.BranchesCovered != 5 || report.BranchesValid != 8 {
+		t.Errorf("totals %+v", report)
+	}
+
+	want := []pkg{
+		{Name: "lib", LineRate: "0.0000", BranchRate: "0.0000", Classes: []class{{
+			Filename: "lib/b.c", LineRate: "0.0000", BranchRate: "0.0000",
+			Lines: []line{{3, 0, true, "0% (0/2)"}},
+		}}},
+		{Name: "src", LineRate: "1.0000", BranchRate: "0.8333", Classes: []class{{
+			Filename: "src/a.c", LineRate: "1.0000", BranchRate: "0.8333",
+			Lines: []line{
+				{10, 1, false, ""},
+				{11, 2, true, "100% (2/2)"},
+				{12, 1, false, ""},
+				{13, 2, true, "100% (2/2)"},
+				{14, 1, true, "50% (1/2)"},
+			},
+		}}},
+	}
+
+	if !reflect.DeepEqual(report.Packages, want) {
+		t.Errorf("packages\n%+v\nwant\n%+v", report.Packages, want)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+// ReadCsr returns the current value of the control and
+// status register at the given address. Registers that
+// were never written read as zero.
+func (vm *RisbeeVm) ReadCsr(Address uint64) uint64 {
+	return vm.Csrs[Address]
+}
+
+// WriteCsr sets the control and status register at the
+// given address from the host side. Unlike guest CSR
+// instructions, it may also update read-only registers
+// such as mhartid, which is how RisbeeMachine assigns
+// hart identifiers.
+func (vm *RisbeeVm) WriteCsr(Address uint64, Value uint64) {
+	if vm.Csrs == nil {
+		vm.Csrs = map[uint64]uint64{}
+	}
+
+	vm.Csrs[Address] = Value
+}
+
+// Checks whether a CSR address belongs to the read-only
+// space, which the RISC-V privileged specification marks
+// by setting the two topmost address bits.
+func isReadOnlyCsr(address uint64) bool {
+	return (address>>10)&0x3 == 0x3
+}
+
+// Executes a Zicsr instruction.
+//
+// Parameters:
+// - functionCode3 The CSR operation (CSRRW, CSRRS, ...).
+// - address The 12-bit CSR address.
+// - rd The destination register receiving the old value.
+// - rs1 The source register, or the 5-bit immediate for
+// the immediate variants.
+func (vm *RisbeeVm) executeCsr(
+	functionCode3 uint32,
+	address uint64,
+	rd uint32,
+	rs1 uint32,
+) {
+	operand := vm.Registers[rs1]
+	if functionCode3 >= RISBEE_FC3_CSRRWI {
+		operand = uint64(rs1)
+	}
+
+	old := vm.ReadCsr(address)
+	val := old
+	write := rs1 != 0
+
+	switch functionCode3 {
+	case RISBEE_FC3_CSRRW, RISBEE_FC3_CSRRWI:
+		val = operand
+		write = true
+
+	case RISBEE_FC3_CSRRS, RISBEE_FC3_CSRRSI:
+		val = old | operand
+
+	case RISBEE_FC3_CSRRC, RISBEE_FC3_CSRRCI:
+		val = old &^ operand
+
+	default:
+		vm.panic("Invalid CSR instruction.")
+		return
+	}
+
+	if write {
+		if isReadOnlyCsr(address) {
+			vm.panic("Write to read-only CSR.")
+			return
+		}
+
+		vm.WriteCsr(address, val)
+	}
+
+	if rd != 0 {
+		vm.Registers[rd] = old
+	}
+}
@@ -0,0 +1,496 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+// Execution engines a VM can run instructions with.
+const (
+	// RISBEE_ENGINE_DECODE interprets instructions through
+	// a cache of pre-decoded instructions. It is the default.
+	RISBEE_ENGINE_DECODE = 0
+	// RISBEE_ENGINE_SWITCH decodes every instruction again
+	// as it executes it.
+	RISBEE_ENGINE_SWITCH = 1
+	// RISBEE_ENGINE_BLOCKS translates basic blocks into
+	// chains of Go closures. Single steps still use the
+	// decode cache.
+	RISBEE_ENGINE_BLOCKS = 2
+	// RISBEE_ENGINE_JIT runs translated blocks like
+	// RISBEE_ENGINE_BLOCKS and compiles the hot ones to
+	// native code. It is supported on linux/amd64 and the
+	// same as RISBEE_ENGINE_BLOCKS elsewhere.
+	RISBEE_ENGINE_JIT = 3
+)
+
+// A pre-decoded instruction: the handler implementing it,
+// with its operands extracted and its immediate sign-extended.
+// Instructions without a dedicated handler are run through
+// execute.
+type decodedInst struct {
+	handler func(vm *RisbeeVm, d *decodedInst)
+	block   *translatedBlock // Block starting here, if translated
+	inst    uint32
+	rd      uint32
+	rs1     uint32
+	rs2     uint32
+	imm     int64
+}
+
+// A page worth of decoded instructions.
+type decodePage [1024]decodedInst
+
+// Caches decoded instructions by program counter, in pages
+// of 4 KiB of guest code. Each entry remembers the word it
+// was decoded from and is decoded again once memory holds a
+// different word, so stores to code, host-side writes and
+// reloads are all picked up.
+type decodeCache struct {
+	pages    map[uint64]*decodePage
+	last     *decodePage
+	lastPage uint64
+}
+
+// Drops all decoded instructions.
+func (cache *decodeCache) reset() {
+	cache.pages = nil
+	cache.last = nil
+}
+
+// Steps the VM until it stops. While no tracer, recorder,
+// profiler or coverage collector is attached, instructions
+// are run straight from the decode cache, or as translated
+// blocks with RISBEE_ENGINE_BLOCKS and RISBEE_ENGINE_JIT.
+func (vm *RisbeeVm) loop() {
+	for vm.Running {
+		if vm.Engine == RISBEE_ENGINE_SWITCH || vm.ExecTracer != nil ||
+			vm.Recorder != nil || vm.Profiler != nil || vm.Coverage != nil {
+			vm.Step()
+			continue
+		}
+
+		if vm.Engine == RISBEE_ENGINE_BLOCKS || vm.Engine == RISBEE_ENGINE_JIT {
+			vm.executeBlock()
+			continue
+		}
+
+		vm.executeDecoded()
+		vm.Instret++
+	}
+}
+
+// Executes the instruction at the program counter through
+// the decode cache.
+func (vm *RisbeeVm) executeDecoded() {
+	pc := vm.Pc
+	if pc&3 != 0 || !vm.inMemory(pc, 4) {
+		if inst, ok := vm.fetch(); ok {
+			vm.execute(inst)
+		}
+
+		return
+	}
+
+	entry := vm.decodeEntry(pc)
+	inst := uint32LittleEndian(vm.Memory[pc:])
+
+	if entry.handler == nil || entry.inst != inst {
+		decodeInst(entry, inst)
+	}
+
+	entry.handler(vm, entry)
+}
+
+// Returns the cache entry of an aligned program counter,
+// allocating its page on first use.
+func (vm *RisbeeVm) decodeEntry(pc uint64) *decodedInst {
+	cache := &vm.decoded
+	if cache.last == nil || cache.lastPage != pc>>12 {
+		page := cache.pages[pc>>12]
+		if page == nil {
+			if cache.pages == nil {
+				cache.pages = map[uint64]*decodePage{}
+			}
+
+			page = &decodePage{}
+			cache.pages[pc>>12] = page
+		}
+
+		cache.last, cache.lastPage = page, pc>>12
+	}
+
+	return &cache.last[(pc&0xFFF)>>2]
+}
+
+// Decodes an instruction word into an entry.
+func decodeInst(entry *decodedInst, inst uint32) {
+	*entry = decodedInst{
+		handler: execGeneric,
+		block:   entry.block,
+		inst:    inst,
+		rd:      (inst >> 7) & 0x1F,
+		rs1:     (inst >> 15) & 0x1F,
+		rs2:     (inst >> 20) & 0x1F,
+		imm:     int64(int32(inst&0xFFF00000) >> 20),
+	}
+
+	functionCode3 := (inst >> 12) & 0x7
+	functionCode7 := (inst >> 25) & 0x7F
+
+	switch inst & 0x7F {
+	case RISBEE_OPINST_LOAD:
+		entry.handler = loadHandlers[functionCode3]
+
+	case RISBEE_OPINST_STORE:
+		imm11_5 := (inst >> 20) & 0xFE0
+		imm4_0 := (inst >> 7) & 0x1F
+		entry.imm = int64(int32((imm11_5|imm4_0)<<20) >> 20)
+		entry.handler = storeHandlers[functionCode3]
+
+	case RISBEE_OPINST_IMM:
+		entry.handler = immHandlers[functionCode3]
+
+		if functionCode3 == RISBEE_FC3_SLLI || functionCode3 == RISBEE_FC3_SRLI {
+			entry.imm = int64((inst >> 20) & 0x3F)
+		}
+
+		if functionCode3 == RISBEE_FC3_SRLI {
+			switch (inst >> 26) >> 4 {
+			case 0x0:
+				entry.handler = execSrli
+
+			case 0x1:
+				entry.handler = execSrai
+
+			default:
+				entry.handler = nil
+			}
+		}
+
+	case RISBEE_OPINST_RT64:
+		switch (functionCode7 << 3) | functionCode3 {
+		case RISBEE_OPINST_RT64_ADD:
+			entry.handler = execAdd
+
+		case RISBEE_OPINST_RT64_SUB:
+			entry.handler = execSub
+
+		case RISBEE_OPINST_RT64_SLL:
+			entry.handler = execSll
+
+		case RISBEE_OPINST_RT64_SLT:
+			entry.handler = execSlt
+
+		case RISBEE_OPINST_RT64_SLTU:
+			entry.handler = execSltu
+
+		case RISBEE_OPINST_RT64_XOR:
+			entry.handler = execXor
+
+		case RISBEE_OPINST_RT64_SRL:
+			entry.handler = execSrl
+
+		case RISBEE_OPINST_RT64_SRA:
+			entry.handler = execSra
+
+		case RISBEE_OPINST_RT64_OR:
+			entry.handler = execOr
+
+		case RISBEE_OPINST_RT64_AND:
+			entry.handler = execAnd
+
+		case RISBEE_OPINST_RT64_MUL:
+			entry.handler = execMul
+		}
+
+	case RISBEE_OPINST_LUI:
+		entry.imm = int64(int32(inst & 0xFFFFF000))
+		entry.handler = execLui
+
+	case RISBEE_OPINST_AUIPC:
+		entry.imm = int64(int32(inst & 0xFFFFF000))
+		entry.handler = execAuipc
+
+	case RISBEE_OPINST_JAL:
+		entry.imm = jalOffset(inst)
+		entry.handler = execJal
+
+	case RISBEE_OPINST_JALR:
+		entry.handler = execJalr
+
+	case RISBEE_OPINST_BRANCH:
+		entry.imm = branchOffset(inst)
+		entry.handler = branchHandlers[functionCode3]
+	}
+
+	if entry.handler == nil {
+		entry.handler = execGeneric
+	}
+}
+
+// Handlers of the valid function codes of the load,
+// store, immediate and branch opcodes.
+var (
+	loadHandlers = [8]func(*RisbeeVm, *decodedInst){
+		RISBEE_FC3_LB:   execLb,
+		RISBEE_FC3_LHW:  execLh,
+		RISBEE_FC3_LW:   execLw,
+		RISBEE_FC3_LDW:  execLd,
+		RISBEE_FC3_LBU:  execLbu,
+		RISBEE_FC3_LHU:  execLhu,
+		RISBEE_FC3_LRES: execLwu,
+	}
+
+	storeHandlers = [8]func(*RisbeeVm, *decodedInst){
+		RISBEE_FC3_SB:  execSb,
+		RISBEE_FC3_SHW: execSh,
+		RISBEE_FC3_SW:  execSw,
+		RISBEE_FC3_SDW: execSd,
+	}
+
+	immHandlers = [8]func(*RisbeeVm, *decodedInst){
+		RISBEE_FC3_ADDI:  execAddi,
+		RISBEE_FC3_SLLI:  execSlli,
+		RISBEE_FC3_SLTI:  execSlti,
+		RISBEE_FC3_SLTIU: execSltiu,
+		RISBEE_FC3_XORI:  execXori,
+		RISBEE_FC3_ORI:   execOri,
+		RISBEE_FC3_ANDI:  execAndi,
+	}
+
+	branchHandlers = [8]func(*RisbeeVm, *decodedInst){
+		RISBEE_FC3_BEQ:  execBeq,
+		RISBEE_FC3_BNE:  execBne,
+		RISBEE_FC3_BLT:  execBlt,
+		RISBEE_FC3_BGE:  execBge,
+		RISBEE_FC3_BLTU: execBltu,
+		RISBEE_FC3_BGEU: execBgeu,
+	}
+)
+
+// Runs an instruction without a dedicated handler.
+func execGeneric(vm *RisbeeVm, d *decodedInst) {
+	vm.execute(d.inst)
+}
+
+// Writes a result to rd, unless it is x0, and moves on to
+// the next instruction.
+func (vm *RisbeeVm) writeBack(rd uint32, val uint64) {
+	if rd != 0 {
+		vm.Registers[rd] = val
+	}
+
+	vm.Pc += 4
+}
+
+// Returns the effective address of a load or store.
+func (d *decodedInst) address(vm *RisbeeVm) uint64 {
+	return vm.Registers[d.rs1] + uint64(d.imm)
+}
+
+func execLb(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, uint64(int64(int8(vm.load(d.address(vm), 1)))))
+}
+
+func execLh(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, uint64(int64(int16(vm.load(d.address(vm), 2)))))
+}
+
+func execLw(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, uint64(int64(int32(vm.load(d.address(vm), 4)))))
+}
+
+func execLd(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.load(d.address(vm), 8))
+}
+
+func execLbu(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.load(d.address(vm), 1))
+}
+
+func execLhu(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.load(d.address(vm), 2))
+}
+
+func execLwu(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.load(d.address(vm), 4))
+}
+
+func execSb(vm *RisbeeVm, d *decodedInst) {
+	vm.store(d.address(vm), 1, vm.Registers[d.rs2])
+	vm.Pc += 4
+}
+
+func execSh(vm *RisbeeVm, d *decodedInst) {
+	vm.store(d.address(vm), 2, vm.Registers[d.rs2])
+	vm.Pc += 4
+}
+
+func execSw(vm *RisbeeVm, d *decodedInst) {
+	vm.store(d.address(vm), 4, vm.Registers[d.rs2])
+	vm.Pc += 4
+}
+
+func execSd(vm *RisbeeVm, d *decodedInst) {
+	vm.store(d.address(vm), 8, vm.Registers[d.rs2])
+	vm.Pc += 4
+}
+
+func execAddi(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.Registers[d.rs1]+uint64(d.imm))
+}
+
+func execSlli(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, uint64(shiftLeftInt64(int64(vm.Registers[d.rs1]), d.imm)))
+}
+
+func execSlti(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, boolToUint64(int64(vm.Registers[d.rs1]) < d.imm))
+}
+
+func execSltiu(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, boolToUint64(vm.Registers[d.rs1] < uint64(d.imm)))
+}
+
+func execXori(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.Registers[d.rs1]^uint64(d.imm))
+}
+
+func execSrli(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, uint64(shiftRightInt64(int64(vm.Registers[d.rs1]), d.imm)))
+}
+
+func execSrai(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, uint64(arithShiftRightInt64(int64(vm.Registers[d.rs1]), d.imm)))
+}
+
+func execOri(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.Registers[d.rs1]|uint64(d.imm))
+}
+
+func execAndi(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.Registers[d.rs1]&uint64(d.imm))
+}
+
+func execAdd(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.Registers[d.rs1]+vm.Registers[d.rs2])
+}
+
+func execSub(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.Registers[d.rs1]-vm.Registers[d.rs2])
+}
+
+func execSll(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, uint64(shiftLeftInt64(
+		int64(vm.Registers[d.rs1]),
+		int64(vm.Registers[d.rs2])&0x1F,
+	)))
+}
+
+func execSlt(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, boolToUint64(int64(vm.Registers[d.rs1]) < int64(vm.Registers[d.rs2])))
+}
+
+func execSltu(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, boolToUint64(vm.Registers[d.rs1] < vm.Registers[d.rs2]))
+}
+
+func execXor(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.Registers[d.rs1]^vm.Registers[d.rs2])
+}
+
+func execSrl(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, uint64(shiftRightInt64(
+		int64(vm.Registers[d.rs1]),
+		int64(vm.Registers[d.rs2])&0x1F,
+	)))
+}
+
+func execSra(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, uint64(arithShiftRightInt64(
+		int64(vm.Registers[d.rs1]),
+		int64(vm.Registers[d.rs2])&0x1F,
+	)))
+}
+
+func execOr(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.Registers[d.rs1]|vm.Registers[d.rs2])
+}
+
+func execAnd(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.Registers[d.rs1]&vm.Registers[d.rs2])
+}
+
+func execMul(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.Registers[d.rs1]*vm.Registers[d.rs2])
+}
+
+func execLui(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, uint64(d.imm))
+}
+
+func execAuipc(vm *RisbeeVm, d *decodedInst) {
+	vm.writeBack(d.rd, vm.Pc+uint64(d.imm))
+}
+
+func execJal(vm *RisbeeVm, d *decodedInst) {
+	if d.rd != 0 {
+		vm.Registers[d.rd] = vm.Pc + 4
+	}
+
+	vm.Pc += uint64(d.imm)
+}
+
+func execJalr(vm *RisbeeVm, d *decodedInst) {
+	pc := vm.Pc + 4
+	vm.Pc = (vm.Registers[d.rs1] + uint64(d.imm)) &^ 1
+
+	if d.rd != 0 {
+		vm.Registers[d.rd] = pc
+	}
+}
+
+// Moves to the branch target if condition holds, or to
+// the next instruction otherwise.
+func (vm *RisbeeVm) branch(d *decodedInst, condition bool) {
+	if condition {
+		vm.Pc += uint64(d.imm)
+	} else {
+		vm.Pc += 4
+	}
+}
+
+func execBeq(vm *RisbeeVm, d *decodedInst) {
+	vm.branch(d, vm.Registers[d.rs1] == vm.Registers[d.rs2])
+}
+
+func execBne(vm *RisbeeVm, d *decodedInst) {
+	vm.branch(d, vm.Registers[d.rs1] != vm.Registers[d.rs2])
+}
+
+func execBlt(vm *RisbeeVm, d *decodedInst) {
+	vm.branch(d, int64(vm.Registers[d.rs1]) < int64(vm.Registers[d.rs2]))
+}
+
+func execBge(vm *RisbeeVm, d *decodedInst) {
+	vm.branch(d, int64(vm.Registers[d.rs1]) >= int64(vm.Registers[d.rs2]))
+}
+
+func execBltu(vm *RisbeeVm, d *decodedInst) {
+	vm.branch(d, vm.Registers[d.rs1] < vm.Registers[d.rs2])
+}
+
+func execBgeu(vm *RisbeeVm, d *decodedInst) {
+	vm.branch(d, vm.Registers[d.rs1] >= vm.Registers[d.rs2])
+}
+
+// Converts a condition to 1 or 0.
+func boolToUint64(condition bool) uint64 {
+	if condition {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+// RisbeeDevice is implemented by memory-mapped peripherals.
+// Offsets are relative to the base address the device was
+// attached at, and sizes are 1, 2, 4 or 8 bytes. The VM that
+// performed the access is passed along so that devices can
+// reach guest memory, e.g. for DMA.
+type RisbeeDevice interface {
+	Read(vm *RisbeeVm, Offset uint64, Size uint64) uint64
+	Write(vm *RisbeeVm, Offset uint64, Size uint64, Value uint64)
+}
+
+// RisbeeDmaDevice is implemented by devices that know
+// which guest memory a register write may change. While a
+// RisbeeRecorder is recording, only those ranges are then
+// watched across the write instead of all of memory.
+type RisbeeDmaDevice interface {
+	RisbeeDevice
+
+	// DmaRanges returns the guest memory a write of Value
+	// at Offset may modify, nil if none.
+	DmaRanges(vm *RisbeeVm, Offset uint64, Size uint64, Value uint64) []RisbeeMemoryRegion
+}
+
+// RisbeeDeviceMapping describes the guest physical
+// address window a device occupies.
+type RisbeeDeviceMapping struct {
+	Base   uint64       // First guest address of the window
+	Size   uint64       // Window size in bytes
+	Device RisbeeDevice // Device serving the window
+}
+
+// AttachDevice maps a device into the guest address space at
+// [Base, Base+Size). Loads and stores within that window are
+// forwarded to the device instead of VM memory, so the window
+// should lie outside the memory image.
+func (vm *RisbeeVm) AttachDevice(
+	Base uint64,
+	Size uint64,
+	Device RisbeeDevice,
+) {
+	vm.Devices = append(vm.Devices, RisbeeDeviceMapping{
+		Base:   Base,
+		Size:   Size,
+		Device: Device,
+	})
+}
+
+// AttachDevice maps a device into the address space of
+// every hart of the machine.
+func (machine *RisbeeMachine) AttachDevice(
+	Base uint64,
+	Size uint64,
+	Device RisbeeDevice,
+) {
+	for _, hart := range machine.Harts {
+		hart.AttachDevice(Base, Size, Device)
+	}
+}
+
+// Looks up the device mapped at the given address.
+//
+// Returns the mapping, or nil if the address is
+// backed by plain memory.
+func (vm *RisbeeVm) findDevice(addr uint64) *RisbeeDeviceMapping {
+	for index := range vm.Devices {
+		mapping := &vm.Devices[index]
+		if addr >= mapping.Base && addr-mapping.Base < mapping.Size {
+			return mapping
+		}
+	}
+
+	return nil
+}
+
+// Checks whether [addr, addr+size) lies within VM memory.
+func (vm *RisbeeVm) inMemory(addr uint64, size uint64) bool {
+	return addr+size >= addr && addr+size <= uint64(len(vm.Memory))
+}
+
+// Performs a guest load of size bytes at addr, dispatching
+// to a mapped device when one covers the address.
+//
+// Returns the zero-extended value read.
+func (vm *RisbeeVm) load(addr uint64, size uint64) uint64 {
+	value, ok := vm.loadValue(addr, size)
+	if ok && len(vm.Watchpoints) != 0 {
+		vm.fireWatchpoints(addr, size, false, value, value)
+	}
+
+	return value
+}
+
+// Reads size bytes at addr from a device or memory.
+//
+// Returns the value and whether the access succeeded.
+func (vm *RisbeeVm) loadValue(addr uint64, size uint64) (uint64, bool) {
+	if mapping := vm.findDevice(addr); mapping != nil {
+		return mapping.Device.Read(vm, addr-mapping.Base, size), true
+	}
+
+	if err := vm.checkAccess(addr, size, RISBEE_MEM_READ); err != nil {
+		vm.memoryFault(err, "load")
+		return 0, false
+	}
+
+	return vm.peek(addr, size), true
+}
+
+// Performs a guest store of the lowest size bytes of val
+// at addr, dispatching to a mapped device when one covers
+// the address.
+func (vm *RisbeeVm) store(addr uint64, size uint64, val uint64) {
+	if len(vm.Watchpoints) == 0 && vm.Recorder == nil {
+		if vm.storeValue(addr, size, val) && vm.ExecTracer != nil {
+			vm.ExecTracer.recordStore(addr, size, val&sizeMask(size))
+		}
+
+		return
+	}
+
+	var old uint64
+	mapping := vm.findDevice(addr)
+	device := mapping != nil
+	if !device && vm.inMemory(addr, size) {
+		old = vm.peek(addr, size)
+	}
+
+	if device && vm.Recorder != nil {
+		// Devices may write guest memory through DMA.
+		if dma, ok := mapping.Device.(RisbeeDmaDevice); !ok {
+			vm.Recorder.watchMemory(vm, nil)
+		} else if ranges := dma.DmaRanges(vm, addr-mapping.Base, size, val); len(ranges) != 0 {
+			vm.Recorder.watchMemory(vm, ranges)
+		}
+	}
+
+	if !vm.storeValue(addr, size, val) {
+		return
+	}
+
+	if vm.ExecTracer != nil {
+		vm.ExecTracer.recordStore(addr, size, val&sizeMask(size))
+	}
+
+	if !device && vm.Recorder != nil {
+		vm.Recorder.recordStore(vm, addr, size, old)
+	}
+
+	if len(vm.Watchpoints) != 0 {
+		vm.fireWatchpoints(addr, size, true, old, val&sizeMask(size))
+	}
+}
+
+// Writes size bytes at addr to a device or memory.
+//
+// Returns whether the access succeeded.
+func (vm *RisbeeVm) storeValue(addr uint64, size uint64, val uint64) bool {
+	if mapping := vm.findDevice(addr); mapping != nil {
+		mapping.Device.Write(vm, addr-mapping.Base, size, val)
+		return true
+	}
+
+	if err := vm.checkAccess(addr, size, RISBEE_MEM_WRITE); err != nil {
+		vm.memoryFault(err, "store")
+		return false
+	}
+
+	switch size {
+	case 1:
+		vm.Memory[addr] = byte(val)
+
+	case 2:
+		putUint16(vm.Memory[addr:], uint16(val))
+
+	case 4:
+		putUint32(vm.Memory[addr:], uint32(val))
+
+	default:
+		putUint64(vm.Memory[addr:], val)
+	}
+
+	return true
+}
+
+// Reads size bytes of memory at addr, which must be in range.
+func (vm *RisbeeVm) peek(addr uint64, size uint64) uint64 {
+	switch size {
+	case 1:
+		return uint64(vm.Memory[addr])
+
+	case 2:
+		return uint64(uint16LittleEndian(vm.Memory[addr:]))
+
+	case 4:
+		return uint64(uint32LittleEndian(vm.Memory[addr:]))
+	}
+
+	return uint64LittleEndian(vm.Memory[addr:])
+}
+
+// Returns a mask of the lowest size bytes.
+func sizeMask(size uint64) uint64 {
+	if size >= 8 {
+		return ^uint64(0)
+	}
+
+	return 1<<(8*size) - 1
+}
+
+// Reports a failed guest memory access through panic.
+func (vm *RisbeeVm) memoryFault(err error, access string) {
+	if err == ErrMemoryPermission {
+		vm.panic("Memory " + access + " not permitted.")
+		return
+	}
+
+	vm.panic("Memory " + access + " out of range.")
+}
@@ -0,0 +1,433 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RisbeeRegisterNames holds the ABI names of the general
+// purpose registers, indexed by register number.
+var RisbeeRegisterNames = [32]string{
+	"zero", "ra", "sp", "gp", "tp", "t0", "t1", "t2",
+	"s0", "s1", "a0", "a1", "a2", "a3", "a4", "a5",
+	"a6", "a7", "s2", "s3", "s4", "s5", "s6", "s7",
+	"s8", "s9", "s10", "s11", "t3", "t4", "t5", "t6",
+}
+
+// Names of well-known control and status registers, as
+// printed by GNU objdump.
+var csrNames = map[uint32]string{
+	0x300:              "mstatus",
+	0x301:              "misa",
+	0x304:              "mie",
+	0x305:              "mtvec",
+	0x340:              "mscratch",
+	0x341:              "mepc",
+	0x342:              "mcause",
+	0x343:              "mtval",
+	0x344:              "mip",
+	0xC00:              "cycle",
+	0xC01:              "time",
+	0xC02:              "instret",
+	0xF11:              "mvendorid",
+	0xF12:              "marchid",
+	0xF13:              "mimpid",
+	RISBEE_CSR_MHARTID: "mhartid",
+}
+
+// Mnemonics of 64-bit register-register operations, keyed by
+// funct7 and funct3 as combined by execute.
+var rt64Names = map[uint32]string{
+	RISBEE_OPINST_RT64_ADD:    "add",
+	RISBEE_OPINST_RT64_SUB:    "sub",
+	RISBEE_OPINST_RT64_SLL:    "sll",
+	RISBEE_OPINST_RT64_SLT:    "slt",
+	RISBEE_OPINST_RT64_SLTU:   "sltu",
+	RISBEE_OPINST_RT64_XOR:    "xor",
+	RISBEE_OPINST_RT64_SRL:    "srl",
+	RISBEE_OPINST_RT64_SRA:    "sra",
+	RISBEE_OPINST_RT64_OR:     "or",
+	RISBEE_OPINST_RT64_AND:    "and",
+	RISBEE_OPINST_RT64_MUL:    "mul",
+	RISBEE_OPINST_RT64_MULH:   "mulh",
+	RISBEE_OPINST_RT64_MULHSU: "mulhsu",
+	RISBEE_OPINST_RT64_MULHU:  "mulhu",
+	RISBEE_OPINST_RT64_DIV:    "div",
+	RISBEE_OPINST_RT64_DIVU:   "divu",
+	RISBEE_OPINST_RT64_REM:    "rem",
+	RISBEE_OPINST_RT64_REMU:   "remu",
+}
+
+// Mnemonics of word-sized register-register operations.
+var rt32Names = map[uint32]string{
+	RISBEE_OPINST_RT32_ADDW:  "addw",
+	RISBEE_OPINST_RT32_SUBW:  "subw",
+	RISBEE_OPINST_RT32_SLLW:  "sllw",
+	RISBEE_OPINST_RT32_SRLW:  "srlw",
+	RISBEE_OPINST_RT32_SRAW:  "sraw",
+	RISBEE_OPINST_RT32_MULW:  "mulw",
+	RISBEE_OPINST_RT32_DIVW:  "divw",
+	RISBEE_OPINST_RT32_DIVUW: "divuw",
+	RISBEE_OPINST_RT32_REMW:  "remw",
+	RISBEE_OPINST_RT32_REMUW: "remuw",
+}
+
+// Disassemble renders a single instruction located at Pc
+// in GNU objdump syntax, using ABI register names and the
+// usual pseudo-instructions (li, mv, ret, j, beqz, csrr,
+// ...). Mnemonic and operands are separated by one space
+// and jump and branch targets are absolute hexadecimal
+// addresses. Words risbee does not decode are rendered
+// as ".insn 4, 0x<word>".
+func Disassemble(Inst uint32, Pc uint64) string {
+	mnemonic, operands := disassemble(Inst, Pc)
+	if operands == "" {
+		return mnemonic
+	}
+
+	return mnemonic + " " + operands
+}
+
+// BranchTarget returns the destination of a JAL or
+// conditional branch instruction located at Pc.
+func BranchTarget(Inst uint32, Pc uint64) (uint64, bool) {
+	switch Inst & 0x7F {
+	case RISBEE_OPINST_JAL:
+		return Pc + uint64(jalOffset(Inst)), true
+
+	case RISBEE_OPINST_BRANCH:
+		return Pc + uint64(branchOffset(Inst)), true
+	}
+
+	return 0, false
+}
+
+// Decodes the sign-extended immediate of a J-type instruction.
+func jalOffset(inst uint32) int64 {
+	imm20 := (inst >> 11) & 0x100000
+	imm10_1 := (inst >> 20) & 0x7FE
+	imm11 := (inst >> 9) & 0x800
+	imm19_12 := inst & 0xFF000
+
+	return int64(int32((imm20|imm10_1|imm11|imm19_12)<<11) >> 11)
+}
+
+// Decodes the sign-extended immediate of a B-type instruction.
+func branchOffset(inst uint32) int64 {
+	imm12 := (inst >> 19) & 0x1000
+	imm10_5 := (inst >> 20) & 0x7E0
+	imm4_1 := (inst >> 7) & 0x1E
+	imm11 := (inst << 4) & 0x800
+
+	return int64(int32((imm12|imm10_5|imm4_1|imm11)<<19) >> 19)
+}
+
+// Formats a CSR address by name when it is well known.
+func csrName(csr uint32) string {
+	if name, ok := csrNames[csr]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("0x%x", csr)
+}
+
+// Formats the predecessor or successor set of a FENCE.
+func fenceSet(bits uint32) string {
+	var set strings.Builder
+	for index, name := range "iorw" {
+		if bits&(8>>index) != 0 {
+			set.WriteRune(name)
+		}
+	}
+
+	return set.String()
+}
+
+// Decodes an instruction the same way execute does.
+//
+// Returns the mnemonic and its comma-separated operands.
+func disassemble(inst uint32, pc uint64) (string, string) {
+	opcode := inst & 0x7F
+	functionCode3 := (inst >> 12) & 0x7
+
+	rd := RisbeeRegisterNames[(inst>>7)&0x1F]
+	rs1 := RisbeeRegisterNames[(inst>>15)&0x1F]
+	rs2 := RisbeeRegisterNames[(inst>>20)&0x1F]
+
+	immediate := int64(int32(inst&0xFFF00000) >> 20)
+	invalid := fmt.Sprintf("4, 0x%08x", inst)
+
+	switch opcode {
+	case RISBEE_OPINST_LOAD:
+		names := [...]string{"lb", "lh", "lw", "ld", "lbu", "lhu", "lwu"}
+		if functionCode3 >= uint32(len(names)) {
+			break
+		}
+
+		return names[functionCode3], fmt.Sprintf("%s,%d(%s)", rd, immediate, rs1)
+
+	case RISBEE_OPINST_STORE:
+		names := [...]string{"sb", "sh", "sw", "sd"}
+		if functionCode3 >= uint32(len(names)) {
+			break
+		}
+
+		offset := int64(int32((((inst>>20)&0xFE0)|((inst>>7)&0x1F))<<20) >> 20)
+		return names[functionCode3], fmt.Sprintf("%s,%d(%s)", rs2, offset, rs1)
+
+	case RISBEE_OPINST_IMM:
+		shiftAmount := (inst >> 20) & 0x3F
+
+		switch functionCode3 {
+		case RISBEE_FC3_ADDI:
+			switch {
+			case inst == 0x00000013:
+				return "nop", ""
+
+			case rs1 == "zero":
+				return "li", fmt.Sprintf("%s,%d", rd, immediate)
+
+			case immediate == 0:
+				return "mv", rd + "," + rs1
+			}
+
+			return "addi", fmt.Sprintf("%s,%s,%d", rd, rs1, immediate)
+
+		case RISBEE_FC3_SLLI:
+			return "slli", fmt.Sprintf("%s,%s,0x%x", rd, rs1, shiftAmount)
+
+		case RISBEE_FC3_SLTI:
+			return "slti", fmt.Sprintf("%s,%s,%d", rd, rs1, immediate)
+
+		case RISBEE_FC3_SLTIU:
+			if immediate == 1 {
+				return "seqz", rd + "," + rs1
+			}
+
+			return "sltiu", fmt.Sprintf("%s,%s,%d", rd, rs1, immediate)
+
+		case RISBEE_FC3_XORI:
+			if immediate == -1 {
+				return "not", rd + "," + rs1
+			}
+
+			return "xori", fmt.Sprintf("%s,%s,%d", rd, rs1, immediate)
+
+		case RISBEE_FC3_SRLI:
+			switch (inst >> 26) >> 4 {
+			case 0x0:
+				return "srli", fmt.Sprintf("%s,%s,0x%x", rd, rs1, shiftAmount)
+
+			case 0x1:
+				return "srai", fmt.Sprintf("%s,%s,0x%x", rd, rs1, shiftAmount)
+			}
+
+		case RISBEE_FC3_ORI:
+			return "ori", fmt.Sprintf("%s,%s,%d", rd, rs1, immediate)
+
+		case RISBEE_FC3_ANDI:
+			return "andi", fmt.Sprintf("%s,%s,%d", rd, rs1, immediate)
+		}
+
+	case RISBEE_OPINST_IALU:
+		shiftAmount := (inst >> 20) & 0x1F
+
+		switch functionCode3 {
+		case RISBEE_FC3_SLLIW:
+			if immediate == 0 {
+				return "sext.w", rd + "," + rs1
+			}
+
+			return "addiw", fmt.Sprintf("%s,%s,%d", rd, rs1, immediate)
+
+		case RISBEE_FC3_SRLIW:
+			return "slliw", fmt.Sprintf("%s,%s,0x%x", rd, rs1, shiftAmount)
+
+		case RISBEE_FC3_SRAIW:
+			switch (inst >> 25) >> 5 {
+			case 0x0:
+				return "srliw", fmt.Sprintf("%s,%s,0x%x", rd, rs1, shiftAmount)
+
+			case 0x1:
+				return "sraiw", fmt.Sprintf("%s,%s,0x%x", rd, rs1, shiftAmount)
+			}
+
+		// Risbee-specific encodings without a standard mnemonic.
+		case RISBEE_FC3_SLLI64:
+			return "slli64", fmt.Sprintf("%s,%s,0x%x", rd, rs1, immediate&0x3F)
+
+		case RISBEE_FC3_SRLI64:
+			return "srli64", fmt.Sprintf("%s,%s,0x%x", rd, rs1, immediate&0x3F)
+		}
+
+	case RISBEE_OPINST_RT64:
+
+		name, ok := rt64Names[((inst>>25)<<3)|functionCode3]
+		if !ok {
+			break
+		}
+
+		switch {
+		case name == "sub" && rs1 == "zero":
+			return "neg", rd + "," + rs2
+
+		case name == "sltu" && rs1 == "zero":
+			return "snez", rd + "," + rs2
+		}
+
+		return name, rd + "," + rs1 + "," + rs2
+
+	case RISBEE_OPINST_RT32:
+
+		name, ok := rt32Names[((inst>>25)<<3)|functionCode3]
+		if !ok {
+			break
+		}
+
+		if name == "subw" && rs1 == "zero" {
+			return "negw", rd + "," + rs2
+		}
+
+		return name, rd + "," + rs1 + "," + rs2
+
+	case RISBEE_OPINST_LUI:
+		return "lui", fmt.Sprintf("%s,0x%x", rd, inst>>12)
+
+	case RISBEE_OPINST_AUIPC:
+		return "auipc", fmt.Sprintf("%s,0x%x", rd, inst>>12)
+
+	case RISBEE_OPINST_JAL:
+		target := fmt.Sprintf("%x", pc+uint64(jalOffset(inst)))
+
+		switch rd {
+		case "zero":
+			return "j", target
+
+		case "ra":
+			return "jal", target
+		}
+
+		return "jal", rd + "," + target
+
+	case RISBEE_OPINST_JALR:
+		switch {
+		case rd == "zero" && rs1 == "ra" && immediate == 0:
+			return "ret", ""
+
+		case rd == "zero" && immediate == 0:
+			return "jr", rs1
+
+		case rd == "ra" && immediate == 0:
+			return "jalr", rs1
+		}
+
+		return "jalr", fmt.Sprintf("%s,%d(%s)", rd, immediate, rs1)
+
+	case RISBEE_OPINST_BRANCH:
+		names := [...]string{"beq", "bne", "", "", "blt", "bge", "bltu", "bgeu"}
+		name := names[functionCode3]
+		if name == "" {
+			break
+		}
+
+		target := fmt.Sprintf("%x", pc+uint64(branchOffset(inst)))
+		switch {
+		case rs2 == "zero" && name == "beq",
+			rs2 == "zero" && name == "bne",
+			rs2 == "zero" && name == "blt",
+			rs2 == "zero" && name == "bge":
+			return name + "z", rs1 + "," + target
+
+		case rs1 == "zero" && name == "blt":
+			return "bgtz", rs2 + "," + target
+
+		case rs1 == "zero" && name == "bge":
+			return "blez", rs2 + "," + target
+		}
+
+		return name, rs1 + "," + rs2 + "," + target
+
+	case RISBEE_OPINST_FENCE:
+		if functionCode3 == 1 {
+			return "fence.i", ""
+		}
+
+		predecessor := fenceSet((inst >> 24) & 0xF)
+		successor := fenceSet((inst >> 20) & 0xF)
+
+		if predecessor == "iorw" && successor == "iorw" {
+			return "fence", ""
+		}
+
+		return "fence", predecessor + "," + successor
+
+	case RISBEE_OPINST_CALL:
+		csr := csrName(inst >> 20)
+		zimm := (inst >> 15) & 0x1F
+
+		switch functionCode3 {
+		case RISBEE_FC3_PRIV:
+			switch inst >> 20 {
+			case 0x0:
+				return "ecall", ""
+
+			case 0x1:
+				return "ebreak", ""
+			}
+
+		case RISBEE_FC3_CSRRW:
+			if rd == "zero" {
+				return "csrw", csr + "," + rs1
+			}
+
+			return "csrrw", rd + "," + csr + "," + rs1
+
+		case RISBEE_FC3_CSRRS:
+			switch {
+			case rs1 == "zero":
+				return "csrr", rd + "," + csr
+
+			case rd == "zero":
+				return "csrs", csr + "," + rs1
+			}
+
+			return "csrrs", rd + "," + csr + "," + rs1
+
+		case RISBEE_FC3_CSRRC:
+			if rd == "zero" {
+				return "csrc", csr + "," + rs1
+			}
+
+			return "csrrc", rd + "," + csr + "," + rs1
+
+		case RISBEE_FC3_CSRRWI:
+			if rd == "zero" {
+				return "csrwi", fmt.Sprintf("%s,%d", csr, zimm)
+			}
+
+			return "csrrwi", fmt.Sprintf("%s,%s,%d", rd, csr, zimm)
+
+		case RISBEE_FC3_CSRRSI:
+			if rd == "zero" {
+				return "csrsi", fmt.Sprintf("%s,%d", csr, zimm)
+			}
+
+			return "csrrsi", fmt.Sprintf("%s,%s,%d", rd, csr, zimm)
+
+		case RISBEE_FC3_CSRRCI:
+			if rd == "zero" {
+				return "csrci", fmt.Sprintf("%s,%d", csr, zimm)
+			}
+
+			return "csrrci", fmt.Sprintf("%s,%s,%d", rd, csr, zimm)
+		}
+	}
+
+	return ".insn", invalid
+}
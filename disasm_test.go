@@ -0,0 +1,109 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/nthnn/risbee"
+	"github.com/nthnn/risbee/asm"
+)
+
+// Output of GNU objdump -d for the same source assembled
+// with GNU as at 0x1000, relaxation disabled. Statements
+// are joined with "; ".
+func TestDisassemble(t *testing.T) {
+	cases := []struct {
+		source string
+		want   string
+	}{
+		{"addi a0, a0, 1", "addi a0,a0,1"},
+		{"addi sp, sp, -32", "addi sp,sp,-32"},
+		{"andi a0, a0, -16", "andi a0,a0,-16"},
+		{"li a0, -1", "li a0,-1"},
+		{"li a0, 0x12345678", "lui a0,0x12345; addi a0,a0,1656"},
+		{"mv a0, a1", "mv a0,a1"},
+		{"nop", "nop"},
+		{"seqz a0, a1", "seqz a0,a1"},
+		{"snez a0, a1", "snez a0,a1"},
+		{"not a0, a1", "not a0,a1"},
+		{"neg a0, a1", "neg a0,a1"},
+		{"negw a0, a1", "negw a0,a1"},
+		{"sext.w a0, a1", "sext.w a0,a1"},
+		{"slli a0, a0, 32", "slli a0,a0,0x20"},
+		{"srai a0, a0, 63", "srai a0,a0,0x3f"},
+		{"sraiw a0, a0, 3", "sraiw a0,a0,0x3"},
+		{"mul a0, a0, a1", "mul a0,a0,a1"},
+		{"remuw a0, a1, a2", "remuw a0,a1,a2"},
+		{"lui a0, 0x12345", "lui a0,0x12345"},
+		{"auipc ra, 0", "auipc ra,0x0"},
+		{"ld a0, -8(sp)", "ld a0,-8(sp)"},
+		{"lbu a0, 0(a1)", "lbu a0,0(a1)"},
+		{"sd ra, -16(s0)", "sd ra,-16(s0)"},
+		{"ret", "ret"},
+		{"jr t0", "jr t0"},
+		{"jalr a0", "jalr a0"},
+		{"jalr t0, -8(a0)", "jalr t0,-8(a0)"},
+		{"j target; nop; target: nop", "j 1008; nop; nop"},
+		{"jal target; target: nop", "jal 1004; nop"},
+		{"jal t0, target; target: nop", "jal t0,1004; nop"},
+		{"beqz a0, target; target: nop", "beqz a0,1004; nop"},
+		{"bgtz a0, target; target: nop", "bgtz a0,1004; nop"},
+		{"bge zero, a0, target; target: nop", "blez a0,1004; nop"},
+		{"back: nop; bne a0, a1, back", "nop; bne a0,a1,1000"},
+		{"back: bltu a0, a1, back", "bltu a0,a1,1000"},
+		{"csrr a0, mhartid", "csrr a0,mhartid"},
+		{"csrw mscratch, a0", "csrw mscratch,a0"},
+		{"csrrw a0, mscratch, a1", "csrrw a0,mscratch,a1"},
+		{"fence", "fence"},
+		{"fence r, w", "fence r,w"},
+		{"fence.i", "fence.i"},
+		{"ecall", "ecall"},
+		{"ebreak", "ebreak"},
+	}
+
+	for _, test := range cases {
+		program, err := asm.AssembleAt(test.source, asm.DefaultBase)
+		if err != nil {
+			t.Errorf("%s: %v", test.source, err)
+			continue
+		}
+
+		var text []string
+		for offset := 0; offset < len(program.Code); offset += 4 {
+			text = append(text, risbee.Disassemble(
+				binary.LittleEndian.Uint32(program.Code[offset:]),
+				program.Base+uint64(offset),
+			))
+		}
+
+		if got := strings.Join(text, "; "); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.source, got, test.want)
+		}
+	}
+}
+
+func TestDisassembleIllegal(t *testing.T) {
+	cases := []struct {
+		word uint32
+		want string
+	}{
+		{0x00000000, ".insn 4, 0x00000000"},
+		{0xffffffff, ".insn 4, 0xffffffff"},
+		{0x00007003, ".insn 4, 0x00007003"}, // Load with funct3 7
+		{0x00002063, ".insn 4, 0x00002063"}, // Branch with funct3 2
+		{0x00200073, ".insn 4, 0x00200073"}, // System instruction other than ecall and ebreak
+	}
+
+	for _, test := range cases {
+		if got := risbee.Disassemble(test.word, 0x1000); got != test.want {
+			t.Errorf("0x%08x: got %q, want %q", test.word, got, test.want)
+		}
+	}
+}
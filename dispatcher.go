@@ -0,0 +1,337 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// RisbeeSyscallInfo describes a syscall being dispatched.
+type RisbeeSyscallInfo struct {
+	Code   uint64 // Syscall code from a7
+	Name   string // Registered name, empty if unnamed
+	Module string // Module the syscall belongs to, if any
+}
+
+// FullName returns the syscall name qualified with its
+// module, e.g. "fs.open", or the numeric code if the
+// syscall has no name.
+func (info RisbeeSyscallInfo) FullName() string {
+	switch {
+	case info.Name == "":
+		return fmt.Sprintf("syscall_%d", info.Code)
+
+	case info.Module == "":
+		return info.Name
+	}
+
+	return info.Module + "." + info.Name
+}
+
+// RisbeeSyscallMiddleware wraps every dispatched syscall.
+// It may inspect or alter the VM, short-circuit with its
+// own result, or call Next to continue down the chain.
+type RisbeeSyscallMiddleware func(
+	vm *RisbeeVm,
+	Info RisbeeSyscallInfo,
+	Next RisbeeVmSyscallFn,
+) uint64
+
+// RisbeeSyscallFallback handles syscall codes that have
+// no registered handler.
+type RisbeeSyscallFallback func(vm *RisbeeVm, Code uint64) uint64
+
+// RisbeeSyscallDispatcher routes syscalls to named handlers
+// grouped into modules, passing each call through a chain
+// of middleware. Code 0 is always the built-in exit, named
+// "exit", so middleware sees the program end too. Codes it
+// does not know fall back to the VM's SysCalls map, then
+// to Fallback and then to the Fallback of the VM; without
+// either, unknown codes still panic the VM.
+type RisbeeSyscallDispatcher struct {
+	Fallback RisbeeSyscallFallback // Handler for unknown codes
+
+	entries    map[uint64]syscallEntry
+	middleware []RisbeeSyscallMiddleware
+}
+
+// syscallEntry is a registered handler with its metadata.
+type syscallEntry struct {
+	info    RisbeeSyscallInfo
+	handler RisbeeVmSyscallFn
+}
+
+// RisbeeSyscallModule is a namespace of syscalls whose
+// codes are allocated relative to a base code.
+type RisbeeSyscallModule struct {
+	Name string // Module name used as prefix
+	Base uint64 // Code of the module's first syscall
+
+	dispatcher *RisbeeSyscallDispatcher
+}
+
+// Register adds a handler under the given code and name,
+// replacing any handler previously registered there. Code
+// 0 is reserved for the built-in exit: a handler
+// registered under it is never called.
+func (dispatcher *RisbeeSyscallDispatcher) Register(
+	Code uint64,
+	Name string,
+	Handler RisbeeVmSyscallFn,
+) {
+	dispatcher.register(RisbeeSyscallInfo{Code: Code, Name: Name}, Handler)
+}
+
+// Registers a handler with complete metadata.
+func (dispatcher *RisbeeSyscallDispatcher) register(
+	info RisbeeSyscallInfo,
+	handler RisbeeVmSyscallFn,
+) {
+	if dispatcher.entries == nil {
+		dispatcher.entries = map[uint64]syscallEntry{}
+	}
+
+	dispatcher.entries[info.Code] = syscallEntry{
+		info:    info,
+		handler: handler,
+	}
+}
+
+// Module creates a namespace whose syscalls are numbered
+// from Base onward.
+func (dispatcher *RisbeeSyscallDispatcher) Module(
+	Name string,
+	Base uint64,
+) *RisbeeSyscallModule {
+	return &RisbeeSyscallModule{
+		Name:       Name,
+		Base:       Base,
+		dispatcher: dispatcher,
+	}
+}
+
+// Register adds a handler at code Base+Offset, which must
+// not be 0, the code of the built-in exit.
+func (module *RisbeeSyscallModule) Register(
+	Offset uint64,
+	Name string,
+	Handler RisbeeVmSyscallFn,
+) {
+	module.dispatcher.register(RisbeeSyscallInfo{
+		Code:   module.Base + Offset,
+		Name:   Name,
+		Module: module.Name,
+	}, Handler)
+}
+
+// Use appends middleware to the chain. The first
+// middleware added is the outermost one.
+func (dispatcher *RisbeeSyscallDispatcher) Use(
+	Middleware ...RisbeeSyscallMiddleware,
+) {
+	dispatcher.middleware = append(dispatcher.middleware, Middleware...)
+}
+
+// Lookup returns the metadata registered for a code.
+func (dispatcher *RisbeeSyscallDispatcher) Lookup(
+	Code uint64,
+) (RisbeeSyscallInfo, bool) {
+	entry, ok := dispatcher.entries[Code]
+	return entry.info, ok
+}
+
+// Dispatch runs the syscall identified by Code through the
+// middleware chain.
+//
+// Returns the value to be placed in a0.
+func (dispatcher *RisbeeSyscallDispatcher) Dispatch(
+	vm *RisbeeVm,
+	Code uint64,
+) uint64 {
+	entry, ok := dispatcher.entries[Code]
+	if Code == 0 {
+		entry = syscallEntry{
+			info:    RisbeeSyscallInfo{Code: 0, Name: "exit"},
+			handler: syscallExit,
+		}
+	} else if !ok {
+		entry.info = RisbeeSyscallInfo{Code: Code}
+
+		if fn, found := vm.SysCalls[Code]; found {
+			entry.handler = fn
+		} else if dispatcher.Fallback != nil {
+			entry.handler = func(vm *RisbeeVm) uint64 {
+				return dispatcher.Fallback(vm, Code)
+			}
+		} else if vm.Fallback != nil {
+			entry.handler = func(vm *RisbeeVm) uint64 {
+				return vm.Fallback(vm, Code)
+			}
+		} else {
+			entry.handler = func(vm *RisbeeVm) uint64 {
+				vm.panic("Invalid system call.")
+				return 0
+			}
+		}
+	}
+
+	handler := entry.handler
+	for index := len(dispatcher.middleware) - 1; index >= 0; index-- {
+		middleware := dispatcher.middleware[index]
+		next := handler
+
+		handler = func(vm *RisbeeVm) uint64 {
+			return middleware(vm, entry.info, next)
+		}
+	}
+
+	return handler(vm)
+}
+
+// SetSyscallDispatcher routes every syscall, the built-in
+// exit included, through the given dispatcher. Passing nil
+// restores plain SysCalls lookup.
+func (vm *RisbeeVm) SetSyscallDispatcher(
+	Dispatcher *RisbeeSyscallDispatcher,
+) {
+	vm.Dispatcher = Dispatcher
+}
+
+// SetSyscallDispatcher installs the dispatcher on every
+// hart of the machine.
+func (machine *RisbeeMachine) SetSyscallDispatcher(
+	Dispatcher *RisbeeSyscallDispatcher,
+) {
+	for _, hart := range machine.Harts {
+		hart.SetSyscallDispatcher(Dispatcher)
+	}
+}
+
+// SyscallLogger returns middleware writing one line per
+// syscall with its name, arguments a0–a5 and result.
+func SyscallLogger(Writer io.Writer) RisbeeSyscallMiddleware {
+	var lock sync.Mutex
+
+	return func(
+		vm *RisbeeVm,
+		Info RisbeeSyscallInfo,
+		Next RisbeeVmSyscallFn,
+	) uint64 {
+		var args [6]uint64
+		copy(args[:], vm.Registers[10:16])
+		result := Next(vm)
+
+		lock.Lock()
+		fmt.Fprintf(Writer,
+			"%s(0x%x, 0x%x, 0x%x, 0x%x, 0x%x, 0x%x) = 0x%x\n",
+			Info.FullName(),
+			args[0], args[1], args[2], args[3], args[4], args[5],
+			result,
+		)
+		lock.Unlock()
+
+		return result
+	}
+}
+
+// SyscallValidator returns middleware that calls Validate
+// before each syscall. A non-nil error skips the handler
+// and is reported to the guest through SyscallResult.
+func SyscallValidator(
+	Validate func(vm *RisbeeVm, Info RisbeeSyscallInfo) error,
+) RisbeeSyscallMiddleware {
+	return func(
+		vm *RisbeeVm,
+		Info RisbeeSyscallInfo,
+		Next RisbeeVmSyscallFn,
+	) uint64 {
+		if err := Validate(vm, Info); err != nil {
+			return SyscallResult(0, err)
+		}
+
+		return Next(vm)
+	}
+}
+
+// SyscallRateLimit returns middleware allowing at most
+// Limit syscalls per Interval, shared by every VM using
+// the dispatcher. Calls over the limit return -EAGAIN
+// without reaching the handler. The built-in exit is
+// neither limited nor counted, since a guest cannot retry
+// it.
+func SyscallRateLimit(
+	Limit uint64,
+	Interval time.Duration,
+) RisbeeSyscallMiddleware {
+	var lock sync.Mutex
+	var windowStart time.Time
+	var count uint64
+
+	return func(
+		vm *RisbeeVm,
+		Info RisbeeSyscallInfo,
+		Next RisbeeVmSyscallFn,
+	) uint64 {
+		if Info.Code == 0 {
+			return Next(vm)
+		}
+
+		lock.Lock()
+		now := time.Now()
+
+		if now.Sub(windowStart) >= Interval {
+			windowStart = now
+			count = 0
+		}
+
+		count++
+		allowed := count <= Limit
+		lock.Unlock()
+
+		if !allowed {
+			return SyscallResult(0, RISBEE_EAGAIN)
+		}
+
+		return Next(vm)
+	}
+}
+
+// SyscallFuel returns middleware charging Cost units from
+// the shared Fuel budget for every syscall, as returned by
+// Cost for the call. Once the budget is exhausted, the VM
+// panics with "Syscall fuel exhausted.".
+func SyscallFuel(
+	Fuel *uint64,
+	Cost func(Info RisbeeSyscallInfo) uint64,
+) RisbeeSyscallMiddleware {
+	var lock sync.Mutex
+
+	return func(
+		vm *RisbeeVm,
+		Info RisbeeSyscallInfo,
+		Next RisbeeVmSyscallFn,
+	) uint64 {
+		cost := Cost(Info)
+
+		lock.Lock()
+		exhausted := *Fuel < cost
+		if !exhausted {
+			*Fuel -= cost
+		}
+		lock.Unlock()
+
+		if exhausted {
+			vm.panic("Syscall fuel exhausted.")
+			return 0
+		}
+
+		return Next(vm)
+	}
+}
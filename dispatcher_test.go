@@ -0,0 +1,65 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/nthnn/risbee"
+	"github.com/nthnn/risbee/asm"
+)
+
+func TestDispatcherSeesExit(t *testing.T) {
+	code, err := asm.Assemble(`
+    li a0, 3
+    li a7, 1
+    ecall
+    li a7, 1
+    ecall
+    li a0, 5
+    li a7, 0
+    ecall
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var exitCode uint64
+	vm := &risbee.RisbeeVm{}
+	vm.Initialize(func(code uint64) {
+		exitCode = code
+	}, func(message string) {
+		t.Errorf("panic: %s", message)
+	})
+	vm.LoadFromBytes(code)
+
+	var log bytes.Buffer
+	dispatcher := &risbee.RisbeeSyscallDispatcher{}
+	dispatcher.Register(1, "double", func(vm *risbee.RisbeeVm) uint64 {
+		return vm.Registers[10] * 2
+	})
+	dispatcher.Use(
+		risbee.SyscallLogger(&log),
+		risbee.SyscallRateLimit(2, time.Hour),
+	)
+	vm.SetSyscallDispatcher(dispatcher)
+
+	vm.Run()
+
+	want := "double(0x3, 0x0, 0x0, 0x0, 0x0, 0x0) = 0x6\n" +
+		"double(0x6, 0x0, 0x0, 0x0, 0x0, 0x0) = 0xc\n" +
+		"exit(0x5, 0x0, 0x0, 0x0, 0x0, 0x0) = 0x5\n"
+	if log.String() != want {
+		t.Errorf("log:\n%s", log.String())
+	}
+
+	if exitCode != 5 || vm.ExitCode != 5 || vm.Running {
+		t.Errorf("exit code %d, %d, running %v", exitCode, vm.ExitCode, vm.Running)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RISBEE_ELF_STACK_SIZE is the stack space reserved above
+// the highest loaded segment of an ELF executable.
+const RISBEE_ELF_STACK_SIZE = 64 * 1024
+
+// RISBEE_ELF_MAX_IMAGE is the largest memory image, stack
+// included, LoadElf allocates unless the VM sets its own
+// MaxImageSize.
+const RISBEE_ELF_MAX_IMAGE = 1 << 30
+
+// RisbeeSymbol is a function or object symbol of the
+// loaded ELF executable.
+type RisbeeSymbol struct {
+	Name    string // Symbol name
+	Address uint64 // Start address
+	Size    uint64 // Size in bytes, zero if unknown
+}
+
+// IsElf reports whether Data starts with the ELF magic.
+func IsElf(Data []byte) bool {
+	return bytes.HasPrefix(Data, []byte(elf.ELFMAG))
+}
+
+// LoadElf loads a 64-bit little-endian RISC-V ELF
+// executable. Each PT_LOAD segment is copied to its
+// virtual address, memory is sized to fit the highest
+// segment plus RISBEE_ELF_STACK_SIZE bytes of stack, the
+// stack pointer is set to the top of memory and the
+// program counter to the entry point. Function and object
+// symbols, and the DWARF line table if present, are kept
+// for symbolic lookups.
+//
+// Malformed segments and images larger than MaxImageSize,
+// or RISBEE_ELF_MAX_IMAGE if it is zero, are rejected with
+// an error and leave the VM unchanged.
+func (vm *RisbeeVm) LoadElf(Data []byte) error {
+	file, err := elf.NewFile(bytes.NewReader(Data))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if file.Class != elf.ELFCLASS64 ||
+		file.Data != elf.ELFDATA2LSB ||
+		file.Machine != elf.EM_RISCV {
+		return errors.New("risbee: not a 64-bit little-endian RISC-V ELF")
+	}
+
+	limit := vm.MaxImageSize
+	if limit == 0 {
+		limit = RISBEE_ELF_MAX_IMAGE
+	}
+
+	var end uint64
+	for _, prog := range file.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+
+		if prog.Filesz > prog.Memsz {
+			return fmt.Errorf("risbee: segment at 0x%x has more file than memory bytes", prog.Vaddr)
+		}
+
+		// Checked one at a time so that the sum below can
+		// neither wrap around nor exceed the limit.
+		if prog.Vaddr > limit || prog.Memsz > limit-prog.Vaddr {
+			return fmt.Errorf("risbee: segment at 0x%x exceeds the %d byte image limit", prog.Vaddr, limit)
+		}
+
+		end = max(end, prog.Vaddr+prog.Memsz)
+	}
+
+	if end == 0 {
+		return errors.New("risbee: ELF has no loadable segments")
+	}
+
+	size := alignUp(end, 16) + RISBEE_ELF_STACK_SIZE
+	if size > limit {
+		return fmt.Errorf("risbee: ELF image of %d bytes exceeds the %d byte limit", size, limit)
+	}
+
+	memory := make([]byte, size)
+	for _, prog := range file.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+
+		segment := memory[prog.Vaddr : prog.Vaddr+prog.Filesz]
+		if _, err := prog.ReadAt(segment, 0); err != nil {
+			return fmt.Errorf("risbee: reading segment at 0x%x: %w", prog.Vaddr, err)
+		}
+	}
+
+	vm.setMemory(memory)
+	vm.Pc = file.Entry
+	vm.Registers[2] = uint64(len(memory))
+	vm.Symbols = ElfSymbols(file)
+	vm.Lines = elfLines(file)
+
+	return nil
+}
+
+// ElfSymbols collects the function and object symbols of
+// an ELF file, sorted by address, as LoadElf does.
+func ElfSymbols(file *elf.File) []RisbeeSymbol {
+	symbols, err := file.Symbols()
+	if err != nil {
+		return nil
+	}
+
+	var result []RisbeeSymbol
+	for _, symbol := range symbols {
+		kind := elf.ST_TYPE(symbol.Info)
+		if symbol.Name == "" || symbol.Name[0] == '$' ||
+			strings.HasPrefix(symbol.Name, ".L") ||
+			symbol.Section == elf.SHN_UNDEF ||
+			(kind != elf.STT_FUNC && kind != elf.STT_OBJECT &&
+				kind != elf.STT_NOTYPE) {
+			continue
+		}
+
+		result = append(result, RisbeeSymbol{
+			Name:    symbol.Name,
+			Address: symbol.Value,
+			Size:    symbol.Size,
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Address < result[j].Address
+	})
+
+	return result
+}
+
+// LookupSymbol returns the address of the named symbol.
+func (vm *RisbeeVm) LookupSymbol(Name string) (uint64, bool) {
+	for _, symbol := range vm.Symbols {
+		if symbol.Name == Name {
+			return symbol.Address, true
+		}
+	}
+
+	return 0, false
+}
+
+// SymbolAt returns the symbol containing Address, i.e.
+// the closest symbol at or below it whose size, if known,
+// covers the address.
+func (vm *RisbeeVm) SymbolAt(Address uint64) (RisbeeSymbol, bool) {
+	index := sort.Search(len(vm.Symbols), func(i int) bool {
+		return vm.Symbols[i].Address > Address
+	})
+
+	for index--; index >= 0; index-- {
+		symbol := vm.Symbols[index]
+		if symbol.Size == 0 || Address < symbol.Address+symbol.Size {
+			return symbol, true
+		}
+
+		// Prefer a sized symbol that covers the address over
+		// an unrelated one starting at the same place.
+		if index > 0 && vm.Symbols[index-1].Address == symbol.Address {
+			continue
+		}
+		break
+	}
+
+	return RisbeeSymbol{}, false
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"debug/elf"
+	"testing"
+)
+
+// Builds a RISC-V executable with one PT_LOAD segment
+// holding code, loaded at vaddr with memsz bytes of memory.
+func testElf(vaddr uint64, memsz uint64, code []byte) []byte {
+	const headerSize, progSize = 64, 56
+
+	data := make([]byte, headerSize+progSize, headerSize+progSize+len(code))
+	copy(data, elf.ELFMAG)
+	data[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	data[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	data[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	putUint16(data[16:], uint16(elf.ET_EXEC))
+	putUint16(data[18:], uint16(elf.EM_RISCV))
+	putUint32(data[20:], uint32(elf.EV_CURRENT))
+	putUint64(data[24:], vaddr)
+	putUint64(data[32:], headerSize)
+	putUint16(data[52:], headerSize)
+	putUint16(data[54:], progSize)
+	putUint16(data[56:], 1)
+
+	prog := data[headerSize:]
+	putUint32(prog[0:], uint32(elf.PT_LOAD))
+	putUint32(prog[4:], uint32(elf.PF_R|elf.PF_X))
+	putUint64(prog[8:], headerSize+progSize)
+	putUint64(prog[16:], vaddr)
+	putUint64(prog[24:], vaddr)
+	putUint64(prog[32:], uint64(len(code)))
+	putUint64(prog[40:], memsz)
+	putUint64(prog[48:], 4)
+
+	return append(data, code...)
+}
+
+func TestLoadElf(t *testing.T) {
+	vm := &RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(string) {})
+
+	code := []byte{0x13, 0x00, 0x00, 0x00}
+	if err := vm.LoadElf(testElf(0x1000, 0x100, code)); err != nil {
+		t.Fatal(err)
+	}
+
+	if vm.Pc != 0x1000 || uint64(len(vm.Memory)) != 0x1100+RISBEE_ELF_STACK_SIZE {
+		t.Fatalf("pc 0x%x, memory 0x%x", vm.Pc, len(vm.Memory))
+	}
+}
+
+func TestLoadElfMalformed(t *testing.T) {
+	code := make([]byte, 16)
+	cases := map[string][]byte{
+		"file larger than memory": testElf(0x1000, 8, code),
+		"address wraps around":    testElf(1<<64-8, 16, code),
+		"image too large":         testElf(0x1000, RISBEE_ELF_MAX_IMAGE, code),
+	}
+
+	for name, data := range cases {
+		vm := &RisbeeVm{}
+		vm.Initialize(func(uint64) {}, func(string) {})
+
+		if err := vm.LoadElf(data); err == nil {
+			t.Errorf("%s: loaded", name)
+		}
+
+		if vm.Memory != nil {
+			t.Errorf("%s: memory replaced", name)
+		}
+	}
+
+	vm := &RisbeeVm{MaxImageSize: 0x8000}
+	if err := vm.LoadElf(testElf(0x1000, 0x100, code)); err == nil {
+		t.Error("image over MaxImageSize loaded")
+	}
+}
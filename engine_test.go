@@ -0,0 +1,292 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/nthnn/risbee"
+	"github.com/nthnn/risbee/asm"
+)
+
+// Engines every program must run identically under; the
+// first one is the reference.
+var testEngines = []int{
+	risbee.RISBEE_ENGINE_SWITCH,
+	risbee.RISBEE_ENGINE_DECODE,
+	risbee.RISBEE_ENGINE_BLOCKS,
+}
+
+// Patches the instruction at "patched" on every iteration,
+// alternating between two versions of it.
+const selfModifyingSource = `
+    li a0, 0
+    li t0, %d
+    la t1, patched
+    la t4, variants
+again:
+    andi t2, t0, 1
+    slli t2, t2, 2
+    add t2, t2, t4
+    lw t3, 0(t2)
+    sw t3, 0(t1)
+patched:
+    addi a0, a0, 1
+    addi t0, t0, -1
+    bnez t0, again
+    li a7, 0
+    ecall
+variants:
+    addi a0, a0, 1
+    addi a0, a0, 100
+`
+
+// Runs code to completion under engine.
+func runEngine(t testing.TB, code []byte, engine int) *risbee.RisbeeVm {
+	vm := &risbee.RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(message string) {
+		t.Errorf("engine %d: panic: %s", engine, message)
+	})
+
+	vm.LoadFromBytes(code)
+	vm.Engine = engine
+	vm.Run()
+
+	return vm
+}
+
+// Runs source under every engine and compares registers,
+// program counter, instruction count, exit code and memory
+// with the reference engine.
+func compareEngines(t *testing.T, name string, source string, engines []int) {
+	code, err := asm.Assemble(source)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	want := runEngine(t, code, engines[0])
+	for _, engine := range engines[1:] {
+		got := runEngine(t, code, engine)
+
+		switch {
+		case got.Registers != want.Registers:
+			for index := range got.Registers {
+				if got.Registers[index] != want.Registers[index] {
+					t.Errorf("%s: engine %d: x%d = 0x%x, want 0x%x", name, engine,
+						index, got.Registers[index], want.Registers[index])
+				}
+			}
+
+		case got.Pc != want.Pc:
+			t.Errorf("%s: engine %d: pc 0x%x, want 0x%x", name, engine, got.Pc, want.Pc)
+
+		case got.Instret != want.Instret:
+			t.Errorf("%s: engine %d: instret %d, want %d", name, engine, got.Instret, want.Instret)
+
+		case got.ExitCode != want.ExitCode:
+			t.Errorf("%s: engine %d: exit code %d, want %d", name, engine, got.ExitCode, want.ExitCode)
+
+		case !bytes.Equal(got.Memory, want.Memory):
+			t.Errorf("%s: engine %d: memory differs", name, engine)
+		}
+	}
+}
+
+// Generates a program looping iterations times over random
+// RV64IM instructions, with loads and stores into a data
+// area at s11 and forward branches and jumps within the
+// loop body. s10 counts the iterations.
+func randomProgram(random *rand.Rand, length int, iterations int) string {
+	var names []string
+	for _, name := range risbee.RisbeeRegisterNames {
+		if name != "s10" && name != "s11" {
+			names = append(names, name)
+		}
+	}
+
+	register := func() string {
+		return names[random.IntN(len(names))]
+	}
+
+	pick := func(options ...string) string {
+		return options[random.IntN(len(options))]
+	}
+
+	body := make([]string, length)
+	labels := make([][]string, length+1)
+
+	for index := range body {
+		target := func() string {
+			label := fmt.Sprintf("l%d", index)
+			to := index + 1 + random.IntN(min(4, length-index))
+			labels[to] = append(labels[to], label)
+
+			return label
+		}
+
+		switch kind := random.IntN(10); kind {
+		case 0, 1:
+			body[index] = fmt.Sprintf("%s %s, %s, %s", pick(
+				"add", "sub", "sll", "slt", "sltu", "xor", "srl", "sra", "or", "and",
+				"mul", "mulh", "mulhsu", "mulhu", "div", "divu", "rem", "remu",
+				"addw", "subw", "sllw", "srlw", "sraw", "mulw", "divw", "divuw", "remw", "remuw",
+			), register(), register(), register())
+
+		case 2:
+			body[index] = fmt.Sprintf("%s %s, %s, %d", pick(
+				"addi", "slti", "sltiu", "xori", "ori", "andi", "addiw",
+			), register(), register(), random.IntN(4096)-2048)
+
+		case 3:
+			op, limit := pick("slli", "srli", "srai", "slliw", "srliw", "sraiw"), 64
+			if strings.HasSuffix(op, "w") {
+				limit = 32
+			}
+
+			body[index] = fmt.Sprintf("%s %s, %s, %d", op, register(), register(), random.IntN(limit))
+
+		case 4:
+			body[index] = fmt.Sprintf("%s %s, 0x%x", pick("lui", "auipc"), register(), random.IntN(1<<20))
+
+		case 5:
+			body[index] = fmt.Sprintf("%s %s, %d(s11)", pick(
+				"lb", "lh", "lw", "ld", "lbu", "lhu", "lwu",
+			), register(), random.IntN(2040))
+
+		case 6:
+			body[index] = fmt.Sprintf("%s %s, %d(s11)", pick(
+				"sb", "sh", "sw", "sd",
+			), register(), random.IntN(2040))
+
+		case 7, 8:
+			body[index] = fmt.Sprintf("%s %s, %s, %s", pick(
+				"beq", "bne", "blt", "bge", "bltu", "bgeu",
+			), register(), register(), target())
+
+		default:
+			if random.IntN(2) == 0 {
+				body[index] = fmt.Sprintf("jal %s, %s", register(), target())
+			} else {
+				base := register()
+				for base == "zero" {
+					base = register()
+				}
+
+				body[index] = fmt.Sprintf("la %s, %s; jalr %s, 0(%s)", base, target(), register(), base)
+			}
+		}
+	}
+
+	var source strings.Builder
+	fmt.Fprintf(&source, "    la s11, data\n    li s10, %d\nloop:\n", iterations)
+
+	for index, line := range body {
+		for _, label := range labels[index] {
+			fmt.Fprintf(&source, "%s:\n", label)
+		}
+
+		fmt.Fprintf(&source, "    %s\n", line)
+	}
+
+	for _, label := range labels[length] {
+		fmt.Fprintf(&source, "%s:\n", label)
+	}
+
+	source.WriteString(`    addi s10, s10, -1
+    bnez s10, loop
+    li a0, 0
+    li a7, 0
+    ecall
+    .align 3
+data:
+    .zero 2048
+`)
+
+	return source.String()
+}
+
+func TestEngineEquivalence(t *testing.T) {
+	code, err := asm.Assemble(fmt.Sprintf(selfModifyingSource, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, engine := range testEngines {
+		if vm := runEngine(t, code, engine); vm.ExitCode != 500*1+500*100 {
+			t.Errorf("self-modifying: engine %d: exit code %d", engine, vm.ExitCode)
+		}
+	}
+
+	compareEngines(t, "self-modifying", fmt.Sprintf(selfModifyingSource, 1000), testEngines)
+
+	random := rand.New(rand.NewPCG(1, 2))
+	for index := range 300 {
+		source := randomProgram(random, 8+random.IntN(40), 1+random.IntN(20))
+		compareEngines(t, fmt.Sprintf("random program %d", index), source, testEngines)
+
+		if t.Failed() {
+			t.Logf("program:\n%s", source)
+			break
+		}
+	}
+}
+
+// A loop of ALU instructions and a load and store, the
+// pattern the block and JIT engines are made for.
+const hotLoopSource = `
+    la s11, data
+    li t0, %d
+    li t1, 0
+loop:
+    addi t1, t1, 3
+    xor t2, t1, t0
+    add t3, t3, t2
+    slli t4, t3, 3
+    sltu t5, t4, t3
+    sd t3, 0(s11)
+    ld t6, 0(s11)
+    addi t0, t0, -1
+    bnez t0, loop
+    li a0, 0
+    li a7, 0
+    ecall
+    .align 3
+data:
+    .dword 0
+`
+
+// Runs the hot loop under engine, reporting the time per
+// guest instruction.
+func benchmarkEngine(b *testing.B, engine int) {
+	code, err := asm.Assemble(fmt.Sprintf(hotLoopSource, 100000))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var instructions uint64
+	for b.Loop() {
+		instructions += runEngine(b, code, engine).Instret
+	}
+
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(instructions), "ns/inst")
+}
+
+func BenchmarkSwitch(b *testing.B) {
+	benchmarkEngine(b, risbee.RISBEE_ENGINE_SWITCH)
+}
+
+func BenchmarkDecode(b *testing.B) {
+	benchmarkEngine(b, risbee.RISBEE_ENGINE_DECODE)
+}
+
+func BenchmarkBlocks(b *testing.B) {
+	benchmarkEngine(b, risbee.RISBEE_ENGINE_BLOCKS)
+}
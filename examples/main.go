@@ -15,7 +15,18 @@
 //
 // Usage:
 //
-//	go run main.go <riscv-binary>
+//	go run main.go [-gdb address | -monitor] [-record] [-profile file] [-coverage file] <riscv-binary>
+//
+// With -gdb, the program is not run right away; instead a GDB
+// remote stub waits for a debugger on the given address, either
+// a TCP address such as localhost:1234 or unix:<path> for a Unix
+// socket. With -monitor, an interactive monitor on the terminal
+// controls the program instead (type help for its commands).
+// With -record, execution is recorded so that both can step
+// and continue backwards. With -profile, a pprof profile of
+// the guest is written to the given file when it finishes,
+// and with -coverage, a line coverage report: Cobertura XML
+// if the file name ends in .xml, lcov otherwise.
 //
 // Breakdown:
 //  1. Argument Check: Ensures a filename argument is passed;
@@ -34,8 +45,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/nthnn/risbee"
 )
@@ -50,21 +63,70 @@ func readFile(fileName string) ([]byte, error) {
 	return data, nil
 }
 
+// writeCoverage writes a coverage report in the format
+// implied by the file name.
+func writeCoverage(
+	vm *risbee.RisbeeVm,
+	coverage *risbee.RisbeeCoverage,
+	path string,
+) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.HasSuffix(path, ".xml") {
+		return coverage.WriteCobertura(vm, file)
+	}
+
+	return coverage.WriteLcov(vm, file)
+}
+
 func main() {
+	gdbAddress := flag.String("gdb", "", "wait for GDB on this address")
+	monitor := flag.Bool("monitor", false, "start the interactive monitor")
+	record := flag.Bool("record", false, "record execution for reverse debugging")
+	profile := flag.String("profile", "", "write a pprof profile of the guest to this file")
+	coverage := flag.String("coverage", "", "write an lcov or Cobertura (.xml) coverage report")
+	flag.Parse()
+
 	// Ensure a filename is provided as an argument.
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: risbee <filename>")
+	if flag.NArg() < 1 {
+		fmt.Println("Usage: risbee [-gdb address | -monitor] [-record] [-profile file] [-coverage file] <filename>")
 		os.Exit(1)
 	}
 
 	// Create and initialize the VM.
 	vm := &risbee.RisbeeVm{}
 
+	// Write the profile and coverage report, if any,
+	// once the guest is done.
+	profiler := &risbee.RisbeeProfiler{}
+	collector := &risbee.RisbeeCoverage{}
+
+	saveReports := func() {
+		if *profile != "" {
+			if err := profiler.SaveProfile(vm, *profile); err != nil {
+				fmt.Printf("Error: %v\r\n", err)
+			}
+		}
+
+		if *coverage != "" {
+			if err := writeCoverage(vm, collector, *coverage); err != nil {
+				fmt.Printf("Error: %v\r\n", err)
+			}
+		}
+	}
+
 	// Set up the VM with exit and panic handlers.
 	vm.Initialize(func(exitCode uint64) {
+		saveReports()
 		os.Exit(int(exitCode))
 	}, func(message string) {
-		fmt.Printf("\r\n%s\r\n", message)
+		// Print the fault with its symbolized backtrace.
+		report := vm.Fault.Report()
+		fmt.Printf("\r\n%s", strings.ReplaceAll(report, "\n", "\r\n"))
 	})
 
 	// Register a simple "print" syscall at code 1.
@@ -78,18 +140,70 @@ func main() {
 	})
 
 	// Load the binary file.
-	binary, err := readFile(os.Args[1])
+	binary, err := readFile(flag.Arg(0))
 	if err != nil {
 		fmt.Printf("Error: %v\r\n", err)
 		os.Exit(-1)
 	}
 
-	// Load the RISC-V binary into VM memory; exit on failure.
-	if !vm.LoadFromBytes(binary) {
-		fmt.Println("Failed to load file:", os.Args[1])
+	// ELF executables are loaded at their linked addresses
+	// with symbols; anything else is treated as a raw image.
+	if risbee.IsElf(binary) {
+		if err := vm.LoadElf(binary); err != nil {
+			fmt.Printf("Error: %v\r\n", err)
+			os.Exit(1)
+		}
+	} else if !vm.LoadFromBytes(binary) {
+		// Load the RISC-V binary into VM memory; exit on failure.
+		fmt.Println("Failed to load file:", flag.Arg(0))
 		os.Exit(1)
 	}
 
+	// Keep the last million instructions for reverse debugging.
+	if *record {
+		vm.SetRecorder(&risbee.RisbeeRecorder{MaxSteps: 1 << 20})
+	}
+
+	// Count every guest instruction when profiling.
+	if *profile != "" {
+		vm.SetProfiler(profiler)
+	}
+
+	if *coverage != "" {
+		vm.SetCoverage(collector)
+	}
+
+	// Hand control to GDB if requested.
+	if *gdbAddress != "" {
+		network, address := "tcp", *gdbAddress
+		if path, ok := strings.CutPrefix(address, "unix:"); ok {
+			network, address = "unix", path
+		}
+
+		if err := vm.ServeGdb(network, address); err != nil {
+			fmt.Printf("Error: %v\r\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	// Let the user drive the program from the terminal.
+	if *monitor {
+		(&risbee.RisbeeMonitor{
+			Vm:     vm,
+			Input:  os.Stdin,
+			Output: os.Stdout,
+		}).Run()
+
+		return
+	}
+
 	// Execute the loaded program.
 	vm.Run()
+	saveReports()
+
+	if vm.Fault != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,233 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// RisbeeRegisterChange is a register written by a traced
+// instruction.
+type RisbeeRegisterChange struct {
+	Register uint64 `json:"reg"` // Register index, 1–31
+	Value    uint64 `json:"value"`
+}
+
+// RisbeeMemoryChange is a store performed by a traced
+// instruction.
+type RisbeeMemoryChange struct {
+	Address uint64 `json:"addr"`
+	Size    uint64 `json:"size"` // 1, 2, 4 or 8 bytes
+	Value   uint64 `json:"value"`
+}
+
+// RisbeeTraceEntry describes one executed instruction.
+type RisbeeTraceEntry struct {
+	Instret     uint64                 `json:"instret"`       // Instructions executed before it
+	Pc          uint64                 `json:"pc"`            // Address of the instruction
+	Instruction uint32                 `json:"inst"`          // Raw instruction word
+	Disassembly string                 `json:"asm,omitempty"` // Text from Disassemble, if set
+	Registers   []RisbeeRegisterChange `json:"regs,omitempty"`
+	Memory      []RisbeeMemoryChange   `json:"mem,omitempty"`
+}
+
+// RisbeeExecTracer records the instructions a VM executes,
+// with the registers and memory each one changed.
+//
+// Only instructions with StartPc <= PC < EndPc are traced
+// when EndPc is non-zero. With RingSize set, entries are
+// kept in a ring buffer of that many instructions instead
+// of being written out, and the buffer is dumped to Writer
+// when the VM faults, or on demand with Dump. Entries use
+// the same formats as RisbeeSyscallTracer. Unlike a
+// syscall tracer, an exec tracer belongs to a single VM.
+type RisbeeExecTracer struct {
+	Writer      io.Writer                           // Destination of the trace
+	Format      int                                 // RISBEE_TRACE_TEXT or RISBEE_TRACE_JSON
+	StartPc     uint64                              // First traced address
+	EndPc       uint64                              // End of traced range, 0 for all
+	RingSize    int                                 // Keep only the last N entries
+	Disassemble func(Inst uint32, Pc uint64) string // Optional disassembler, e.g. Disassemble
+	Callback    func(RisbeeTraceEntry)              // Called for every entry
+
+	ring    []RisbeeTraceEntry
+	next    int
+	current *RisbeeTraceEntry
+	faulted bool
+	lock    sync.Mutex
+}
+
+// SetExecTracer enables instruction tracing on the VM.
+// Passing nil disables it.
+func (vm *RisbeeVm) SetExecTracer(Tracer *RisbeeExecTracer) {
+	vm.ExecTracer = Tracer
+}
+
+// Checks whether an address lies in the traced range.
+func (tracer *RisbeeExecTracer) inRange(pc uint64) bool {
+	return tracer.EndPc == 0 ||
+		(pc >= tracer.StartPc && pc < tracer.EndPc)
+}
+
+// Executes one instruction of vm and records it.
+func (tracer *RisbeeExecTracer) step(vm *RisbeeVm) {
+	if !tracer.inRange(vm.Pc) {
+		if inst, ok := vm.fetch(); ok {
+			vm.execute(inst)
+		}
+
+		return
+	}
+
+	entry := RisbeeTraceEntry{
+		Instret: vm.Instret,
+		Pc:      vm.Pc,
+	}
+	before := vm.Registers
+
+	tracer.current = &entry
+	inst, ok := vm.fetch()
+	if ok {
+		entry.Instruction = inst
+		vm.execute(inst)
+	}
+	tracer.current = nil
+
+	for index := 1; index < len(vm.Registers); index++ {
+		if vm.Registers[index] != before[index] {
+			entry.Registers = append(entry.Registers, RisbeeRegisterChange{
+				Register: uint64(index),
+				Value:    vm.Registers[index],
+			})
+		}
+	}
+
+	if tracer.Disassemble != nil {
+		entry.Disassembly = tracer.Disassemble(entry.Instruction, entry.Pc)
+	}
+
+	tracer.record(entry)
+	if tracer.faulted {
+		tracer.faulted = false
+		tracer.Dump()
+	}
+}
+
+// Notes a store made by the instruction being traced, once
+// it has succeeded, with val truncated to size bytes.
+func (tracer *RisbeeExecTracer) recordStore(
+	addr uint64,
+	size uint64,
+	val uint64,
+) {
+	if tracer.current != nil {
+		tracer.current.Memory = append(tracer.current.Memory, RisbeeMemoryChange{
+			Address: addr,
+			Size:    size,
+			Value:   val,
+		})
+	}
+}
+
+// Marks the instruction being traced as faulting, so that
+// the ring buffer is dumped once it has been recorded.
+func (tracer *RisbeeExecTracer) fault() {
+	if tracer.current != nil && tracer.RingSize > 0 {
+		tracer.faulted = true
+	}
+}
+
+// Stores an entry in the ring buffer or writes it out.
+func (tracer *RisbeeExecTracer) record(entry RisbeeTraceEntry) {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+
+	if tracer.Callback != nil {
+		tracer.Callback(entry)
+	}
+
+	if tracer.RingSize <= 0 {
+		tracer.write(entry)
+		return
+	}
+
+	if len(tracer.ring) < tracer.RingSize {
+		tracer.ring = append(tracer.ring, entry)
+		return
+	}
+
+	tracer.ring[tracer.next] = entry
+	tracer.next = (tracer.next + 1) % tracer.RingSize
+}
+
+// Entries returns the contents of the ring buffer, oldest
+// first.
+func (tracer *RisbeeExecTracer) Entries() []RisbeeTraceEntry {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+
+	entries := make([]RisbeeTraceEntry, 0, len(tracer.ring))
+	entries = append(entries, tracer.ring[tracer.next:]...)
+	return append(entries, tracer.ring[:tracer.next]...)
+}
+
+// Dump writes the ring buffer to Writer, oldest entry
+// first, and empties it.
+func (tracer *RisbeeExecTracer) Dump() {
+	entries := tracer.Entries()
+
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+
+	for _, entry := range entries {
+		tracer.write(entry)
+	}
+
+	tracer.ring = tracer.ring[:0]
+	tracer.next = 0
+}
+
+// Writes an entry in the configured format.
+func (tracer *RisbeeExecTracer) write(entry RisbeeTraceEntry) {
+	if tracer.Writer == nil {
+		return
+	}
+
+	if tracer.Format == RISBEE_TRACE_JSON {
+		line, _ := json.Marshal(entry)
+		tracer.Writer.Write(append(line, '\n'))
+		return
+	}
+
+	io.WriteString(tracer.Writer, entry.String()+"\n")
+}
+
+// String formats the entry as a single line: instruction
+// count, PC, raw instruction, disassembly, then every
+// changed register and stored memory location.
+func (entry RisbeeTraceEntry) String() string {
+	var line strings.Builder
+	fmt.Fprintf(&line, "[%8d] 0x%08x: %08x", entry.Instret, entry.Pc, entry.Instruction)
+
+	if entry.Disassembly != "" {
+		fmt.Fprintf(&line, "  %-24s", entry.Disassembly)
+	}
+
+	for _, change := range entry.Registers {
+		fmt.Fprintf(&line, " %s=0x%x", RisbeeRegisterNames[change.Register], change.Value)
+	}
+
+	for _, change := range entry.Memory {
+		fmt.Fprintf(&line, " [0x%x]%d=0x%x", change.Address, change.Size, change.Value)
+	}
+
+	return strings.TrimRight(line.String(), " ")
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/nthnn/risbee"
+	"github.com/nthnn/risbee/asm"
+)
+
+// Stores are traced with only the bytes written, and a
+// store that faults leaves no memory change behind.
+func TestExecTracerStores(t *testing.T) {
+	code, err := asm.Assemble(`
+    li t0, 0x3000
+    li t1, 0x12345
+    sb t1, 0(t0)
+    sh t1, 2(t0)
+    li t0, 0x2000
+    sd t1, 0(t0)
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := &risbee.RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(string) {})
+	vm.LoadFromBytes(code)
+	vm.Memory = append(vm.Memory, make([]byte, 0x3000)...)
+	vm.ProtectMemory(0x2000, 0x1000, risbee.RISBEE_MEM_READ)
+
+	var stores []risbee.RisbeeMemoryChange
+	vm.SetExecTracer(&risbee.RisbeeExecTracer{
+		Writer: io.Discard,
+		Callback: func(entry risbee.RisbeeTraceEntry) {
+			stores = append(stores, entry.Memory...)
+		},
+	})
+
+	vm.Run()
+
+	want := []risbee.RisbeeMemoryChange{
+		{Address: 0x3000, Size: 1, Value: 0x45},
+		{Address: 0x3002, Size: 2, Value: 0x2345},
+	}
+
+	if !reflect.DeepEqual(stores, want) {
+		t.Fatalf("stores %+v", stores)
+	}
+
+	if vm.Fault == nil {
+		t.Fatal("store to read-only memory did not fault")
+	}
+}
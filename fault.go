@@ -0,0 +1,201 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RISBEE_BACKTRACE_DEPTH is the maximum number of frames
+// of a backtrace.
+const RISBEE_BACKTRACE_DEPTH = 64
+
+// RisbeeFrame is a symbolized frame of the guest stack.
+// Function and File are empty when the loaded program has
+// no symbols or debug information for the address.
+type RisbeeFrame struct {
+	Pc       uint64 // Instruction address
+	Function string // Enclosing symbol
+	Offset   uint64 // Distance from the start of Function
+	File     string // Source file from the DWARF line table
+	Line     int    // Source line, 0 if unknown
+}
+
+// RisbeeFault describes why the VM panicked. It is stored
+// in the Fault field of the VM and implements error; Report
+// formats it with the backtrace.
+type RisbeeFault struct {
+	Message     string        // Message passed to PanicCallback
+	Pc          uint64        // Address of the faulting instruction
+	Instruction uint32        // Faulting instruction word, if readable
+	Instret     uint64        // Instructions executed before it
+	Backtrace   []RisbeeFrame // Guest call stack, innermost first
+}
+
+// Error returns the message with the faulting location.
+func (fault *RisbeeFault) Error() string {
+	if len(fault.Backtrace) == 0 {
+		return fmt.Sprintf("%s (pc 0x%x)", fault.Message, fault.Pc)
+	}
+
+	return fmt.Sprintf("%s (pc %s)", fault.Message, fault.Backtrace[0])
+}
+
+// Report formats the fault and its backtrace over
+// several lines, like:
+//
+//	Invalid load instruction.
+//	  pc 0x10234 inst 0x00053503, after 1200 instructions
+//	  #0 0x10234 in parse+0x14 at parser.c:42
+//	  #1 0x101f0 in main+0x30 at main.c:17
+func (fault *RisbeeFault) Report() string {
+	var report strings.Builder
+
+	fmt.Fprintf(&report, "%s\n  pc 0x%x inst 0x%08x, after %d instructions\n",
+		fault.Message, fault.Pc, fault.Instruction, fault.Instret)
+
+	for index, frame := range fault.Backtrace {
+		fmt.Fprintf(&report, "  #%d %s\n", index, frame)
+	}
+
+	return report.String()
+}
+
+// String formats the frame as its address followed by
+// whatever symbol and source line are known.
+func (frame RisbeeFrame) String() string {
+	text := fmt.Sprintf("0x%x", frame.Pc)
+	if frame.Function != "" {
+		text += fmt.Sprintf(" in %s+0x%x", frame.Function, frame.Offset)
+	}
+
+	if frame.File != "" {
+		text += fmt.Sprintf(" at %s:%d", frame.File, frame.Line)
+	}
+
+	return text
+}
+
+// Backtrace unwinds the guest stack from the current
+// program counter through the frame pointer chain and
+// symbolizes each frame with the ELF symbols and DWARF
+// line table of the loaded program.
+func (vm *RisbeeVm) Backtrace() []RisbeeFrame {
+	stack := vm.callStack(nil, RISBEE_BACKTRACE_DEPTH)
+	frames := make([]RisbeeFrame, len(stack))
+
+	for index, pc := range stack {
+		frames[index] = vm.Symbolize(pc)
+	}
+
+	return frames
+}
+
+// Symbolize returns the frame describing an instruction
+// address.
+func (vm *RisbeeVm) Symbolize(Pc uint64) RisbeeFrame {
+	frame := RisbeeFrame{Pc: Pc}
+
+	if symbol, ok := vm.SymbolAt(Pc); ok {
+		frame.Function = symbol.Name
+		frame.Offset = Pc - symbol.Address
+	}
+
+	if line, ok := vm.LineAt(Pc); ok {
+		frame.File = line.File
+		frame.Line = line.Line
+	}
+
+	return frame
+}
+
+// Walks the frame pointer chain of the guest. With the
+// standard RISC-V frame layout, s0 points just above the
+// frame, the return address is saved at s0-8 and the
+// caller's s0 at s0-16. Leaf functions built by GCC save
+// only s0, at s0-8, and keep the return address in ra, so
+// the innermost frame falls back to ra when s0-8 does not
+// hold a return address.
+//
+// Returns stack with up to depth program counters appended,
+// innermost first. Return addresses are moved back to the
+// calling instruction.
+func (vm *RisbeeVm) callStack(stack []uint64, depth int) []uint64 {
+	stack = append(stack, vm.Pc)
+	fp := vm.Registers[8]
+
+	for frame := 1; frame < depth; frame++ {
+		var ra, next uint64
+		if fp >= 16 && vm.inMemory(fp-16, 16) {
+			ra = uint64LittleEndian(vm.Memory[fp-8:])
+			next = uint64LittleEndian(vm.Memory[fp-16:])
+		}
+
+		if !vm.isReturnAddress(ra) {
+			if frame != 1 || !vm.isReturnAddress(vm.Registers[1]) {
+				break
+			}
+
+			ra, next = vm.Registers[1], 0
+			if fp >= 8 && vm.inMemory(fp-8, 8) {
+				next = uint64LittleEndian(vm.Memory[fp-8:])
+			}
+		}
+
+		stack = append(stack, ra-4)
+		if next <= fp {
+			break
+		}
+
+		fp = next
+	}
+
+	return stack
+}
+
+// Checks whether addr can be a return address: it must
+// follow a JAL or JALR linking a register, within a symbol
+// or the line table if the program has either.
+func (vm *RisbeeVm) isReturnAddress(addr uint64) bool {
+	if addr < 4 || addr%4 != 0 || !vm.inMemory(addr-4, 4) {
+		return false
+	}
+
+	inst := uint32LittleEndian(vm.Memory[addr-4:])
+	if opcode := inst & 0x7F; (opcode != RISBEE_OPINST_JAL &&
+		opcode != RISBEE_OPINST_JALR) || (inst>>7)&0x1F == 0 {
+		return false
+	}
+
+	if len(vm.Symbols) == 0 && len(vm.Lines) == 0 {
+		return true
+	}
+
+	if _, ok := vm.SymbolAt(addr - 4); ok {
+		return true
+	}
+
+	_, ok := vm.LineAt(addr - 4)
+	return ok
+}
+
+// Captures the state of the VM as a fault.
+func (vm *RisbeeVm) newFault(message string) *RisbeeFault {
+	fault := &RisbeeFault{
+		Message:   message,
+		Pc:        vm.Pc,
+		Instret:   vm.Instret,
+		Backtrace: vm.Backtrace(),
+	}
+
+	if vm.inMemory(vm.Pc, 4) {
+		fault.Instruction = uint32LittleEndian(vm.Memory[vm.Pc:])
+	}
+
+	return fault
+}
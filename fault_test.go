@@ -0,0 +1,76 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nthnn/risbee"
+	"github.com/nthnn/risbee/asm"
+)
+
+// A fault in a leaf function that saves only s0, as GCC
+// builds them, unwinds through ra into its callers.
+func TestBacktraceLeafFunction(t *testing.T) {
+	program, err := asm.AssembleAt(`
+    li sp, 0x3000
+    li s0, 0
+    call outer
+after_outer:
+    li a7, 0
+    ecall
+
+outer:
+    addi sp, sp, -16
+    sd ra, 8(sp)
+    sd s0, 0(sp)
+    addi s0, sp, 16
+    call leaf
+after_leaf:
+    ld ra, 8(sp)
+    ld s0, 0(sp)
+    addi sp, sp, 16
+    ret
+
+leaf:
+    addi sp, sp, -16
+    sd s0, 8(sp)
+    addi s0, sp, 16
+    li t0, -8
+fault:
+    ld a0, 0(t0)
+`, asm.DefaultBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := &risbee.RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(string) {})
+	vm.LoadFromBytes(program.Code)
+	vm.Memory = append(vm.Memory, make([]byte, 0x3000)...)
+
+	vm.Run()
+	if vm.Fault == nil {
+		t.Fatal("no fault")
+	}
+
+	var got []uint64
+	for _, frame := range vm.Fault.Backtrace {
+		got = append(got, frame.Pc)
+	}
+
+	want := []uint64{
+		program.Symbols["fault"],
+		program.Symbols["after_leaf"] - 4,
+		program.Symbols["after_outer"] - 4,
+	}
+
+	if !slices.Equal(got, want) {
+		t.Fatalf("backtrace %x, want %x", got, want)
+	}
+}
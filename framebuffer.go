@@ -0,0 +1,288 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"sync"
+)
+
+// Pixel formats supported by the framebuffer device.
+const (
+	RISBEE_FB_FORMAT_RGB565   = 0 // 16-bit 5:6:5 RGB
+	RISBEE_FB_FORMAT_RGB888   = 1 // 24-bit packed RGB, red first
+	RISBEE_FB_FORMAT_XRGB8888 = 2 // 32-bit little-endian 0xXXRRGGBB
+	RISBEE_FB_FORMAT_RGBA8888 = 3 // 32-bit bytes R, G, B, A
+)
+
+// Register offsets of the framebuffer device. The pixel data
+// starts at RISBEE_FB_PIXELS, right after the register page.
+const (
+	RISBEE_FB_WIDTH  = 0x000  // Width in pixels, read-only
+	RISBEE_FB_HEIGHT = 0x004  // Height in pixels, read-only
+	RISBEE_FB_STRIDE = 0x008  // Bytes per row, read-only
+	RISBEE_FB_FORMAT = 0x00C  // Pixel format, read-only
+	RISBEE_FB_FRAME  = 0x010  // Frame counter, written by the guest when a frame is complete
+	RISBEE_FB_PIXELS = 0x1000 // Offset of the pixel data
+)
+
+// RISBEE_FB_MAX_SIZE is the largest pixel buffer, in
+// bytes, that Initialize accepts.
+const RISBEE_FB_MAX_SIZE = 1 << 30
+
+// RisbeeFramebuffer is a memory-mapped linear framebuffer.
+// The guest discovers its geometry through the register page
+// and draws by storing pixels at RISBEE_FB_PIXELS onward. The
+// host can grab the current frame as an image.Image or save
+// it as PNG, which makes guest rendering verifiable in
+// headless tests.
+type RisbeeFramebuffer struct {
+	Width         uint32       // Width in pixels
+	Height        uint32       // Height in pixels
+	Format        uint32       // Pixel format (RISBEE_FB_FORMAT_*)
+	Pixels        []byte       // Raw pixel data, Stride bytes per row
+	FrameCallback func(uint64) // Optional callback on frame counter writes
+
+	frame uint64       // Last frame number reported by the guest
+	lock  sync.RWMutex // Guards pixels against concurrent capture
+}
+
+// This function sets the resolution and pixel format
+// of the framebuffer and clears its pixel data.
+//
+// Parameters:
+// - width The width in pixels.
+// - height The height in pixels.
+// - format One of the RISBEE_FB_FORMAT_* constants.
+//
+// Returns an error if the pixel format is unknown or the
+// pixel data would exceed RISBEE_FB_MAX_SIZE bytes.
+func (fb *RisbeeFramebuffer) Initialize(
+	width uint32,
+	height uint32,
+	format uint32,
+) error {
+	if format > RISBEE_FB_FORMAT_RGBA8888 {
+		return errors.New("risbee: unknown framebuffer pixel format")
+	}
+
+	stride := uint64(width) * uint64(formatBytes(format))
+	if stride > RISBEE_FB_MAX_SIZE || stride*uint64(height) > RISBEE_FB_MAX_SIZE {
+		return errors.New("risbee: framebuffer too large")
+	}
+
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	fb.Width = width
+	fb.Height = height
+	fb.Format = format
+	fb.frame = 0
+	fb.Pixels = make([]byte, int(fb.Stride())*int(height))
+
+	return nil
+}
+
+// BytesPerPixel returns the size of one pixel in bytes.
+func (fb *RisbeeFramebuffer) BytesPerPixel() uint32 {
+	return formatBytes(fb.Format)
+}
+
+// Returns the size in bytes of one pixel in the given
+// format.
+func formatBytes(format uint32) uint32 {
+	switch format {
+	case RISBEE_FB_FORMAT_RGB565:
+		return 2
+
+	case RISBEE_FB_FORMAT_RGB888:
+		return 3
+	}
+
+	return 4
+}
+
+// Stride returns the number of bytes per pixel row.
+func (fb *RisbeeFramebuffer) Stride() uint32 {
+	return fb.Width * fb.BytesPerPixel()
+}
+
+// WindowSize returns the size of the guest address window
+// needed to attach the device with AttachDevice.
+func (fb *RisbeeFramebuffer) WindowSize() uint64 {
+	return RISBEE_FB_PIXELS + uint64(len(fb.Pixels))
+}
+
+// Frame returns the last frame number the guest reported.
+func (fb *RisbeeFramebuffer) Frame() uint64 {
+	fb.lock.RLock()
+	defer fb.lock.RUnlock()
+
+	return fb.frame
+}
+
+// Read implements RisbeeDevice.
+func (fb *RisbeeFramebuffer) Read(
+	vm *RisbeeVm,
+	Offset uint64,
+	Size uint64,
+) uint64 {
+	fb.lock.RLock()
+	defer fb.lock.RUnlock()
+
+	if Offset >= RISBEE_FB_PIXELS {
+		offset := Offset - RISBEE_FB_PIXELS
+		if offset+Size > uint64(len(fb.Pixels)) {
+			return 0
+		}
+
+		var val uint64
+		for index := uint64(0); index < Size; index++ {
+			val |= uint64(fb.Pixels[offset+index]) << (8 * index)
+		}
+
+		return val
+	}
+
+	switch Offset {
+	case RISBEE_FB_WIDTH:
+		return uint64(fb.Width)
+
+	case RISBEE_FB_HEIGHT:
+		return uint64(fb.Height)
+
+	case RISBEE_FB_STRIDE:
+		return uint64(fb.Stride())
+
+	case RISBEE_FB_FORMAT:
+		return uint64(fb.Format)
+
+	case RISBEE_FB_FRAME:
+		return fb.frame
+	}
+
+	return 0
+}
+
+// Write implements RisbeeDevice.
+func (fb *RisbeeFramebuffer) Write(
+	vm *RisbeeVm,
+	Offset uint64,
+	Size uint64,
+	Value uint64,
+) {
+	if Offset == RISBEE_FB_FRAME {
+		fb.lock.Lock()
+		fb.frame = Value
+		fb.lock.Unlock()
+
+		if fb.FrameCallback != nil {
+			fb.FrameCallback(Value)
+		}
+		return
+	}
+
+	if Offset < RISBEE_FB_PIXELS {
+		return
+	}
+
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	offset := Offset - RISBEE_FB_PIXELS
+	if offset+Size > uint64(len(fb.Pixels)) {
+		return
+	}
+
+	for index := uint64(0); index < Size; index++ {
+		fb.Pixels[offset+index] = byte(Value >> (8 * index))
+	}
+}
+
+// DmaRanges implements RisbeeDmaDevice: the framebuffer
+// never writes guest memory.
+func (fb *RisbeeFramebuffer) DmaRanges(
+	vm *RisbeeVm,
+	Offset uint64,
+	Size uint64,
+	Value uint64,
+) []RisbeeMemoryRegion {
+	return nil
+}
+
+// Returns the color of the pixel at (x, y) according
+// to the configured pixel format. Only RGBA8888 carries
+// alpha, which is not premultiplied.
+func (fb *RisbeeFramebuffer) pixelAt(x, y uint32) color.NRGBA {
+	offset := int(y)*int(fb.Stride()) + int(x)*int(fb.BytesPerPixel())
+	pixel := fb.Pixels[offset:]
+
+	switch fb.Format {
+	case RISBEE_FB_FORMAT_RGB565:
+		val := uint16LittleEndian(pixel)
+		red := byte(val>>11) & 0x1F
+		green := byte(val>>5) & 0x3F
+		blue := byte(val) & 0x1F
+
+		return color.NRGBA{
+			R: red<<3 | red>>2,
+			G: green<<2 | green>>4,
+			B: blue<<3 | blue>>2,
+			A: 0xFF,
+		}
+
+	case RISBEE_FB_FORMAT_RGB888:
+		return color.NRGBA{R: pixel[0], G: pixel[1], B: pixel[2], A: 0xFF}
+
+	case RISBEE_FB_FORMAT_XRGB8888:
+		return color.NRGBA{R: pixel[2], G: pixel[1], B: pixel[0], A: 0xFF}
+	}
+
+	return color.NRGBA{R: pixel[0], G: pixel[1], B: pixel[2], A: pixel[3]}
+}
+
+// Image returns a snapshot of the current frame. The
+// returned image does not change when the guest keeps
+// drawing.
+func (fb *RisbeeFramebuffer) Image() image.Image {
+	fb.lock.RLock()
+	defer fb.lock.RUnlock()
+
+	img := image.NewNRGBA(image.Rect(0, 0, int(fb.Width), int(fb.Height)))
+	for y := uint32(0); y < fb.Height; y++ {
+		for x := uint32(0); x < fb.Width; x++ {
+			img.SetNRGBA(int(x), int(y), fb.pixelAt(x, y))
+		}
+	}
+
+	return img
+}
+
+// WritePNG encodes the current frame as PNG into w.
+func (fb *RisbeeFramebuffer) WritePNG(w io.Writer) error {
+	return png.Encode(w, fb.Image())
+}
+
+// SavePNG writes the current frame as a PNG file at path.
+func (fb *RisbeeFramebuffer) SavePNG(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := fb.WritePNG(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestFramebufferAlpha(t *testing.T) {
+	var fb RisbeeFramebuffer
+	if err := fb.Initialize(2, 1, RISBEE_FB_FORMAT_RGBA8888); err != nil {
+		t.Fatal(err)
+	}
+
+	fb.Write(nil, RISBEE_FB_PIXELS, 4, 0x80FF4020)
+
+	want := color.NRGBA{R: 0x20, G: 0x40, B: 0xFF, A: 0x80}
+	if got := fb.Image().At(0, 0); got != want {
+		t.Fatalf("pixel %v, want %v", got, want)
+	}
+
+	var buffer bytes.Buffer
+	if err := fb.WritePNG(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := png.Decode(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := color.NRGBAModel.Convert(decoded.At(0, 0)); got != want {
+		t.Fatalf("PNG pixel %v, want %v", got, want)
+	}
+}
+
+func TestFramebufferUnknownFormat(t *testing.T) {
+	var fb RisbeeFramebuffer
+	if fb.Initialize(4, 4, RISBEE_FB_FORMAT_RGBA8888+1) == nil {
+		t.Fatal("unknown format was accepted")
+	}
+}
+
+// Captures the bottom-right pixel of a 2x2 frame in every
+// pixel format.
+func TestFramebufferFormats(t *testing.T) {
+	cases := []struct {
+		format uint32
+		value  uint64
+		want   color.NRGBA
+	}{
+		{RISBEE_FB_FORMAT_RGB565, 0x8408, color.NRGBA{R: 0x84, G: 0x82, B: 0x42, A: 0xFF}},
+		{RISBEE_FB_FORMAT_RGB888, 0x302010, color.NRGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xFF}},
+		{RISBEE_FB_FORMAT_XRGB8888, 0x00102030, color.NRGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xFF}},
+		{RISBEE_FB_FORMAT_RGBA8888, 0x80302010, color.NRGBA{R: 0x10, G: 0x20, B: 0x30, A: 0x80}},
+	}
+
+	for _, test := range cases {
+		var fb RisbeeFramebuffer
+		if err := fb.Initialize(2, 2, test.format); err != nil {
+			t.Fatal(err)
+		}
+
+		offset := RISBEE_FB_PIXELS + uint64(fb.Stride()+fb.BytesPerPixel())
+		fb.Write(nil, offset, uint64(fb.BytesPerPixel()), test.value)
+
+		img := fb.Image()
+		if got := img.At(1, 1); got != test.want {
+			t.Errorf("format %d: pixel %v, want %v", test.format, got, test.want)
+		}
+
+		blank := color.NRGBA{A: 0xFF}
+		if test.format == RISBEE_FB_FORMAT_RGBA8888 {
+			blank.A = 0
+		}
+
+		for _, point := range [][2]int{{0, 0}, {1, 0}, {0, 1}} {
+			if got := img.At(point[0], point[1]); got != blank {
+				t.Errorf("format %d: pixel %v at %v", test.format, got, point)
+			}
+		}
+	}
+}
+
+func TestFramebufferTooLarge(t *testing.T) {
+	for _, size := range [][3]uint32{
+		{1 << 31, 1, RISBEE_FB_FORMAT_RGBA8888},     // Stride wraps in 32 bits
+		{1 << 16, 1 << 16, RISBEE_FB_FORMAT_RGB888}, // Frame wraps in 32 bits
+		{1 << 15, 1 << 14, RISBEE_FB_FORMAT_XRGB8888},
+	} {
+		var fb RisbeeFramebuffer
+		if fb.Initialize(size[0], size[1], size[2]) == nil {
+			t.Errorf("%dx%d frame in format %d was accepted", size[0], size[1], size[2])
+		}
+	}
+}
@@ -0,0 +1,732 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Target description sent to GDB, declaring the 32 integer
+// registers followed by the program counter.
+var gdbTargetXml = func() string {
+	var xml strings.Builder
+
+	xml.WriteString(`<?xml version="1.0"?>` +
+		`<!DOCTYPE target SYSTEM "gdb-target.dtd">` +
+		`<target version="1.0">` +
+		`<architecture>riscv:rv64</architecture>` +
+		`<feature name="org.gnu.gdb.riscv.cpu">`)
+
+	for index, name := range RisbeeRegisterNames {
+		kind := "int"
+		switch name {
+		case "ra":
+			kind = "code_ptr"
+
+		case "sp", "gp", "tp", "s0":
+			kind = "data_ptr"
+		}
+
+		fmt.Fprintf(&xml, `<reg name="%s" bitsize="64" type="%s" regnum="%d"/>`,
+			name, kind, index)
+	}
+
+	xml.WriteString(`<reg name="pc" bitsize="64" type="code_ptr" regnum="32"/>` +
+		`</feature></target>`)
+
+	return xml.String()
+}()
+
+// Kinds of GDB watchpoints, numbered like Z2–Z4.
+const (
+	gdbWatchWrite  = 2
+	gdbWatchRead   = 3
+	gdbWatchAccess = 4
+)
+
+// A watchpoint requested by GDB.
+type gdbWatchpoint struct {
+	id      int
+	kind    int
+	address uint64
+	length  uint64
+}
+
+// Holds the state of one GDB session.
+type gdbSession struct {
+	vm         *RisbeeVm
+	conn       io.ReadWriter
+	writeLock  sync.Mutex
+	noAck      atomic.Bool
+	interrupt  atomic.Bool
+	packets    chan string
+	breaks     map[uint64]bool
+	watches    []gdbWatchpoint
+	watchHit   string
+	faulted    bool
+	exited     bool
+	exitCode   uint64
+	exitReport func(uint64)
+}
+
+// ServeGdb listens on Network ("tcp" or "unix") at Address,
+// accepts a single connection from GDB and serves it with
+// ServeGdbConn. The listener is closed once GDB connects.
+func (vm *RisbeeVm) ServeGdb(Network string, Address string) error {
+	listener, err := net.Listen(Network, Address)
+	if err != nil {
+		return err
+	}
+
+	conn, err := listener.Accept()
+	listener.Close()
+
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return vm.ServeGdbConn(conn)
+}
+
+// ServeGdbConn speaks the GDB remote serial protocol over
+// Conn, so that e.g. riscv64-unknown-elf-gdb can inspect
+// and control the VM with "target remote". It supports
+// register and memory access, software and hardware
+// breakpoints, watchpoints, single-stepping, continuing and
+// interrupting with Ctrl-C.
+//
+// The VM is driven by the session, so it must not be run
+// elsewhere meanwhile. Faults stop the VM with SIGSEGV for
+// inspection instead of ending the session. If the guest
+// exits, GDB is told so and the VM's ExitCallback runs
+// once the session is over. ServeGdbConn returns when GDB
+// detaches, kills the program or closes the connection.
+func (vm *RisbeeVm) ServeGdbConn(Conn io.ReadWriter) error {
+	session := &gdbSession{
+		vm:      vm,
+		conn:    Conn,
+		packets: make(chan string, 16),
+		breaks:  map[uint64]bool{},
+	}
+
+	exitCallback := vm.ExitCallback
+	panicCallback := vm.PanicCallback
+
+	vm.ExitCallback = func(code uint64) {
+		session.exited = true
+		session.exitCode = code
+		vm.Stop()
+	}
+
+	vm.PanicCallback = func(message string) {
+		session.faulted = true
+		if panicCallback != nil {
+			panicCallback(message)
+		}
+	}
+
+	defer func() {
+		vm.ExitCallback = exitCallback
+		vm.PanicCallback = panicCallback
+
+		for _, watch := range session.watches {
+			vm.RemoveWatchpoint(watch.id)
+		}
+
+		if session.exited && exitCallback != nil {
+			exitCallback(session.exitCode)
+		}
+	}()
+
+	go session.receive()
+	return session.serve()
+}
+
+// Reads packets from the connection, acknowledging them
+// and forwarding Ctrl-C as an interrupt request.
+func (session *gdbSession) receive() {
+	defer close(session.packets)
+	reader := bufio.NewReader(session.conn)
+
+	for {
+		char, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+
+		switch char {
+		case 0x03:
+			session.interrupt.Store(true)
+			continue
+
+		case '$':
+		default:
+			continue
+		}
+
+		data, err := reader.ReadString('#')
+		if err != nil {
+			return
+		}
+
+		var checksum [2]byte
+		if _, err := io.ReadFull(reader, checksum[:]); err != nil {
+			return
+		}
+
+		data = data[:len(data)-1]
+		expected, err := strconv.ParseUint(string(checksum[:]), 16, 8)
+
+		if !session.noAck.Load() {
+			if err != nil || byte(expected) != gdbChecksum(data) {
+				session.write("-")
+				continue
+			}
+
+			session.write("+")
+		}
+
+		session.packets <- gdbUnescape(data)
+	}
+}
+
+// Answers packets until the session ends.
+func (session *gdbSession) serve() error {
+	for packet := range session.packets {
+		reply, done := session.handle(packet)
+		if reply != "-" {
+			if err := session.reply(reply); err != nil {
+				return err
+			}
+		}
+
+		if done {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Writes raw bytes to the connection.
+func (session *gdbSession) write(data string) error {
+	session.writeLock.Lock()
+	defer session.writeLock.Unlock()
+
+	_, err := io.WriteString(session.conn, data)
+	return err
+}
+
+// Sends a reply packet.
+func (session *gdbSession) reply(data string) error {
+	data = gdbEscape(data)
+	return session.write(fmt.Sprintf("$%s#%02x", data, gdbChecksum(data)))
+}
+
+// Handles one packet.
+//
+// Returns the reply, "-" for no reply, and whether the
+// session is over.
+func (session *gdbSession) handle(packet string) (string, bool) {
+	vm := session.vm
+	if packet == "" {
+		return "", false
+	}
+
+	command, args := packet[0], packet[1:]
+	switch command {
+	case '?':
+		return session.stopReason("S05"), false
+
+	case 'g':
+		var registers strings.Builder
+		for _, value := range vm.Registers {
+			registers.WriteString(gdbHex64(value))
+		}
+
+		registers.WriteString(gdbHex64(vm.Pc))
+		return registers.String(), false
+
+	case 'G':
+		data, err := hex.DecodeString(args)
+		if err != nil || len(data) < 33*8 {
+			return "E01", false
+		}
+
+		for index := 1; index < 32; index++ {
+			vm.Registers[index] = uint64LittleEndian(data[index*8:])
+		}
+
+		vm.Pc = uint64LittleEndian(data[32*8:])
+		return "OK", false
+
+	case 'p':
+		index, err := strconv.ParseUint(args, 16, 64)
+		switch {
+		case err != nil:
+			return "E01", false
+
+		case index < 32:
+			return gdbHex64(vm.Registers[index]), false
+
+		case index == 32:
+			return gdbHex64(vm.Pc), false
+		}
+
+		return "E01", false
+
+	case 'P':
+		name, value, _ := strings.Cut(args, "=")
+		index, err := strconv.ParseUint(name, 16, 64)
+		data, decodeErr := hex.DecodeString(value)
+
+		if err != nil || decodeErr != nil || len(data) != 8 || index > 32 {
+			return "E01", false
+		}
+
+		if index == 32 {
+			vm.Pc = uint64LittleEndian(data)
+		} else if index != 0 {
+			vm.Registers[index] = uint64LittleEndian(data)
+		}
+
+		return "OK", false
+
+	case 'm':
+		address, length, ok := gdbRange(args)
+		if !ok || !vm.inMemory(address, length) {
+			return "E14", false
+		}
+
+		return hex.EncodeToString(vm.Memory[address : address+length]), false
+
+	case 'M':
+		header, value, _ := strings.Cut(args, ":")
+		address, length, ok := gdbRange(header)
+		data, err := hex.DecodeString(value)
+
+		if !ok || err != nil || uint64(len(data)) != length ||
+			!vm.inMemory(address, length) {
+			return "E14", false
+		}
+
+		copy(vm.Memory[address:], data)
+		return "OK", false
+
+	case 'c', 's':
+		if args != "" {
+			address, err := strconv.ParseUint(args, 16, 64)
+			if err != nil {
+				return "E01", false
+			}
+
+			vm.Pc = address
+		}
+
+		return session.resume(command == 's'), false
+
+	case 'b':
+		if args != "s" && args != "c" {
+			return "", false
+		}
+
+		return session.reverse(args == "s"), false
+
+	case 'v':
+		switch {
+		case args == "Cont?":
+			return "vCont;c;C;s;S", false
+
+		case strings.HasPrefix(args, "Cont;"):
+			return session.resumeActions(strings.TrimPrefix(args, "Cont;")), false
+
+		case strings.HasPrefix(args, "Kill"):
+			vm.Stop()
+			return "OK", true
+		}
+
+		return "", false
+
+	case 'Z', 'z':
+		return session.point(command == 'Z', args), false
+
+	case 'q':
+		return session.query(args), false
+
+	case 'Q':
+		if args == "StartNoAckMode" {
+			session.noAck.Store(true)
+			return "OK", false
+		}
+
+		return "", false
+
+	case 'H', 'T':
+		return "OK", false
+
+	case 'D':
+		return "OK", true
+
+	case 'k':
+		vm.Stop()
+		return "-", true
+	}
+
+	return "", false
+}
+
+// Runs the first action of a vCont packet, a list of
+// "action[:thread]" separated by ';', that applies to the
+// only thread.
+//
+// Returns the stop reply, or E01 if the list is malformed
+// or no action applies.
+func (session *gdbSession) resumeActions(actions string) string {
+	for _, action := range strings.Split(actions, ";") {
+		name, thread, hasThread := strings.Cut(action, ":")
+		if name == "" {
+			return "E01"
+		}
+
+		if hasThread {
+			id, err := strconv.ParseInt(thread, 16, 64)
+			if err != nil {
+				return "E01"
+			}
+
+			if id != 1 && id != -1 {
+				continue
+			}
+		}
+
+		switch name[0] {
+		case 'c', 'C':
+			return session.resume(false)
+
+		case 's', 'S':
+			return session.resume(true)
+		}
+
+		return "E01"
+	}
+
+	return "E01"
+}
+
+// Answers general query packets.
+func (session *gdbSession) query(args string) string {
+	switch {
+	case strings.HasPrefix(args, "Supported"):
+		supported := "PacketSize=4000;qXfer:features:read+;swbreak+;hwbreak+;QStartNoAckMode+"
+		if session.vm.Recorder != nil {
+			supported += ";ReverseStep+;ReverseContinue+"
+		}
+
+		return supported
+
+	case args == "Attached":
+		return "1"
+
+	case args == "C":
+		return "QC1"
+
+	case args == "fThreadInfo":
+		return "m1"
+
+	case args == "sThreadInfo":
+		return "l"
+
+	case strings.HasPrefix(args, "Xfer:features:read:target.xml:"):
+		offset, length, ok := gdbRange(strings.TrimPrefix(args, "Xfer:features:read:target.xml:"))
+		if !ok {
+			return "E01"
+		}
+
+		if offset >= uint64(len(gdbTargetXml)) {
+			return "l"
+		}
+
+		chunk := gdbTargetXml[offset:]
+		if uint64(len(chunk)) > length {
+			return "m" + chunk[:length]
+		}
+
+		return "l" + chunk
+	}
+
+	return ""
+}
+
+// Inserts or removes a breakpoint or watchpoint.
+func (session *gdbSession) point(insert bool, args string) string {
+	parts := strings.Split(args, ",")
+	if len(parts) < 3 {
+		return "E01"
+	}
+
+	kind, err := strconv.Atoi(parts[0])
+	address, addressErr := strconv.ParseUint(parts[1], 16, 64)
+	length, lengthErr := strconv.ParseUint(parts[2], 16, 64)
+
+	if err != nil || addressErr != nil || lengthErr != nil {
+		return "E01"
+	}
+
+	switch kind {
+	// Breakpoints never patch guest memory, so hardware
+	// breakpoints (Z1) are the same as software ones (Z0)
+	// and both are reported as swbreak.
+	case 0, 1:
+		if insert {
+			session.breaks[address] = true
+		} else {
+			delete(session.breaks, address)
+		}
+
+		return "OK"
+
+	case gdbWatchWrite, gdbWatchRead, gdbWatchAccess:
+		if insert {
+			session.watches = append(session.watches, session.addWatchpoint(kind, address, length))
+			return "OK"
+		}
+
+		for index, existing := range session.watches {
+			if existing.kind == kind && existing.address == address && existing.length == length {
+				session.vm.RemoveWatchpoint(existing.id)
+				session.watches = append(session.watches[:index], session.watches[index+1:]...)
+				break
+			}
+		}
+
+		return "OK"
+	}
+
+	return ""
+}
+
+// Registers a VM watchpoint that records the first hit
+// as a stop reason.
+func (session *gdbSession) addWatchpoint(kind int, address uint64, length uint64) gdbWatchpoint {
+	access, reason := uint64(RISBEE_WATCH_ACCESS), "awatch"
+	switch kind {
+	case gdbWatchWrite:
+		access, reason = RISBEE_WATCH_WRITE, "watch"
+
+	case gdbWatchRead:
+		access, reason = RISBEE_WATCH_READ, "rwatch"
+	}
+
+	id := session.vm.AddWatchpoint(address, length, access,
+		func(vm *RisbeeVm, Event RisbeeWatchEvent) {
+			if session.watchHit == "" {
+				session.watchHit = fmt.Sprintf("%s:%x;", reason, Event.Address)
+			}
+		})
+
+	return gdbWatchpoint{id, kind, address, length}
+}
+
+// Runs the VM for one instruction, or until a breakpoint,
+// watchpoint, fault, exit or interrupt.
+//
+// Returns the stop reply.
+func (session *gdbSession) resume(step bool) string {
+	vm := session.vm
+	if session.exited {
+		return fmt.Sprintf("W%02x", uint8(session.exitCode))
+	}
+
+	if session.faulted {
+		return "X0b"
+	}
+
+	// A suspended syscall has no result in a0 yet, so the
+	// program cannot go on until the host resumes it.
+	if vm.IsSuspended() {
+		return "S05"
+	}
+
+	session.interrupt.Store(false)
+	vm.Running = true
+
+	for first := true; ; first = false {
+		if !first && session.breaks[vm.Pc] {
+			vm.Running = false
+			return "T05swbreak:;"
+		}
+
+		if vm.inMemory(vm.Pc, 4) && uint32LittleEndian(vm.Memory[vm.Pc:]) == 0x00100073 {
+			if !first {
+				vm.Running = false
+				return "S05"
+			}
+
+			// Resuming from an EBREAK the program stopped at
+			// moves past it instead of executing it, which
+			// would halt the VM.
+			vm.Pc += 4
+			if step {
+				vm.Running = false
+				return "S05"
+			}
+
+			continue
+		}
+
+		vm.Step()
+
+		switch {
+		case session.exited:
+			return fmt.Sprintf("W%02x", uint8(session.exitCode))
+
+		case session.faulted:
+			return "S0b"
+
+		case session.watchHit != "":
+			hit := session.watchHit
+			session.watchHit = ""
+			vm.Running = false
+
+			return "T05" + hit
+
+		case !vm.Running:
+			return "S05"
+
+		case step:
+			vm.Running = false
+			return "S05"
+
+		case session.interrupt.Load():
+			vm.Running = false
+			return "S02"
+		}
+	}
+}
+
+// Steps or continues backwards through the recorded
+// history until a breakpoint, an interrupt or the start of
+// the history.
+//
+// Returns the stop reply.
+func (session *gdbSession) reverse(step bool) string {
+	vm := session.vm
+	if vm.Recorder == nil {
+		return "E01"
+	}
+
+	session.interrupt.Store(false)
+	for {
+		if !vm.StepBack() {
+			return "T05replaylog:begin;"
+		}
+
+		session.exited = false
+		session.faulted = false
+
+		switch {
+		case step:
+			return "S05"
+
+		case session.breaks[vm.Pc]:
+			return "T05swbreak:;"
+
+		case session.interrupt.Load():
+			return "S02"
+		}
+	}
+}
+
+// Reports the current stop reason for '?'.
+func (session *gdbSession) stopReason(fallback string) string {
+	switch {
+	case session.exited:
+		return fmt.Sprintf("W%02x", uint8(session.exitCode))
+
+	case session.faulted:
+		return "S0b"
+	}
+
+	return fallback
+}
+
+// Parses an "address,length" pair of hex numbers.
+func gdbRange(args string) (uint64, uint64, bool) {
+	first, second, found := strings.Cut(args, ",")
+	address, err := strconv.ParseUint(first, 16, 64)
+	length, lengthErr := strconv.ParseUint(second, 16, 64)
+
+	return address, length, found && err == nil && lengthErr == nil
+}
+
+// Formats a register value as little-endian hex bytes.
+func gdbHex64(value uint64) string {
+	var data [8]byte
+	putUint64(data[:], value)
+
+	return hex.EncodeToString(data[:])
+}
+
+// Computes the modulo-256 checksum of a packet.
+func gdbChecksum(data string) byte {
+	var sum byte
+	for index := 0; index < len(data); index++ {
+		sum += data[index]
+	}
+
+	return sum
+}
+
+// Escapes characters that may not appear in a packet.
+func gdbEscape(data string) string {
+	if !strings.ContainsAny(data, "#$}*") {
+		return data
+	}
+
+	var escaped strings.Builder
+	for index := 0; index < len(data); index++ {
+		switch char := data[index]; char {
+		case '#', '$', '}', '*':
+			escaped.WriteByte('}')
+			escaped.WriteByte(char ^ 0x20)
+
+		default:
+			escaped.WriteByte(char)
+		}
+	}
+
+	return escaped.String()
+}
+
+// Undoes the escaping applied to binary packet data.
+func gdbUnescape(data string) string {
+	if !strings.Contains(data, "}") {
+		return data
+	}
+
+	var unescaped strings.Builder
+	for index := 0; index < len(data); index++ {
+		if data[index] == '}' && index+1 < len(data) {
+			index++
+			unescaped.WriteByte(data[index] ^ 0x20)
+			continue
+		}
+
+		unescaped.WriteByte(data[index])
+	}
+
+	return unescaped.String()
+}
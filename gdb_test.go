@@ -0,0 +1,53 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import "testing"
+
+func TestGdbResume(t *testing.T) {
+	program := []uint32{
+		0x00150513, // addi a0, a0, 1
+		0x00100073, // ebreak
+		0x00150513, // addi a0, a0, 1
+		0x00150513, // addi a0, a0, 1
+		0x0000006F, // j .
+	}
+
+	vm := &RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(message string) {
+		t.Errorf("panic: %s", message)
+	})
+
+	code := make([]byte, 4*len(program))
+	for index, inst := range program {
+		putUint32(code[4*index:], inst)
+	}
+	vm.LoadFromBytes(code)
+
+	session := &gdbSession{vm: vm, breaks: map[uint64]bool{}}
+	steps := []struct {
+		packet string
+		reply  string
+		pc     uint64
+		a0     uint64
+	}{
+		{"vCont;", "E01", 0x1000, 0},
+		{"vCont;x", "E01", 0x1000, 0},
+		{"vCont;s:2", "E01", 0x1000, 0},
+		{"vCont;c", "S05", 0x1004, 1},
+		{"vCont;s:1;c", "S05", 0x1008, 1},
+		{"Z1,100c,4", "OK", 0x1008, 1},
+		{"vCont;c:-1", "T05swbreak:;", 0x100C, 2},
+	}
+
+	for _, step := range steps {
+		reply, _ := session.handle(step.packet)
+		if reply != step.reply || vm.Pc != step.pc || vm.Registers[10] != step.a0 {
+			t.Fatalf("%s: reply %q, pc 0x%x, a0 %d", step.packet, reply, vm.Pc, vm.Registers[10])
+		}
+	}
+}
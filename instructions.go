@@ -123,3 +123,21 @@ const (
 	RISBEE_OPINST_RT64_REM    = 0xE   // REM: remainder (signed)
 	RISBEE_OPINST_RT64_REMU   = 0xF   // REMU: remainder (unsigned)
 )
+
+// Function3 codes for system instructions. RISBEE_FC3_PRIV covers
+// ECALL/EBREAK, while the remaining codes select the Zicsr
+// read-modify-write operation applied to a control and status register.
+const (
+	RISBEE_FC3_PRIV   = 0 // ECALL/EBREAK
+	RISBEE_FC3_CSRRW  = 1 // CSR Read and Write
+	RISBEE_FC3_CSRRS  = 2 // CSR Read and Set bits
+	RISBEE_FC3_CSRRC  = 3 // CSR Read and Clear bits
+	RISBEE_FC3_CSRRWI = 5 // CSR Read and Write immediate
+	RISBEE_FC3_CSRRSI = 6 // CSR Read and Set bits immediate
+	RISBEE_FC3_CSRRCI = 7 // CSR Read and Clear bits immediate
+)
+
+// Control and status register addresses known to the VM.
+const (
+	RISBEE_CSR_MHARTID = 0xF14 // MHARTID: hardware thread (hart) ID, read-only
+)
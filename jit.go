@@ -0,0 +1,65 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+// RISBEE_JIT_THRESHOLD is the number of times a translated
+// block is entered before RISBEE_ENGINE_JIT compiles it.
+const RISBEE_JIT_THRESHOLD = 256
+
+// Compiles the block to native code, as far as the JIT tier
+// supports its instructions. Each run of two or more
+// supported instructions replaces the op of its first
+// instruction, which then skips the rest. Everything else,
+// including all loads and stores, stays with the closures.
+func (block *translatedBlock) compile() {
+	block.compiled = true
+
+	for index := 0; index < len(block.ops); index++ {
+		var code []byte
+		count, ends := 0, false
+
+		for index+count < len(block.ops) {
+			pc := block.start + uint64(index+count)*4
+			inst := uint32LittleEndian(block.code[pc-block.start:])
+
+			next, ok, last := jitInstruction(code, inst, pc)
+			if !ok {
+				break
+			}
+
+			code = next
+			count++
+
+			if last {
+				ends = true
+				break
+			}
+		}
+
+		if count < 2 {
+			continue
+		}
+
+		call := jitMap(code)
+		if call == nil {
+			return
+		}
+
+		if ends {
+			block.ops[index].run = func(vm *RisbeeVm) {
+				vm.Pc = call(&vm.Registers)
+			}
+		} else {
+			block.ops[index].run = func(vm *RisbeeVm) {
+				call(&vm.Registers)
+			}
+		}
+
+		block.ops[index].skip = count - 1
+		index += count - 1
+	}
+}
@@ -0,0 +1,293 @@
+//go:build linux
+
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Native registers used by generated code. Guest registers
+// live in memory, at RDI; RAX also holds the next program
+// counter when the code returns from a control transfer.
+const (
+	amd64Rax = 0
+	amd64Rcx = 1
+	amd64Rdx = 2
+	amd64Rdi = 7
+)
+
+// Condition codes of Jcc, SETcc and CMOVcc.
+const (
+	amd64CondB  = 0x2
+	amd64CondAE = 0x3
+	amd64CondE  = 0x4
+	amd64CondNE = 0x5
+	amd64CondL  = 0xC
+	amd64CondGE = 0xD
+)
+
+// Calls native code with RDI pointing to the guest registers.
+//
+// Returns the value left in RAX.
+//
+//go:noescape
+func jitCall(code uintptr, registers *[32]uint64) uint64
+
+// Native code in its own mapping, released once the last op
+// calling it is gone.
+type jitCode struct {
+	memory []byte
+	entry  uintptr
+}
+
+// Copies code, followed by a return, into executable memory.
+//
+// Returns a function calling it, or nil if no executable
+// memory could be mapped.
+func jitMap(code []byte) func(*[32]uint64) uint64 {
+	code = append(code, 0xC3)
+	size := (len(code) + syscall.Getpagesize() - 1) &^ (syscall.Getpagesize() - 1)
+
+	memory, err := syscall.Mmap(-1, 0, size,
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil
+	}
+
+	copy(memory, code)
+	if syscall.Mprotect(memory, syscall.PROT_READ|syscall.PROT_EXEC) != nil {
+		syscall.Munmap(memory)
+		return nil
+	}
+
+	native := &jitCode{memory: memory, entry: uintptr(unsafe.Pointer(&memory[0]))}
+	runtime.AddCleanup(native, func(memory []byte) {
+		syscall.Munmap(memory)
+	}, memory)
+
+	return func(registers *[32]uint64) uint64 {
+		return jitCall(native.entry, registers)
+	}
+}
+
+// Appends the native code of a guest instruction at pc. The
+// supported instructions are those with a dedicated handler
+// in the decode cache, except loads and stores, and behave
+// exactly like them.
+//
+// Returns the code, whether the instruction is supported,
+// and whether it transfers control and leaves the next
+// program counter in RAX.
+func jitInstruction(code []byte, inst uint32, pc uint64) ([]byte, bool, bool) {
+	rd := (inst >> 7) & 0x1F
+	rs1 := (inst >> 15) & 0x1F
+	rs2 := (inst >> 20) & 0x1F
+	functionCode3 := (inst >> 12) & 0x7
+	functionCode7 := (inst >> 25) & 0x7F
+	immediate := int32(inst&0xFFF00000) >> 20
+
+	switch inst & 0x7F {
+	case RISBEE_OPINST_IMM:
+		shiftAmount := byte((inst >> 20) & 0x3F)
+		if functionCode3 == RISBEE_FC3_SRLI && (inst>>26)>>4 > 0x1 {
+			return code, false, false
+		}
+
+		if rd == 0 {
+			return code, true, false
+		}
+
+		code = amd64Load(code, amd64Rax, rs1)
+		switch functionCode3 {
+		case RISBEE_FC3_ADDI:
+			code = amd64Imm32(append(code, 0x48, 0x05), immediate)
+
+		case RISBEE_FC3_SLLI:
+			code = append(code, 0x48, 0xC1, 0xE0, shiftAmount)
+
+		case RISBEE_FC3_SLTI:
+			code = amd64Imm32(append(code, 0x48, 0x3D), immediate)
+			code = amd64SetCondition(code, amd64CondL)
+
+		case RISBEE_FC3_SLTIU:
+			code = amd64Imm32(append(code, 0x48, 0x3D), immediate)
+			code = amd64SetCondition(code, amd64CondB)
+
+		case RISBEE_FC3_XORI:
+			code = amd64Imm32(append(code, 0x48, 0x35), immediate)
+
+		case RISBEE_FC3_SRLI:
+			if (inst>>26)>>4 == 0x0 {
+				code = append(code, 0x48, 0xC1, 0xE8, shiftAmount)
+			} else {
+				code = append(code, 0x48, 0xC1, 0xF8, shiftAmount)
+			}
+
+		case RISBEE_FC3_ORI:
+			code = amd64Imm32(append(code, 0x48, 0x0D), immediate)
+
+		case RISBEE_FC3_ANDI:
+			code = amd64Imm32(append(code, 0x48, 0x25), immediate)
+		}
+
+		return amd64Store(code, amd64Rax, rd), true, false
+
+	case RISBEE_OPINST_RT64:
+		var operation []byte
+
+		switch (functionCode7 << 3) | functionCode3 {
+		case RISBEE_OPINST_RT64_ADD:
+			operation = []byte{0x48, 0x01, 0xC8}
+
+		case RISBEE_OPINST_RT64_SUB:
+			operation = []byte{0x48, 0x29, 0xC8}
+
+		case RISBEE_OPINST_RT64_SLL:
+			operation = []byte{0x83, 0xE1, 0x1F, 0x48, 0xD3, 0xE0}
+
+		case RISBEE_OPINST_RT64_SLT:
+			operation = amd64SetCondition([]byte{0x48, 0x39, 0xC8}, amd64CondL)
+
+		case RISBEE_OPINST_RT64_SLTU:
+			operation = amd64SetCondition([]byte{0x48, 0x39, 0xC8}, amd64CondB)
+
+		case RISBEE_OPINST_RT64_XOR:
+			operation = []byte{0x48, 0x31, 0xC8}
+
+		case RISBEE_OPINST_RT64_SRL:
+			operation = []byte{0x83, 0xE1, 0x1F, 0x48, 0xD3, 0xE8}
+
+		case RISBEE_OPINST_RT64_SRA:
+			operation = []byte{0x83, 0xE1, 0x1F, 0x48, 0xD3, 0xF8}
+
+		case RISBEE_OPINST_RT64_OR:
+			operation = []byte{0x48, 0x09, 0xC8}
+
+		case RISBEE_OPINST_RT64_AND:
+			operation = []byte{0x48, 0x21, 0xC8}
+
+		case RISBEE_OPINST_RT64_MUL:
+			operation = []byte{0x48, 0x0F, 0xAF, 0xC1}
+
+		default:
+			return code, false, false
+		}
+
+		if rd == 0 {
+			return code, true, false
+		}
+
+		code = amd64Load(code, amd64Rax, rs1)
+		code = amd64Load(code, amd64Rcx, rs2)
+		code = append(code, operation...)
+
+		return amd64Store(code, amd64Rax, rd), true, false
+
+	case RISBEE_OPINST_LUI:
+		return amd64Constant(code, rd, uint64(int64(int32(inst&0xFFFFF000)))), true, false
+
+	case RISBEE_OPINST_AUIPC:
+		return amd64Constant(code, rd, pc+uint64(int64(int32(inst&0xFFFFF000)))), true, false
+
+	case RISBEE_OPINST_JAL:
+		code = amd64Constant(code, rd, pc+4)
+		code = amd64Move(code, amd64Rax, pc+uint64(jalOffset(inst)))
+
+		return code, true, true
+
+	case RISBEE_OPINST_JALR:
+		code = amd64Load(code, amd64Rax, rs1)
+		code = amd64Imm32(append(code, 0x48, 0x05), immediate)
+		code = append(code, 0x48, 0x83, 0xE0, 0xFE)
+
+		if rd != 0 {
+			code = amd64Move(code, amd64Rcx, pc+4)
+			code = amd64Store(code, amd64Rcx, rd)
+		}
+
+		return code, true, true
+
+	case RISBEE_OPINST_BRANCH:
+		conditions := [8]int{
+			RISBEE_FC3_BEQ:  amd64CondE,
+			RISBEE_FC3_BNE:  amd64CondNE,
+			RISBEE_FC3_BLT:  amd64CondL,
+			RISBEE_FC3_BGE:  amd64CondGE,
+			RISBEE_FC3_BLTU: amd64CondB,
+			RISBEE_FC3_BGEU: amd64CondAE,
+		}
+
+		condition := conditions[functionCode3]
+		if condition == 0 {
+			return code, false, false
+		}
+
+		// Picks the fall-through address when the branch
+		// condition does not hold.
+		code = amd64Load(code, amd64Rax, rs1)
+		code = amd64Load(code, amd64Rcx, rs2)
+		code = append(code, 0x48, 0x39, 0xC8)
+		code = amd64Move(code, amd64Rax, pc+uint64(branchOffset(inst)))
+		code = amd64Move(code, amd64Rdx, pc+4)
+		code = append(code, 0x48, 0x0F, byte(0x40|condition^1), 0xC2)
+
+		return code, true, true
+	}
+
+	return code, false, false
+}
+
+// Appends a ModRM byte addressing a guest register through
+// RDI, with a 32-bit displacement.
+func amd64Guest(code []byte, native int, guest uint32) []byte {
+	code = append(code, byte(0x80|native<<3|amd64Rdi))
+	return amd64Imm32(code, int32(guest*8))
+}
+
+// Appends MOV native, [RDI+guest*8].
+func amd64Load(code []byte, native int, guest uint32) []byte {
+	return amd64Guest(append(code, 0x48, 0x8B), native, guest)
+}
+
+// Appends MOV [RDI+guest*8], native.
+func amd64Store(code []byte, native int, guest uint32) []byte {
+	return amd64Guest(append(code, 0x48, 0x89), native, guest)
+}
+
+// Appends MOV native, value.
+func amd64Move(code []byte, native int, value uint64) []byte {
+	code = append(code, 0x48, byte(0xB8+native))
+	for shift := 0; shift < 64; shift += 8 {
+		code = append(code, byte(value>>shift))
+	}
+
+	return code
+}
+
+// Appends code setting a guest register other than x0 to
+// a constant.
+func amd64Constant(code []byte, guest uint32, value uint64) []byte {
+	if guest == 0 {
+		return code
+	}
+
+	return amd64Store(amd64Move(code, amd64Rax, value), amd64Rax, guest)
+}
+
+// Appends SETcc AL and MOVZX EAX, AL.
+func amd64SetCondition(code []byte, condition int) []byte {
+	return append(code, 0x0F, byte(0x90|condition), 0xC0, 0x0F, 0xB6, 0xC0)
+}
+
+// Appends a little-endian 32-bit immediate.
+func amd64Imm32(code []byte, value int32) []byte {
+	return append(code, byte(value), byte(value>>8), byte(value>>16), byte(value>>24))
+}
@@ -0,0 +1,17 @@
+//go:build linux
+
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+#include "textflag.h"
+
+// func jitCall(code uintptr, registers *[32]uint64) uint64
+TEXT ·jitCall(SB), NOSPLIT, $0-24
+	MOVQ code+0(FP), AX
+	MOVQ registers+8(FP), DI
+	CALL AX
+	MOVQ AX, ret+16(FP)
+	RET
@@ -0,0 +1,20 @@
+//go:build !amd64 || !linux
+
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+// Native code is only generated on linux/amd64; elsewhere
+// no instruction is supported and blocks stay interpreted.
+func jitInstruction(code []byte, inst uint32, pc uint64) ([]byte, bool, bool) {
+	return code, false, false
+}
+
+// Never called, as no instruction is supported.
+func jitMap(code []byte) func(*[32]uint64) uint64 {
+	return nil
+}
@@ -0,0 +1,131 @@
+//go:build linux && amd64
+
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/nthnn/risbee"
+)
+
+// Every engine, the JIT included, on the only platform it
+// compiles code on.
+var jitEngines = append(testEngines[:len(testEngines):len(testEngines)], risbee.RISBEE_ENGINE_JIT)
+
+// Loop bodies exercising what the JIT tier compiles. Each
+// runs enough iterations for its blocks to be compiled.
+var jitPrograms = map[string]string{
+	"shifts": `
+    li a1, -12345
+    li a2, 0x0123456789ABCDEF
+    sll a3, a2, t0
+    srl a4, a1, t0
+    sra a5, a1, t0
+    slli a6, a2, 63
+    srli a7, a1, 1
+    srai s2, a1, 33
+    add s3, s3, a3
+    xor s4, s4, a4
+    add s5, s5, a5
+    addi t0, t0, 7`,
+
+	"comparisons": `
+    li a1, -1
+    li a2, 1
+    slt a3, a1, a2
+    sltu a4, a1, a2
+    slti a5, t0, -100
+    sltiu a6, t0, -100
+    sltu a7, zero, t0
+    add s2, s2, a3
+    add s3, s3, a4
+    add s4, s4, a5
+    add s5, s5, a6
+    add s6, s6, a7
+    addi t0, t0, -37`,
+
+	"branches": `
+    andi a1, t0, 7
+    addi a2, a1, -4
+    beq a1, zero, b1
+    addi s2, s2, 1
+b1:
+    bne a1, a2, b2
+    addi s3, s3, 1
+b2:
+    blt a2, zero, b3
+    addi s4, s4, 1
+b3:
+    bge a2, a1, b4
+    addi s5, s5, 1
+b4:
+    bltu a2, a1, b5
+    addi s6, s6, 1
+b5:
+    bgeu a1, a2, b6
+    addi s7, s7, 1
+b6:
+    addi t0, t0, 1`,
+
+	"jalr": `
+    la a1, double
+    andi a2, t0, 1
+    slli a2, a2, 3
+    add a1, a1, a2
+    mv a0, t0
+    jalr ra, 0(a1)
+    add s2, s2, a0
+    addi t0, t0, 1
+    j next
+double:
+    add a0, a0, a0
+    ret
+    addi a0, a0, 5
+    ret
+next:`,
+}
+
+func TestJitDifferential(t *testing.T) {
+	iterations := 4 * risbee.RISBEE_JIT_THRESHOLD
+
+	for name, body := range jitPrograms {
+		source := fmt.Sprintf(`
+    li s10, %d
+    li t0, 0
+loop:
+%s
+    addi s10, s10, -1
+    bnez s10, loop
+    li a0, 0
+    li a7, 0
+    ecall
+`, iterations, body)
+
+		compareEngines(t, name, source, jitEngines)
+	}
+
+	compareEngines(t, "self-modifying", fmt.Sprintf(selfModifyingSource, iterations), jitEngines)
+
+	random := rand.New(rand.NewPCG(3, 4))
+	for index := range 100 {
+		source := randomProgram(random, 8+random.IntN(40), risbee.RISBEE_JIT_THRESHOLD+random.IntN(200))
+		compareEngines(t, fmt.Sprintf("random program %d", index), source, jitEngines)
+
+		if t.Failed() {
+			t.Logf("program:\n%s", source)
+			break
+		}
+	}
+}
+
+func BenchmarkJit(b *testing.B) {
+	benchmarkEngine(b, risbee.RISBEE_ENGINE_JIT)
+}
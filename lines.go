@@ -0,0 +1,111 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"sort"
+)
+
+// RisbeeLine is a row of the DWARF line table of the loaded
+// ELF: the instructions from Address up to the next row
+// belong to the given source line. A row with a zero Line
+// ends a sequence of instructions.
+type RisbeeLine struct {
+	Address uint64 // First address of the row
+	File    string // Source file path
+	Line    int    // 1-based source line, 0 at sequence ends
+}
+
+// LineAt returns the source line of the instruction at
+// Address, if the loaded ELF carries debug information
+// covering it.
+func (vm *RisbeeVm) LineAt(Address uint64) (RisbeeLine, bool) {
+	index := sort.Search(len(vm.Lines), func(i int) bool {
+		return vm.Lines[i].Address > Address
+	})
+
+	if index == 0 || vm.Lines[index-1].Line == 0 {
+		return RisbeeLine{}, false
+	}
+
+	return vm.Lines[index-1], true
+}
+
+// Reads the line tables of all compilation units of an ELF
+// file, sorted by address. Files without DWARF sections
+// have no line table.
+func elfLines(file *elf.File) []RisbeeLine {
+	data, err := file.DWARF()
+	if err != nil {
+		return nil
+	}
+
+	var lines []RisbeeLine
+	reader := data.Reader()
+
+	for {
+		unit, err := reader.Next()
+		if err != nil || unit == nil {
+			break
+		}
+
+		if unit.Tag != dwarf.TagCompileUnit {
+			reader.SkipChildren()
+			continue
+		}
+
+		lineReader, err := data.LineReader(unit)
+		reader.SkipChildren()
+
+		if err != nil || lineReader == nil {
+			continue
+		}
+
+		lines = appendLines(lines, lineReader)
+	}
+
+	// The end of one sequence may coincide with the start
+	// of the next, so ends sort first.
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].Address != lines[j].Address {
+			return lines[i].Address < lines[j].Address
+		}
+
+		return lines[i].Line == 0 && lines[j].Line != 0
+	})
+
+	return lines
+}
+
+// Appends the rows of one line program.
+func appendLines(lines []RisbeeLine, reader *dwarf.LineReader) []RisbeeLine {
+	var entry dwarf.LineEntry
+
+	for {
+		if err := reader.Next(&entry); err != nil {
+			return lines
+		}
+
+		line := RisbeeLine{Address: entry.Address}
+		if !entry.EndSequence && entry.File != nil {
+			line.File = entry.File.Name
+			line.Line = entry.Line
+		}
+
+		// Consecutive rows at one address describe the same
+		// instructions; the last one wins.
+		if count := len(lines); count > 0 &&
+			lines[count-1].Address == line.Address && lines[count-1].Line != 0 {
+			lines[count-1] = line
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+}
@@ -0,0 +1,833 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// Linux RISC-V (asm-generic) syscall numbers implemented
+// by the Linux personality.
+const (
+	RISBEE_LINUX_SYS_IOCTL         = 29  // ioctl(fd, request, arg)
+	RISBEE_LINUX_SYS_OPENAT        = 56  // openat(dirfd, path, flags, mode)
+	RISBEE_LINUX_SYS_CLOSE         = 57  // close(fd)
+	RISBEE_LINUX_SYS_LSEEK         = 62  // lseek(fd, offset, whence)
+	RISBEE_LINUX_SYS_READ          = 63  // read(fd, buf, count)
+	RISBEE_LINUX_SYS_WRITE         = 64  // write(fd, buf, count)
+	RISBEE_LINUX_SYS_WRITEV        = 66  // writev(fd, iov, iovcnt)
+	RISBEE_LINUX_SYS_FSTAT         = 80  // fstat(fd, statbuf)
+	RISBEE_LINUX_SYS_EXIT          = 93  // exit(status)
+	RISBEE_LINUX_SYS_EXIT_GROUP    = 94  // exit_group(status)
+	RISBEE_LINUX_SYS_SET_TID_ADDR  = 96  // set_tid_address(tidptr)
+	RISBEE_LINUX_SYS_CLOCK_GETTIME = 113 // clock_gettime(clock, timespec)
+	RISBEE_LINUX_SYS_BRK           = 214 // brk(addr)
+	RISBEE_LINUX_SYS_MUNMAP        = 215 // munmap(addr, length)
+	RISBEE_LINUX_SYS_MMAP          = 222 // mmap(addr, length, prot, flags, fd, offset)
+	RISBEE_LINUX_SYS_GETRANDOM     = 278 // getrandom(buf, count, flags)
+)
+
+// Linux error numbers returned (negated) in a0.
+const (
+	RISBEE_LINUX_ENOENT       = 2  // No such file or directory
+	RISBEE_LINUX_EBADF        = 9  // Bad file descriptor
+	RISBEE_LINUX_ENOMEM       = 12 // Out of memory
+	RISBEE_LINUX_EACCES       = 13 // Permission denied
+	RISBEE_LINUX_EFAULT       = 14 // Bad address
+	RISBEE_LINUX_EEXIST       = 17 // File exists
+	RISBEE_LINUX_EINVAL       = 22 // Invalid argument
+	RISBEE_LINUX_EMFILE       = 24 // Too many open files
+	RISBEE_LINUX_ENOTTY       = 25 // Inappropriate ioctl for device
+	RISBEE_LINUX_EFBIG        = 27 // File too large
+	RISBEE_LINUX_ESPIPE       = 29 // Illegal seek
+	RISBEE_LINUX_ENAMETOOLONG = 36 // File name too long
+	RISBEE_LINUX_ENOSYS       = 38 // Function not implemented
+)
+
+// Flags and constants of the Linux user ABI.
+const (
+	linuxAtFdCwd      = -100
+	linuxOpenAccMode  = 0x3
+	linuxOpenReadOnly = 0x0
+	linuxOpenCreate   = 0x40
+	linuxOpenExcl     = 0x80
+	linuxOpenTrunc    = 0x200
+	linuxOpenAppend   = 0x400
+	linuxMapFixed     = 0x10
+	linuxMapAnonymous = 0x20
+	linuxMapNoReplace = 0x100000
+	linuxMaxIovecs    = 1024
+	linuxPathMax      = 4096
+	linuxPageSize     = 4096
+	linuxMaxFds       = 1024
+	linuxModeChar     = 0o020000
+	linuxModeRegular  = 0o100000
+	linuxStatSize     = 128
+	linuxAuxPageSize  = 6
+	linuxAuxRandom    = 25
+)
+
+// RisbeeLinux is an opt-in personality that implements a
+// subset of the Linux RISC-V user-mode syscall ABI, so that
+// statically linked newlib or musl binaries run unmodified.
+// Files live in a virtualized filesystem: reads fall back to
+// the read-only Fs, while created or written files are kept
+// in memory and can be inspected with File.
+type RisbeeLinux struct {
+	Args       []string  // Program arguments placed on the initial stack
+	Env        []string  // Environment placed on the initial stack
+	Stdin      io.Reader // Standard input (defaults to os.Stdin)
+	Stdout     io.Writer // Standard output (defaults to os.Stdout)
+	Stderr     io.Writer // Standard error (defaults to os.Stderr)
+	Fs         fs.FS     // Optional read-only filesystem for openat
+	MemorySize uint64    // Guest memory size (defaults to 16 MiB)
+	StackSize  uint64    // Stack reserved below the memory top (defaults to 1 MiB)
+	MaxFile    int64     // Largest size of a virtual file (defaults to 64 MiB)
+
+	files     map[string]*linuxInode
+	fds       map[uint64]*linuxFile
+	start     time.Time
+	brkBase   uint64
+	brk       uint64
+	mmapLimit uint64         // End of the area for mappings, below the stack
+	mappings  []linuxMapping // Mapped ranges, sorted by address
+}
+
+// linuxMapping is a range of pages handed out by mmap.
+type linuxMapping struct {
+	start uint64
+	end   uint64
+}
+
+// linuxInode holds the contents of a virtual file.
+type linuxInode struct {
+	data []byte
+}
+
+// linuxFile is an open file description.
+type linuxFile struct {
+	inode    *linuxInode
+	reader   io.Reader
+	writer   io.Writer
+	offset   int64
+	readable bool
+	writable bool
+	append   bool
+}
+
+// AddFile places a file into the virtual filesystem,
+// replacing any previous contents at that path.
+func (linux *RisbeeLinux) AddFile(Path string, Data []byte) {
+	if linux.files == nil {
+		linux.files = map[string]*linuxInode{}
+	}
+
+	linux.files[linuxCleanPath(Path)] = &linuxInode{
+		data: append([]byte(nil), Data...),
+	}
+}
+
+// File returns the contents of a file in the virtual
+// filesystem, including files the guest created.
+func (linux *RisbeeLinux) File(Path string) ([]byte, bool) {
+	inode, ok := linux.files[linuxCleanPath(Path)]
+	if !ok {
+		return nil, false
+	}
+
+	return inode.data, true
+}
+
+// Install grows the VM memory to MemorySize, builds the
+// initial process stack (argc, argv, envp and auxv) and
+// registers the Linux syscall handlers. Syscalls without a
+// handler fail with ENOSYS, as on Linux. It must be called
+// after the program was loaded.
+func (linux *RisbeeLinux) Install(vm *RisbeeVm) {
+	if linux.MemorySize == 0 {
+		linux.MemorySize = 16 << 20
+	}
+
+	if linux.StackSize == 0 {
+		linux.StackSize = 1 << 20
+	}
+
+	if linux.MaxFile == 0 {
+		linux.MaxFile = 64 << 20
+	}
+
+	if linux.Stdin == nil {
+		linux.Stdin = os.Stdin
+	}
+
+	if linux.Stdout == nil {
+		linux.Stdout = os.Stdout
+	}
+
+	if linux.Stderr == nil {
+		linux.Stderr = os.Stderr
+	}
+
+	if linux.files == nil {
+		linux.files = map[string]*linuxInode{}
+	}
+
+	imageEnd := uint64(len(vm.Memory))
+	if uint64(len(vm.Memory)) < linux.MemorySize {
+		memory := make([]byte, linux.MemorySize)
+		copy(memory, vm.Memory)
+
+		vm.setMemory(memory)
+	}
+
+	top := uint64(len(vm.Memory))
+	linux.brkBase = alignUp(imageEnd, linuxPageSize)
+	linux.brk = linux.brkBase
+	linux.mmapLimit = (top - linux.StackSize) &^ (linuxPageSize - 1)
+	linux.mappings = nil
+	linux.start = time.Now()
+
+	linux.fds = map[uint64]*linuxFile{
+		0: {reader: linux.Stdin, readable: true},
+		1: {writer: linux.Stdout, writable: true},
+		2: {writer: linux.Stderr, writable: true},
+	}
+
+	vm.Registers[2] = linux.setupStack(vm, top)
+
+	vm.SetSystemCall(RISBEE_LINUX_SYS_IOCTL, linux.sysIoctl)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_OPENAT, linux.sysOpenat)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_CLOSE, linux.sysClose)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_LSEEK, linux.sysLseek)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_READ, linux.sysRead)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_WRITE, linux.sysWrite)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_WRITEV, linux.sysWritev)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_FSTAT, linux.sysFstat)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_EXIT, linux.sysExit)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_EXIT_GROUP, linux.sysExit)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_SET_TID_ADDR, linux.sysSetTidAddress)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_CLOCK_GETTIME, linux.sysClockGettime)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_BRK, linux.sysBrk)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_MUNMAP, linux.sysMunmap)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_MMAP, linux.sysMmap)
+	vm.SetSystemCall(RISBEE_LINUX_SYS_GETRANDOM, linux.sysGetrandom)
+	vm.SetSyscallFallback(linux.sysUnimplemented)
+}
+
+// Rounds value up to the next multiple of align,
+// which must be a power of two.
+func alignUp(value uint64, align uint64) uint64 {
+	return (value + align - 1) &^ (align - 1)
+}
+
+// Normalizes a guest path into a key of the
+// virtual filesystem.
+func linuxCleanPath(name string) string {
+	cleaned := path.Clean("/" + name)
+	if cleaned == "/" {
+		return "."
+	}
+
+	return cleaned[1:]
+}
+
+// Converts a Linux error number into the syscall return value.
+func linuxError(errno uint64) uint64 {
+	return -errno
+}
+
+// Returns the guest memory slice [addr, addr+size) or nil
+// if it does not permit the access or lies outside memory.
+func linuxBuffer(
+	vm *RisbeeVm,
+	addr uint64,
+	size uint64,
+	permission uint64,
+) []byte {
+	if vm.checkAccess(addr, size, permission) != nil {
+		return nil
+	}
+
+	return vm.Memory[addr : addr+size]
+}
+
+// Builds the System V initial process stack below top.
+//
+// Returns the resulting stack pointer.
+func (linux *RisbeeLinux) setupStack(vm *RisbeeVm, top uint64) uint64 {
+	sp := top
+
+	pushString := func(str string) uint64 {
+		sp -= uint64(len(str)) + 1
+		copy(vm.Memory[sp:], str)
+		vm.Memory[sp+uint64(len(str))] = 0
+
+		return sp
+	}
+
+	argv := make([]uint64, len(linux.Args))
+	for index, arg := range linux.Args {
+		argv[index] = pushString(arg)
+	}
+
+	envp := make([]uint64, len(linux.Env))
+	for index, env := range linux.Env {
+		envp[index] = pushString(env)
+	}
+
+	sp -= 16
+	random := sp
+	rand.Read(vm.Memory[random : random+16])
+
+	words := []uint64{uint64(len(argv))}
+	words = append(words, argv...)
+	words = append(words, 0)
+	words = append(words, envp...)
+	words = append(words, 0)
+	words = append(words,
+		linuxAuxPageSize, linuxPageSize,
+		linuxAuxRandom, random,
+		0, 0,
+	)
+
+	sp = (sp - uint64(len(words))*8) &^ 15
+	for index, word := range words {
+		putUint64(vm.Memory[sp+uint64(index)*8:], word)
+	}
+
+	return sp
+}
+
+// Returns the open file for a descriptor.
+func (linux *RisbeeLinux) file(fd uint64) (*linuxFile, bool) {
+	file, ok := linux.fds[fd]
+	return file, ok
+}
+
+// Allocates the lowest free file descriptor.
+func (linux *RisbeeLinux) allocateFd(file *linuxFile) uint64 {
+	for fd := uint64(0); fd < linuxMaxFds; fd++ {
+		if _, used := linux.fds[fd]; !used {
+			linux.fds[fd] = file
+			return fd
+		}
+	}
+
+	return linuxError(RISBEE_LINUX_EMFILE)
+}
+
+// Looks up a path in the in-memory overlay first and
+// then in the read-only filesystem.
+func (linux *RisbeeLinux) lookup(name string) (*linuxInode, bool) {
+	if inode, ok := linux.files[name]; ok {
+		return inode, true
+	}
+
+	if linux.Fs == nil {
+		return nil, false
+	}
+
+	data, err := fs.ReadFile(linux.Fs, name)
+	if err != nil {
+		return nil, false
+	}
+
+	return &linuxInode{data: data}, true
+}
+
+func (linux *RisbeeLinux) sysOpenat(vm *RisbeeVm) uint64 {
+	dirfd := int64(vm.GetPointerParam(0))
+	pointer := vm.GetPointerParam(1)
+	flags := vm.GetPointerParam(2)
+
+	if pointer == 0 {
+		return linuxError(RISBEE_LINUX_EFAULT)
+	}
+
+	rawName, err := vm.ReadCString(pointer, linuxPathMax)
+	if errors.Is(err, ErrStringTooLong) {
+		return linuxError(RISBEE_LINUX_ENAMETOOLONG)
+	} else if err != nil {
+		return linuxError(RISBEE_LINUX_EFAULT)
+	}
+
+	// Directories are not modeled, so paths relative to a
+	// descriptor resolve from the root like absolute ones.
+	if dirfd != linuxAtFdCwd && !path.IsAbs(rawName) {
+		if _, ok := linux.file(uint64(dirfd)); !ok {
+			return linuxError(RISBEE_LINUX_EBADF)
+		}
+	}
+
+	name := linuxCleanPath(rawName)
+	inode, exists := linux.lookup(name)
+	switch {
+	case exists && flags&linuxOpenCreate != 0 && flags&linuxOpenExcl != 0:
+		return linuxError(RISBEE_LINUX_EEXIST)
+
+	case !exists && flags&linuxOpenCreate == 0:
+		return linuxError(RISBEE_LINUX_ENOENT)
+
+	case !exists:
+		inode = &linuxInode{}
+	}
+
+	access := flags & linuxOpenAccMode
+	file := &linuxFile{
+		inode:    inode,
+		readable: access != 0x1,
+		writable: access != linuxOpenReadOnly,
+		append:   flags&linuxOpenAppend != 0,
+	}
+
+	if file.writable {
+		// Writes land in the overlay, shadowing the read-only copy.
+		linux.files[name] = inode
+
+		if flags&linuxOpenTrunc != 0 {
+			inode.data = inode.data[:0]
+		}
+	}
+
+	return linux.allocateFd(file)
+}
+
+func (linux *RisbeeLinux) sysClose(vm *RisbeeVm) uint64 {
+	fd := vm.GetPointerParam(0)
+	if _, ok := linux.file(fd); !ok {
+		return linuxError(RISBEE_LINUX_EBADF)
+	}
+
+	delete(linux.fds, fd)
+	return 0
+}
+
+func (linux *RisbeeLinux) sysLseek(vm *RisbeeVm) uint64 {
+	file, ok := linux.file(vm.GetPointerParam(0))
+	if !ok {
+		return linuxError(RISBEE_LINUX_EBADF)
+	}
+
+	if file.inode == nil {
+		return linuxError(RISBEE_LINUX_ESPIPE)
+	}
+
+	offset := int64(vm.GetPointerParam(1))
+	switch vm.GetPointerParam(2) {
+	case 0:
+	case 1:
+		offset += file.offset
+
+	case 2:
+		offset += int64(len(file.inode.data))
+
+	default:
+		return linuxError(RISBEE_LINUX_EINVAL)
+	}
+
+	if offset < 0 || offset > linux.MaxFile {
+		return linuxError(RISBEE_LINUX_EINVAL)
+	}
+
+	file.offset = offset
+	return uint64(offset)
+}
+
+func (linux *RisbeeLinux) sysRead(vm *RisbeeVm) uint64 {
+	file, ok := linux.file(vm.GetPointerParam(0))
+	if !ok || !file.readable {
+		return linuxError(RISBEE_LINUX_EBADF)
+	}
+
+	buffer := linuxBuffer(
+		vm,
+		vm.GetPointerParam(1),
+		vm.GetPointerParam(2),
+		RISBEE_MEM_WRITE,
+	)
+	if buffer == nil {
+		return linuxError(RISBEE_LINUX_EFAULT)
+	}
+
+	if file.inode == nil {
+		count, _ := file.reader.Read(buffer)
+		return uint64(count)
+	}
+
+	if file.offset >= int64(len(file.inode.data)) {
+		return 0
+	}
+
+	count := copy(buffer, file.inode.data[file.offset:])
+	file.offset += int64(count)
+
+	return uint64(count)
+}
+
+func (linux *RisbeeLinux) sysWrite(vm *RisbeeVm) uint64 {
+	file, ok := linux.file(vm.GetPointerParam(0))
+	if !ok || !file.writable {
+		return linuxError(RISBEE_LINUX_EBADF)
+	}
+
+	buffer := linuxBuffer(
+		vm,
+		vm.GetPointerParam(1),
+		vm.GetPointerParam(2),
+		RISBEE_MEM_READ,
+	)
+	if buffer == nil {
+		return linuxError(RISBEE_LINUX_EFAULT)
+	}
+
+	return file.write(buffer, linux.MaxFile)
+}
+
+func (linux *RisbeeLinux) sysWritev(vm *RisbeeVm) uint64 {
+	file, ok := linux.file(vm.GetPointerParam(0))
+	if !ok || !file.writable {
+		return linuxError(RISBEE_LINUX_EBADF)
+	}
+
+	count := vm.GetPointerParam(2)
+	if count > linuxMaxIovecs {
+		return linuxError(RISBEE_LINUX_EINVAL)
+	}
+
+	iovecs := linuxBuffer(vm, vm.GetPointerParam(1), count*16, RISBEE_MEM_READ)
+	if iovecs == nil {
+		return linuxError(RISBEE_LINUX_EFAULT)
+	}
+
+	// Gather all buffers first, so that a bad one fails the
+	// call before anything is written.
+	buffers := make([][]byte, count)
+	for index := range buffers {
+		buffers[index] = linuxBuffer(
+			vm,
+			uint64LittleEndian(iovecs[index*16:]),
+			uint64LittleEndian(iovecs[index*16+8:]),
+			RISBEE_MEM_READ,
+		)
+
+		if buffers[index] == nil {
+			return linuxError(RISBEE_LINUX_EFAULT)
+		}
+	}
+
+	var written uint64
+	for _, buffer := range buffers {
+		result := file.write(buffer, linux.MaxFile)
+		if int64(result) < 0 {
+			if written == 0 {
+				return result
+			}
+
+			break
+		}
+
+		written += result
+		if result < uint64(len(buffer)) {
+			break
+		}
+	}
+
+	return written
+}
+
+// Writes buffer at the file offset, or to the host writer
+// of a standard stream. Virtual files cannot grow past
+// limit bytes.
+//
+// Returns the number of bytes written, or -EFBIG.
+func (file *linuxFile) write(buffer []byte, limit int64) uint64 {
+	if file.inode == nil {
+		count, _ := file.writer.Write(buffer)
+		return uint64(count)
+	}
+
+	if file.append {
+		file.offset = int64(len(file.inode.data))
+	}
+
+	if file.offset > limit || int64(len(buffer)) > limit-file.offset {
+		return linuxError(RISBEE_LINUX_EFBIG)
+	}
+
+	end := file.offset + int64(len(buffer))
+	if end > int64(len(file.inode.data)) {
+		grown := make([]byte, end)
+		copy(grown, file.inode.data)
+
+		file.inode.data = grown
+	}
+
+	copy(file.inode.data[file.offset:], buffer)
+	file.offset = end
+
+	return uint64(len(buffer))
+}
+
+func (linux *RisbeeLinux) sysFstat(vm *RisbeeVm) uint64 {
+	file, ok := linux.file(vm.GetPointerParam(0))
+	if !ok {
+		return linuxError(RISBEE_LINUX_EBADF)
+	}
+
+	stat := linuxBuffer(
+		vm,
+		vm.GetPointerParam(1),
+		linuxStatSize,
+		RISBEE_MEM_WRITE,
+	)
+	if stat == nil {
+		return linuxError(RISBEE_LINUX_EFAULT)
+	}
+
+	clear(stat)
+	putUint32(stat[20:], 1)
+	putUint32(stat[56:], linuxPageSize)
+
+	if file.inode == nil {
+		putUint32(stat[16:], linuxModeChar|0o620)
+	} else {
+		size := uint64(len(file.inode.data))
+
+		putUint32(stat[16:], linuxModeRegular|0o644)
+		putUint64(stat[48:], size)
+		putUint64(stat[64:], (size+511)/512)
+	}
+
+	return 0
+}
+
+func (linux *RisbeeLinux) sysExit(vm *RisbeeVm) uint64 {
+	exitCode := int(int32(vm.GetPointerParam(0)))
+	vm.setExitCode(exitCode)
+
+	if vm.ExitCallback != nil {
+		vm.ExitCallback(uint64(exitCode))
+	}
+
+	vm.Stop()
+	return uint64(exitCode)
+}
+
+func (linux *RisbeeLinux) sysSetTidAddress(vm *RisbeeVm) uint64 {
+	// There is a single thread, whose ID is 1.
+	return 1
+}
+
+func (linux *RisbeeLinux) sysIoctl(vm *RisbeeVm) uint64 {
+	if _, ok := linux.file(vm.GetPointerParam(0)); !ok {
+		return linuxError(RISBEE_LINUX_EBADF)
+	}
+
+	// No descriptor is a terminal, which is what isatty and
+	// TIOCGWINSZ queries of the C library expect to hear.
+	return linuxError(RISBEE_LINUX_ENOTTY)
+}
+
+func (linux *RisbeeLinux) sysUnimplemented(vm *RisbeeVm, Code uint64) uint64 {
+	return linuxError(RISBEE_LINUX_ENOSYS)
+}
+
+func (linux *RisbeeLinux) sysClockGettime(vm *RisbeeVm) uint64 {
+	timespec := linuxBuffer(
+		vm,
+		vm.GetPointerParam(1),
+		16,
+		RISBEE_MEM_WRITE,
+	)
+	if timespec == nil {
+		return linuxError(RISBEE_LINUX_EFAULT)
+	}
+
+	var nanos int64
+	switch vm.GetPointerParam(0) {
+	case 0:
+		nanos = time.Now().UnixNano()
+
+	case 1, 4:
+		nanos = int64(time.Since(linux.start))
+
+	default:
+		return linuxError(RISBEE_LINUX_EINVAL)
+	}
+
+	putUint64(timespec[0:], uint64(nanos/1e9))
+	putUint64(timespec[8:], uint64(nanos%1e9))
+
+	return 0
+}
+
+func (linux *RisbeeLinux) sysBrk(vm *RisbeeVm) uint64 {
+	requested := vm.GetPointerParam(0)
+	limit := linux.mmapLimit
+
+	for _, mapping := range linux.mappings {
+		if mapping.start >= linux.brk {
+			limit = min(limit, mapping.start)
+			break
+		}
+	}
+
+	if requested >= linux.brkBase && requested <= limit {
+		if requested > linux.brk {
+			clear(vm.Memory[linux.brk:requested])
+		}
+
+		linux.brk = requested
+	}
+
+	return linux.brk
+}
+
+func (linux *RisbeeLinux) sysMmap(vm *RisbeeVm) uint64 {
+	addr := vm.GetPointerParam(0)
+	length := alignUp(vm.GetPointerParam(1), linuxPageSize)
+	flags := vm.GetPointerParam(3)
+
+	if length == 0 {
+		return linuxError(RISBEE_LINUX_EINVAL)
+	}
+
+	if flags&linuxMapAnonymous == 0 {
+		return linuxError(RISBEE_LINUX_EACCES)
+	}
+
+	switch {
+	case flags&(linuxMapFixed|linuxMapNoReplace) != 0:
+		if addr%linuxPageSize != 0 {
+			return linuxError(RISBEE_LINUX_EINVAL)
+		}
+
+		if !vm.inMemory(addr, length) {
+			return linuxError(RISBEE_LINUX_ENOMEM)
+		}
+
+		if flags&linuxMapNoReplace != 0 && linux.mapped(addr, addr+length) {
+			return linuxError(RISBEE_LINUX_EEXIST)
+		}
+
+	case addr != 0 && linux.available(alignUp(addr, linuxPageSize), length):
+		addr = alignUp(addr, linuxPageSize)
+
+	default:
+		var ok bool
+		if addr, ok = linux.findFree(length); !ok {
+			return linuxError(RISBEE_LINUX_ENOMEM)
+		}
+	}
+
+	linux.unmap(addr, addr+length)
+	linux.mappings = append(linux.mappings, linuxMapping{addr, addr + length})
+	sort.Slice(linux.mappings, func(i, j int) bool {
+		return linux.mappings[i].start < linux.mappings[j].start
+	})
+
+	clear(vm.Memory[addr : addr+length])
+	return addr
+}
+
+func (linux *RisbeeLinux) sysMunmap(vm *RisbeeVm) uint64 {
+	addr := vm.GetPointerParam(0)
+	length := alignUp(vm.GetPointerParam(1), linuxPageSize)
+
+	if addr%linuxPageSize != 0 || !vm.inMemory(addr, length) {
+		return linuxError(RISBEE_LINUX_EINVAL)
+	}
+
+	linux.unmap(addr, addr+length)
+	return 0
+}
+
+// Checks whether any mapping overlaps [start, end).
+func (linux *RisbeeLinux) mapped(start uint64, end uint64) bool {
+	for _, mapping := range linux.mappings {
+		if start < mapping.end && mapping.start < end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks whether length bytes at addr can be mapped without
+// touching the heap, the stack or another mapping.
+func (linux *RisbeeLinux) available(addr uint64, length uint64) bool {
+	return addr >= linux.brk && addr+length >= addr &&
+		addr+length <= linux.mmapLimit && !linux.mapped(addr, addr+length)
+}
+
+// Finds the highest free range of length bytes between the
+// program break and the stack.
+//
+// Returns its address and whether there is one.
+func (linux *RisbeeLinux) findFree(length uint64) (uint64, bool) {
+	end := linux.mmapLimit
+
+	for index := len(linux.mappings) - 1; index >= 0; index-- {
+		mapping := linux.mappings[index]
+		if mapping.end <= end && end-mapping.end >= length {
+			break
+		}
+
+		end = min(end, mapping.start)
+	}
+
+	if end < linux.brk || end-linux.brk < length {
+		return 0, false
+	}
+
+	return end - length, true
+}
+
+// Removes [start, end) from the mappings, splitting those
+// that only partly overlap it.
+func (linux *RisbeeLinux) unmap(start uint64, end uint64) {
+	var kept []linuxMapping
+
+	for _, mapping := range linux.mappings {
+		if end <= mapping.start || mapping.end <= start {
+			kept = append(kept, mapping)
+			continue
+		}
+
+		if mapping.start < start {
+			kept = append(kept, linuxMapping{mapping.start, start})
+		}
+
+		if end < mapping.end {
+			kept = append(kept, linuxMapping{end, mapping.end})
+		}
+	}
+
+	linux.mappings = kept
+}
+
+func (linux *RisbeeLinux) sysGetrandom(vm *RisbeeVm) uint64 {
+	buffer := linuxBuffer(
+		vm,
+		vm.GetPointerParam(0),
+		vm.GetPointerParam(1),
+		RISBEE_MEM_WRITE,
+	)
+	if buffer == nil {
+		return linuxError(RISBEE_LINUX_EFAULT)
+	}
+
+	rand.Read(buffer)
+	return uint64(len(buffer))
+}
@@ -0,0 +1,327 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nthnn/risbee"
+	"github.com/nthnn/risbee/asm"
+)
+
+// Loads a program assembled from source into a VM with the
+// Linux personality installed.
+func newLinuxVm(t *testing.T, source string, linux *risbee.RisbeeLinux) *risbee.RisbeeVm {
+	t.Helper()
+
+	code, err := asm.Assemble(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := &risbee.RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(message string) {
+		t.Errorf("panic: %s", message)
+	})
+
+	vm.LoadFromBytes(code)
+	linux.Install(vm)
+
+	return vm
+}
+
+// Runs the calls a statically linked musl binary makes
+// before and while printing to stdout.
+func TestLinuxMuslStartup(t *testing.T) {
+	var stdout bytes.Buffer
+	linux := &risbee.RisbeeLinux{Stdout: &stdout}
+
+	vm := newLinuxVm(t, `
+    la a0, tid
+    li a7, 96           # set_tid_address
+    ecall
+    mv s1, a0
+
+    li a0, 1
+    li a1, 0x5413       # TIOCGWINSZ
+    la a2, winsize
+    li a7, 29           # ioctl
+    ecall
+    mv s2, a0
+
+    li a7, 135          # rt_sigprocmask
+    ecall
+    mv s3, a0
+
+    li a0, 1
+    la a1, iov
+    li a2, 2
+    li a7, 66           # writev
+    ecall
+    mv s4, a0
+
+    li a0, 7
+    li a7, 94           # exit_group
+    ecall
+
+msg1:
+    .ascii "hello "
+msg2:
+    .ascii "world\n"
+    .align 3
+iov:
+    .dword msg1, 6, msg2, 6
+tid:
+    .dword 0
+winsize:
+    .dword 0
+`, linux)
+
+	vm.Run()
+
+	want := map[int]int64{
+		9:  1,
+		18: -risbee.RISBEE_LINUX_ENOTTY,
+		19: -risbee.RISBEE_LINUX_ENOSYS,
+		20: 12,
+	}
+
+	for register, value := range want {
+		if int64(vm.Registers[register]) != value {
+			t.Errorf("x%d = %d, want %d", register, int64(vm.Registers[register]), value)
+		}
+	}
+
+	if stdout.String() != "hello world\n" {
+		t.Errorf("stdout %q", stdout.String())
+	}
+
+	if vm.ExitCode != 7 {
+		t.Errorf("exit code %d", vm.ExitCode)
+	}
+}
+
+func TestLinuxMmap(t *testing.T) {
+	vm := newLinuxVm(t, `
+    li a0, 0
+    li a1, 8192
+    li a3, 0x22         # MAP_PRIVATE | MAP_ANONYMOUS
+    li a7, 222
+    ecall
+    mv s1, a0           # Highest free range below the stack
+
+    li t0, 0x10000
+    sub a0, s1, t0
+    li a1, 4096
+    li a3, 0x22
+    li a7, 222
+    ecall
+    mv s2, a0           # Free hint, honored
+
+    mv a0, s1
+    li a1, 4096
+    li a3, 0x22
+    li a7, 222
+    ecall
+    mv s3, a0           # Hint over a mapping, moved
+
+    li t0, 0xAA
+    sb t0, 0(s1)
+    mv a0, s1
+    li a1, 4096
+    li a3, 0x32         # MAP_FIXED
+    li a7, 222
+    ecall
+    mv s4, a0
+    lbu s5, 0(s1)       # Cleared by the new mapping
+
+    mv a0, s1
+    li a1, 4096
+    li a3, 0x100022     # MAP_FIXED_NOREPLACE
+    li a7, 222
+    ecall
+    mv s6, a0
+
+    addi a0, s1, 1
+    li a1, 4096
+    li a3, 0x32
+    li a7, 222
+    ecall
+    mv s7, a0
+
+    mv a0, s1
+    li a1, 8192
+    li a7, 215          # munmap
+    ecall
+
+    li a0, 0
+    li a1, 8192
+    li a3, 0x22
+    li a7, 222
+    ecall
+    mv s8, a0           # The unmapped range again
+
+    li a0, 0
+    li a7, 94
+    ecall
+`, &risbee.RisbeeLinux{})
+
+	vm.Run()
+
+	first := uint64(0xF00000 - 8192)
+	want := map[int]uint64{
+		9:  first,
+		18: first - 0x10000,
+		20: first,
+		21: 0,
+		22: uint64(1<<64 - risbee.RISBEE_LINUX_EEXIST),
+		23: uint64(1<<64 - risbee.RISBEE_LINUX_EINVAL),
+		24: first,
+	}
+
+	for register, value := range want {
+		if vm.Registers[register] != value {
+			t.Errorf("x%d = 0x%x, want 0x%x", register, vm.Registers[register], value)
+		}
+	}
+
+	if moved := vm.Registers[19]; moved == first || moved == first-0x10000 {
+		t.Errorf("hint over a mapping returned 0x%x", moved)
+	}
+}
+
+func TestLinuxOpenatBadPath(t *testing.T) {
+	vm := newLinuxVm(t, `
+    li a0, -100         # AT_FDCWD
+    li a1, 0
+    li a7, 56           # openat
+    ecall
+    mv s1, a0
+
+    la t0, path
+    li t1, 5000
+    li t2, 0x61
+fill:
+    sb t2, 0(t0)
+    addi t0, t0, 1
+    addi t1, t1, -1
+    bnez t1, fill
+
+    li a0, -100
+    la a1, path
+    li a7, 56
+    ecall
+    mv s2, a0
+
+    li a0, 0
+    li a7, 94
+    ecall
+
+path:
+    .zero 5001
+`, &risbee.RisbeeLinux{})
+
+	vm.Run()
+
+	want := map[int]int64{
+		9:  -risbee.RISBEE_LINUX_EFAULT,
+		18: -risbee.RISBEE_LINUX_ENAMETOOLONG,
+	}
+
+	for register, value := range want {
+		if int64(vm.Registers[register]) != value {
+			t.Errorf("x%d = %d, want %d", register, int64(vm.Registers[register]), value)
+		}
+	}
+}
+
+func TestLinuxLseekHugeOffset(t *testing.T) {
+	linux := &risbee.RisbeeLinux{MaxFile: 1 << 20}
+	vm := newLinuxVm(t, `
+    li a0, -100         # AT_FDCWD
+    la a1, path
+    li a2, 0x41         # O_WRONLY | O_CREAT
+    li a7, 56           # openat
+    ecall
+    mv s1, a0
+
+    mv a0, s1
+    li a1, 1
+    slli a1, a1, 40
+    li a2, 0            # SEEK_SET
+    li a7, 62           # lseek
+    ecall
+    mv s2, a0
+
+    mv a0, s1
+    li a1, 0x7fffffffffffffff
+    li a2, 0
+    li a7, 62
+    ecall
+    mv s3, a0
+
+    mv a0, s1
+    li a1, 0xffffe      # two bytes below the limit
+    li a2, 0
+    li a7, 62
+    ecall
+    mv s4, a0
+
+    mv a0, s1
+    la a1, data
+    li a2, 4
+    li a7, 64           # write
+    ecall
+    mv s5, a0
+
+    mv a0, s1
+    li a1, 0x7fffffffffffffff
+    li a2, 1            # SEEK_CUR
+    li a7, 62
+    ecall
+    mv s6, a0
+
+    mv a0, s1
+    la a1, data
+    li a2, 2
+    li a7, 64
+    ecall
+    mv s7, a0
+
+    li a0, 0
+    li a7, 94           # exit_group
+    ecall
+
+path:
+    .asciz "out"
+data:
+    .ascii "abcd"
+`, linux)
+
+	vm.Run()
+
+	want := map[int]int64{
+		18: -risbee.RISBEE_LINUX_EINVAL,
+		19: -risbee.RISBEE_LINUX_EINVAL,
+		20: 1<<20 - 2,
+		21: -risbee.RISBEE_LINUX_EFBIG,
+		22: -risbee.RISBEE_LINUX_EINVAL,
+		23: 2,
+	}
+
+	for register, value := range want {
+		if int64(vm.Registers[register]) != value {
+			t.Errorf("x%d = %d, want %d", register, int64(vm.Registers[register]), value)
+		}
+	}
+
+	data, ok := linux.File("out")
+	if !ok || len(data) != 1<<20 || string(data[len(data)-2:]) != "ab" {
+		t.Errorf("file has %d bytes", len(data))
+	}
+}
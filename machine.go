@@ -0,0 +1,157 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import "sync"
+
+// RisbeeMachine groups several harts (hardware threads) that
+// share one byte-addressable memory. Every hart is a regular
+// RisbeeVm with its own registers, program counter and CSRs,
+// and can identify itself through the mhartid CSR.
+//
+// Loading a program into any hart, or installing a
+// personality that grows its memory, replaces the memory of
+// every hart, so they never diverge. This must not happen
+// while harts run in parallel.
+type RisbeeMachine struct {
+	Memory  []byte      // Memory shared by all harts
+	Harts   []*RisbeeVm // Harts of the machine, indexed by hart ID
+	Quantum uint64      // Instructions per hart per round-robin turn
+}
+
+// This function initializes the machine with the given
+// number of harts. Each hart is initialized like a single
+// RisbeeVm and gets its index assigned to mhartid.
+//
+// Parameters:
+//   - hartCount Number of harts to create
+//   - exitCallback Callback triggered when any hart
+//     invokes the exit system call
+//   - panicCallback Callback for encountered panic errors
+func (machine *RisbeeMachine) Initialize(
+	hartCount int,
+	exitCallback func(uint64),
+	panicCallback func(string),
+) {
+	machine.Memory = nil
+	machine.Harts = make([]*RisbeeVm, hartCount)
+	machine.Quantum = 1
+
+	for id := range machine.Harts {
+		hart := &RisbeeVm{}
+		hart.Initialize(exitCallback, panicCallback)
+		hart.WriteCsr(RISBEE_CSR_MHARTID, uint64(id))
+		hart.machine = machine
+
+		machine.Harts[id] = hart
+	}
+}
+
+// LoadFromBytes copies the program image into the shared
+// memory at the fixed load offset and points every hart
+// at it. All harts start at the same entry point, so the
+// guest is expected to branch on mhartid and set up a
+// separate stack per hart.
+func (machine *RisbeeMachine) LoadFromBytes(Data []byte) bool {
+	if len(machine.Harts) == 0 ||
+		!machine.Harts[0].LoadFromBytes(Data) {
+		return false
+	}
+
+	for _, hart := range machine.Harts[1:] {
+		hart.Registers[2] = machine.Harts[0].Registers[2]
+	}
+
+	return true
+}
+
+// Replaces the memory of the VM, and of every other hart if
+// it belongs to a machine.
+func (vm *RisbeeVm) setMemory(memory []byte) {
+	vm.Memory = memory
+	if vm.machine == nil {
+		return
+	}
+
+	vm.machine.Memory = memory
+	for _, hart := range vm.machine.Harts {
+		hart.Memory = memory
+	}
+}
+
+// SetSystemCall registers a syscall handler on every hart.
+// The handler receives the hart that executed the ECALL.
+func (machine *RisbeeMachine) SetSystemCall(
+	Address uint64,
+	Callback RisbeeVmSyscallFn,
+) {
+	for _, hart := range machine.Harts {
+		hart.SetSystemCall(Address, Callback)
+	}
+}
+
+// Run executes all harts deterministically in a single
+// goroutine. Harts take turns in hart ID order, each
+// executing up to Quantum instructions per turn, until
+// every hart has stopped. Harts suspended in a syscall are
+// skipped until they are resumed with Resume.
+func (machine *RisbeeMachine) Run() {
+	quantum := machine.Quantum
+	if quantum == 0 {
+		quantum = 1
+	}
+
+	for _, hart := range machine.Harts {
+		if !hart.IsSuspended() {
+			hart.Running = true
+		}
+	}
+
+	for machine.IsRunning() {
+		for _, hart := range machine.Harts {
+			for step := uint64(0); step < quantum && hart.Running; step++ {
+				hart.Step()
+			}
+		}
+	}
+}
+
+// RunParallel executes every hart on its own goroutine and
+// returns once all of them have stopped. Accesses to the
+// shared memory are not synchronized; the guest is
+// responsible for its own memory ordering.
+func (machine *RisbeeMachine) RunParallel() {
+	var group sync.WaitGroup
+
+	for _, hart := range machine.Harts {
+		group.Add(1)
+		go func(hart *RisbeeVm) {
+			defer group.Done()
+			hart.Run()
+		}(hart)
+	}
+
+	group.Wait()
+}
+
+// Stop halts every hart of the machine.
+func (machine *RisbeeMachine) Stop() {
+	for _, hart := range machine.Harts {
+		hart.Stop()
+	}
+}
+
+// IsRunning reports whether at least one hart is running.
+func (machine *RisbeeMachine) IsRunning() bool {
+	for _, hart := range machine.Harts {
+		if hart.Running {
+			return true
+		}
+	}
+
+	return false
+}
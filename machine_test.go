@@ -0,0 +1,189 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nthnn/risbee"
+	"github.com/nthnn/risbee/asm"
+)
+
+// Creates a machine of hartCount harts running the program
+// assembled from source.
+func newMachine(t *testing.T, hartCount int, source string) *risbee.RisbeeMachine {
+	t.Helper()
+
+	code, err := asm.Assemble(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machine := &risbee.RisbeeMachine{}
+	machine.Initialize(hartCount, func(uint64) {}, func(message string) {
+		t.Errorf("panic: %s", message)
+	})
+
+	if !machine.LoadFromBytes(code) {
+		t.Fatal("program not loaded")
+	}
+
+	return machine
+}
+
+func TestMachineHartId(t *testing.T) {
+	machine := newMachine(t, 3, `
+    csrr s1, mhartid
+    li a0, 0
+    li a7, 0
+    ecall
+`)
+
+	machine.Run()
+
+	for id, hart := range machine.Harts {
+		if hart.Registers[9] != uint64(id) {
+			t.Errorf("hart %d read mhartid %d", id, hart.Registers[9])
+		}
+	}
+}
+
+func TestMachineSharedMemory(t *testing.T) {
+	source := `
+    csrr t0, mhartid
+    la t1, flag
+    bnez t0, wait
+
+    li t2, 1234
+    sd t2, 0(t1)
+    li a0, 0
+    li a7, 0
+    ecall
+
+wait:
+    ld s1, 0(t1)
+    beqz s1, wait
+    li a0, 0
+    li a7, 0
+    ecall
+
+    .align 3
+flag:
+    .dword 0
+`
+	machine := newMachine(t, 2, "nop")
+
+	// Loading through one hart replaces the memory of all.
+	code, err := asm.Assemble(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine.Harts[1].LoadFromBytes(code)
+
+	for id, hart := range machine.Harts {
+		if len(hart.Memory) != len(machine.Memory) ||
+			&hart.Memory[0] != &machine.Memory[0] {
+			t.Fatalf("hart %d does not share the machine memory", id)
+		}
+	}
+
+	machine.Run()
+
+	if value := machine.Harts[1].Registers[9]; value != 1234 {
+		t.Errorf("hart 1 read %d, want 1234", value)
+	}
+}
+
+func TestMachineRoundRobin(t *testing.T) {
+	machine := newMachine(t, 2, `
+    csrr t0, mhartid
+    li t1, 5
+    beqz t0, loop
+    li t1, 20
+loop:
+    addi t1, t1, -1
+    bnez t1, loop
+    li a0, 0
+    li a7, 0
+    ecall
+`)
+	machine.Quantum = 3
+
+	var order []int
+	for id, hart := range machine.Harts {
+		hart.SetExecTracer(&risbee.RisbeeExecTracer{
+			Callback: func(risbee.RisbeeTraceEntry) {
+				order = append(order, id)
+			},
+		})
+	}
+
+	machine.Run()
+
+	if machine.IsRunning() {
+		t.Fatal("Run returned with a hart still running")
+	}
+
+	counts := []uint64{16, 47}
+	for id, hart := range machine.Harts {
+		if hart.Instret != counts[id] {
+			t.Errorf("hart %d executed %d instructions, want %d", id, hart.Instret, counts[id])
+		}
+	}
+
+	var want []int
+	var done [2]uint64
+	for done[0] < counts[0] || done[1] < counts[1] {
+		for id := range done {
+			turn := min(machine.Quantum, counts[id]-done[id])
+			for range turn {
+				want = append(want, id)
+			}
+
+			done[id] += turn
+		}
+	}
+
+	if !slices.Equal(order, want) {
+		t.Errorf("harts ran in order\n%v\nwant\n%v", order, want)
+	}
+}
+
+func TestMachineSuspendedHart(t *testing.T) {
+	machine := newMachine(t, 2, `
+    li a7, 1
+    ecall
+    addi s1, a0, 1
+    li a0, 0
+    li a7, 0
+    ecall
+`)
+	machine.SetSystemCall(1, func(vm *risbee.RisbeeVm) uint64 {
+		return vm.Suspend()
+	})
+
+	machine.Run()
+
+	pcs := []uint64{machine.Harts[0].Pc, machine.Harts[1].Pc}
+	machine.Run()
+
+	for id, hart := range machine.Harts {
+		if !hart.IsSuspended() || hart.Pc != pcs[id] || hart.Registers[9] != 0 {
+			t.Fatalf("Run stepped suspended hart %d: suspended %v, pc 0x%x, s1 %d",
+				id, hart.IsSuspended(), hart.Pc, hart.Registers[9])
+		}
+	}
+
+	for id, hart := range machine.Harts {
+		hart.Resume(uint64(41 + id))
+		if hart.IsSuspended() || hart.IsRunning() || hart.Registers[9] != uint64(42+id) {
+			t.Errorf("hart %d after Resume: suspended %v, running %v, s1 %d",
+				id, hart.IsSuspended(), hart.IsRunning(), hart.Registers[9])
+		}
+	}
+}
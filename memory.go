@@ -0,0 +1,200 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrMemoryPermission is returned when a guest memory
+// range is protected against the requested access.
+var ErrMemoryPermission = errors.New("risbee: guest memory access not permitted")
+
+// ErrStringTooLong is returned by ReadCString when no NUL
+// terminator is found within the given limit.
+var ErrStringTooLong = errors.New("risbee: guest string exceeds limit")
+
+// Memory access permissions for ProtectMemory.
+const (
+	RISBEE_MEM_READ  = 1 << 0 // Range may be read
+	RISBEE_MEM_WRITE = 1 << 1 // Range may be written
+)
+
+// RisbeeMemoryRegion restricts the access permitted to a
+// range of VM memory.
+type RisbeeMemoryRegion struct {
+	Start      uint64 // First address of the range
+	Size       uint64 // Size of the range in bytes
+	Permission uint64 // Allowed accesses (RISBEE_MEM_*)
+}
+
+// ProtectMemory limits the accesses allowed on the range
+// [Start, Start+Size). Both guest loads and stores and the
+// host accessors below honor it; a guest violation stops
+// the VM like any other fault. Later protections take
+// precedence where ranges overlap.
+func (vm *RisbeeVm) ProtectMemory(
+	Start uint64,
+	Size uint64,
+	Permission uint64,
+) {
+	vm.Protections = append(vm.Protections, RisbeeMemoryRegion{
+		Start:      Start,
+		Size:       Size,
+		Permission: Permission,
+	})
+}
+
+// Checks [addr, addr+size) against memory bounds and
+// protections for the given access.
+//
+// Returns nil if the access is allowed.
+func (vm *RisbeeVm) checkAccess(
+	addr uint64,
+	size uint64,
+	permission uint64,
+) error {
+	if !vm.inMemory(addr, size) {
+		return ErrMemoryOutOfRange
+	}
+
+	if len(vm.Protections) == 0 || size == 0 {
+		return nil
+	}
+
+	// Every byte is governed by the newest region covering
+	// it, so walk the regions newest first and check each
+	// against the parts of the access no newer one covers.
+	pending := [][2]uint64{{addr, addr + size}}
+	for index := len(vm.Protections) - 1; index >= 0 && len(pending) != 0; index-- {
+		region := &vm.Protections[index]
+		start, end := region.Start, region.Start+region.Size
+
+		var uncovered [][2]uint64
+		for _, part := range pending {
+			if part[1] <= start || end <= part[0] {
+				uncovered = append(uncovered, part)
+				continue
+			}
+
+			if region.Permission&permission != permission {
+				return ErrMemoryPermission
+			}
+
+			if part[0] < start {
+				uncovered = append(uncovered, [2]uint64{part[0], start})
+			}
+
+			if end < part[1] {
+				uncovered = append(uncovered, [2]uint64{end, part[1]})
+			}
+		}
+
+		pending = uncovered
+	}
+
+	return nil
+}
+
+// ReadMemory returns a copy of n bytes of guest memory
+// starting at Address.
+func (vm *RisbeeVm) ReadMemory(Address uint64, Size uint64) ([]byte, error) {
+	if err := vm.checkAccess(Address, Size, RISBEE_MEM_READ); err != nil {
+		return nil, err
+	}
+
+	return bytes.Clone(vm.Memory[Address : Address+Size]), nil
+}
+
+// WriteMemory copies Data into guest memory at Address.
+// Nothing is written if any part of the range is invalid.
+func (vm *RisbeeVm) WriteMemory(Address uint64, Data []byte) error {
+	size := uint64(len(Data))
+	if err := vm.checkAccess(Address, size, RISBEE_MEM_WRITE); err != nil {
+		return err
+	}
+
+	copy(vm.Memory[Address:Address+size], Data)
+	return nil
+}
+
+// ReadCString reads a NUL-terminated string at Address,
+// looking at no more than Max bytes. Unlike
+// GetStringPointer, pointer zero is not special-cased.
+//
+// Returns ErrStringTooLong if no terminator is found
+// within Max bytes.
+func (vm *RisbeeVm) ReadCString(Address uint64, Max uint64) (string, error) {
+	if Address >= uint64(len(vm.Memory)) {
+		return "", ErrMemoryOutOfRange
+	}
+
+	limit := min(Max, uint64(len(vm.Memory))-Address)
+	data := vm.Memory[Address : Address+limit]
+	end := bytes.IndexByte(data, 0)
+
+	// Only the bytes up to the terminator need to be
+	// readable, the string may end right before a
+	// protected range.
+	checked := limit
+	if end >= 0 {
+		checked = uint64(end) + 1
+	}
+
+	if err := vm.checkAccess(Address, checked, RISBEE_MEM_READ); err != nil {
+		return "", err
+	}
+
+	if end < 0 {
+		if limit < Max {
+			return "", ErrMemoryOutOfRange
+		}
+
+		return "", ErrStringTooLong
+	}
+
+	return string(data[:end]), nil
+}
+
+// ReadUint32 reads a little-endian 32-bit value at Address.
+func (vm *RisbeeVm) ReadUint32(Address uint64) (uint32, error) {
+	if err := vm.checkAccess(Address, 4, RISBEE_MEM_READ); err != nil {
+		return 0, err
+	}
+
+	return uint32LittleEndian(vm.Memory[Address:]), nil
+}
+
+// ReadUint64 reads a little-endian 64-bit value at Address.
+func (vm *RisbeeVm) ReadUint64(Address uint64) (uint64, error) {
+	if err := vm.checkAccess(Address, 8, RISBEE_MEM_READ); err != nil {
+		return 0, err
+	}
+
+	return uint64LittleEndian(vm.Memory[Address:]), nil
+}
+
+// WriteUint32 writes a little-endian 32-bit value at Address.
+func (vm *RisbeeVm) WriteUint32(Address uint64, Value uint32) error {
+	if err := vm.checkAccess(Address, 4, RISBEE_MEM_WRITE); err != nil {
+		return err
+	}
+
+	putUint32(vm.Memory[Address:], Value)
+	return nil
+}
+
+// WriteUint64 writes a little-endian 64-bit value at Address.
+func (vm *RisbeeVm) WriteUint64(Address uint64, Value uint64) error {
+	if err := vm.checkAccess(Address, 8, RISBEE_MEM_WRITE); err != nil {
+		return err
+	}
+
+	putUint64(vm.Memory[Address:], Value)
+	return nil
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"errors"
+	"testing"
+)
+
+// An access straddling two regions needs both to allow it,
+// whichever was added last.
+func TestProtectMemoryStraddle(t *testing.T) {
+	vm := &RisbeeVm{Memory: make([]byte, 0x4000)}
+	vm.ProtectMemory(0x1000, 0x1000, RISBEE_MEM_READ)
+	vm.ProtectMemory(0x2000, 0x1000, RISBEE_MEM_READ|RISBEE_MEM_WRITE)
+
+	if err := vm.WriteUint64(0x1FFC, 0); !errors.Is(err, ErrMemoryPermission) {
+		t.Fatalf("straddling write: %v", err)
+	}
+
+	if err := vm.WriteUint64(0x2000, 0); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if _, err := vm.ReadUint64(0x1FFC); err != nil {
+		t.Fatalf("straddling read: %v", err)
+	}
+
+	// A newer region overrides the older ones only where it
+	// covers them.
+	vm.ProtectMemory(0x1FF8, 0x10, RISBEE_MEM_READ|RISBEE_MEM_WRITE)
+	if err := vm.WriteUint64(0x1FFC, 0); err != nil {
+		t.Fatalf("overridden write: %v", err)
+	}
+
+	if err := vm.WriteUint64(0x1FF4, 0); !errors.Is(err, ErrMemoryPermission) {
+		t.Fatalf("partly overridden write: %v", err)
+	}
+}
+
+func TestReadCString(t *testing.T) {
+	vm := &RisbeeVm{Memory: make([]byte, 0x3000)}
+	copy(vm.Memory[0x1FFA:], "guest\x00")
+	vm.ProtectMemory(0x2000, 0x1000, 0)
+
+	if str, err := vm.ReadCString(0x1FFA, 4096); err != nil || str != "guest" {
+		t.Fatalf("got %q, %v", str, err)
+	}
+
+	copy(vm.Memory[0x1000:], "unterminated")
+	if _, err := vm.ReadCString(0x1000, 8); !errors.Is(err, ErrStringTooLong) {
+		t.Fatalf("long string: %v", err)
+	}
+
+	copy(vm.Memory[0x1FFA:], "guest!")
+	if _, err := vm.ReadCString(0x1FFA, 4096); !errors.Is(err, ErrMemoryPermission) {
+		t.Fatalf("string into protected memory: %v", err)
+	}
+}
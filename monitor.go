@@ -0,0 +1,642 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Help text of the monitor.
+const monitorHelp = `Commands:
+  s, step [n]            execute n instructions (default 1)
+  c, continue            run until a breakpoint, watchpoint, fault or exit
+  b, break <loc>         set a breakpoint at an address or symbol
+  d, delete <loc>        remove a breakpoint
+  breaks                 list breakpoints and watchpoints
+  r, regs                show registers
+  bt, backtrace          show the guest call stack
+  set <reg> <value>      set a register or pc
+  x <loc> [len]          hex-dump memory (default 64 bytes)
+  dis [loc] [n]          disassemble n instructions (default 10 at pc)
+  watch <loc> [len]      stop when memory is written
+  rwatch <loc> [len]     stop when memory is read
+  awatch <loc> [len]     stop when memory is read or written
+  unwatch <loc>          remove watchpoints starting at loc
+  rs, rstep [n]          undo n recorded instructions (default 1)
+  rc, rcontinue          run backwards to a breakpoint
+  lastwrite <loc>        show the last recorded write to an address
+  q, quit                leave the monitor
+Locations are numbers, symbols, registers or symbol+offset.
+`
+
+// A monitor watchpoint.
+type monitorWatch struct {
+	id      int
+	address uint64
+	length  uint64
+	read    bool
+	write   bool
+}
+
+// RisbeeMonitor is an interactive command-line monitor for
+// inspecting and controlling a VM: stepping, breakpoints on
+// addresses or symbols, register and memory dumps with
+// disassembly, and memory watchpoints. It works directly on
+// the VM state, so a program that faults can be examined
+// afterwards.
+type RisbeeMonitor struct {
+	Vm     *RisbeeVm // VM under control
+	Input  io.Reader // Source of commands
+	Output io.Writer // Destination of responses
+
+	breaks  map[uint64]bool
+	watches []monitorWatch
+	hit     string
+	fault   string
+	exited  bool
+}
+
+// Run reads and executes commands until "quit" or the end
+// of Input. The VM's exit callback is held back while the
+// monitor runs and invoked once it returns if the guest
+// exited; the panic callback still runs on a fault, which
+// the monitor then reports too.
+func (monitor *RisbeeMonitor) Run() error {
+	vm := monitor.Vm
+	if monitor.breaks == nil {
+		monitor.breaks = map[uint64]bool{}
+	}
+
+	exitCallback := vm.ExitCallback
+	panicCallback := vm.PanicCallback
+
+	vm.ExitCallback = func(code uint64) {
+		monitor.exited = true
+		vm.Stop()
+	}
+
+	vm.PanicCallback = func(message string) {
+		monitor.fault = message
+		if panicCallback != nil {
+			panicCallback(message)
+		}
+	}
+
+	// Watchpoints are only registered while the monitor runs.
+	for index := range monitor.watches {
+		monitor.addWatch(&monitor.watches[index])
+	}
+
+	defer func() {
+		vm.ExitCallback = exitCallback
+		vm.PanicCallback = panicCallback
+
+		for _, watch := range monitor.watches {
+			vm.RemoveWatchpoint(watch.id)
+		}
+
+		if monitor.exited && exitCallback != nil {
+			exitCallback(uint64(vm.ExitCode))
+		}
+	}()
+
+	monitor.showLocation()
+	scanner := bufio.NewScanner(monitor.Input)
+
+	for {
+		fmt.Fprint(monitor.Output, "(risbee) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(monitor.Output)
+			return scanner.Err()
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "q" || fields[0] == "quit" {
+			return nil
+		}
+
+		if err := monitor.execute(fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(monitor.Output, "error: %v\n", err)
+		}
+	}
+}
+
+// Executes a single command.
+func (monitor *RisbeeMonitor) execute(command string, args []string) error {
+	vm := monitor.Vm
+
+	switch command {
+	case "h", "help":
+		fmt.Fprint(monitor.Output, monitorHelp)
+
+	case "s", "step":
+		count := uint64(1)
+		if len(args) > 0 {
+			value, err := strconv.ParseUint(args[0], 0, 64)
+			if err != nil {
+				return err
+			}
+
+			count = value
+		}
+
+		monitor.resume(count)
+
+	case "c", "continue":
+		monitor.resume(0)
+
+	case "rs", "rstep":
+		count := uint64(1)
+		if len(args) > 0 {
+			value, err := strconv.ParseUint(args[0], 0, 64)
+			if err != nil {
+				return err
+			}
+
+			count = value
+		}
+
+		monitor.reverse(count)
+
+	case "rc", "rcontinue":
+		monitor.reverse(0)
+
+	case "lastwrite":
+		if len(args) != 1 {
+			return fmt.Errorf("lastwrite needs a location")
+		}
+
+		address, err := monitor.location(args[0])
+		if err != nil {
+			return err
+		}
+
+		if vm.Recorder == nil {
+			return fmt.Errorf("recording is not enabled")
+		}
+
+		write, ok := vm.LastWriter(address)
+		if !ok {
+			fmt.Fprintf(monitor.Output, "no recorded write to %s\n", monitor.describe(address))
+			break
+		}
+
+		fmt.Fprintf(monitor.Output, "%s written by pc %s at instruction %d: %x -> %x\n",
+			monitor.describe(write.Address), monitor.describe(write.Pc),
+			write.Instret, write.Old, write.New)
+
+	case "b", "break", "d", "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("%s needs a location", command)
+		}
+
+		address, err := monitor.location(args[0])
+		if err != nil {
+			return err
+		}
+
+		if command[0] == 'b' {
+			monitor.breaks[address] = true
+			fmt.Fprintf(monitor.Output, "breakpoint at %s\n", monitor.describe(address))
+		} else {
+			delete(monitor.breaks, address)
+		}
+
+	case "breaks":
+		addresses := make([]uint64, 0, len(monitor.breaks))
+		for address := range monitor.breaks {
+			addresses = append(addresses, address)
+		}
+
+		sort.Slice(addresses, func(i, j int) bool {
+			return addresses[i] < addresses[j]
+		})
+
+		for _, address := range addresses {
+			fmt.Fprintf(monitor.Output, "break  %s\n", monitor.describe(address))
+		}
+
+		for _, watch := range monitor.watches {
+			fmt.Fprintf(monitor.Output, "%-6s %s len %d\n",
+				watchName(watch), monitor.describe(watch.address), watch.length)
+		}
+
+	case "r", "regs":
+		monitor.showRegisters()
+
+	case "bt", "backtrace":
+		for index, frame := range vm.Backtrace() {
+			fmt.Fprintf(monitor.Output, "#%d %s\n", index, frame)
+		}
+
+	case "set":
+		if len(args) != 2 {
+			return fmt.Errorf("set needs a register and a value")
+		}
+
+		value, err := monitor.location(args[1])
+		if err != nil {
+			return err
+		}
+
+		if args[0] == "pc" {
+			vm.Pc = value
+			return nil
+		}
+
+		index, ok := registerIndex(args[0])
+		if !ok {
+			return fmt.Errorf("unknown register %s", args[0])
+		}
+
+		if index != 0 {
+			vm.Registers[index] = value
+		}
+
+	case "x":
+		if len(args) < 1 {
+			return fmt.Errorf("x needs a location")
+		}
+
+		return monitor.hexDump(args)
+
+	case "dis":
+		return monitor.disassemble(args)
+
+	case "watch", "rwatch", "awatch":
+		if len(args) < 1 {
+			return fmt.Errorf("%s needs a location", command)
+		}
+
+		address, err := monitor.location(args[0])
+		if err != nil {
+			return err
+		}
+
+		length := uint64(8)
+		if len(args) > 1 {
+			if length, err = strconv.ParseUint(args[1], 0, 64); err != nil {
+				return err
+			}
+		}
+
+		watch := monitorWatch{
+			address: address,
+			length:  length,
+			read:    command != "watch",
+			write:   command != "rwatch",
+		}
+
+		monitor.addWatch(&watch)
+		monitor.watches = append(monitor.watches, watch)
+
+	case "unwatch":
+		if len(args) != 1 {
+			return fmt.Errorf("unwatch needs a location")
+		}
+
+		address, err := monitor.location(args[0])
+		if err != nil {
+			return err
+		}
+
+		kept := monitor.watches[:0]
+		for _, watch := range monitor.watches {
+			if watch.address != address {
+				kept = append(kept, watch)
+			} else {
+				monitor.Vm.RemoveWatchpoint(watch.id)
+			}
+		}
+
+		monitor.watches = kept
+
+	default:
+		return fmt.Errorf("unknown command %s (try help)", command)
+	}
+
+	return nil
+}
+
+// Runs count instructions, or until something stops the
+// VM when count is zero, and reports where it stopped.
+func (monitor *RisbeeMonitor) resume(count uint64) {
+	vm := monitor.Vm
+
+	switch {
+	case monitor.exited:
+		fmt.Fprintf(monitor.Output, "program exited with code %d\n", vm.ExitCode)
+		return
+
+	case monitor.fault != "":
+		fmt.Fprintf(monitor.Output, "program faulted: %s\n", monitor.fault)
+		return
+
+	case vm.IsSuspended():
+		fmt.Fprintln(monitor.Output, "program suspended in a syscall awaiting Resume")
+		return
+	}
+
+	vm.Running = true
+	for executed := uint64(0); count == 0 || executed < count; executed++ {
+		if executed > 0 && monitor.breaks[vm.Pc] {
+			fmt.Fprintf(monitor.Output, "breakpoint at %s\n", monitor.describe(vm.Pc))
+			break
+		}
+
+		vm.Step()
+
+		if monitor.exited {
+			fmt.Fprintf(monitor.Output, "program exited with code %d\n", vm.ExitCode)
+			return
+		}
+
+		if monitor.fault != "" {
+			fmt.Fprintf(monitor.Output, "program faulted: %s\n", monitor.fault)
+			break
+		}
+
+		if monitor.hit != "" {
+			fmt.Fprintln(monitor.Output, monitor.hit)
+			monitor.hit = ""
+			break
+		}
+
+		if vm.IsSuspended() {
+			fmt.Fprintln(monitor.Output, "program suspended in a syscall awaiting Resume")
+			break
+		}
+
+		if !vm.Running {
+			fmt.Fprintln(monitor.Output, "program stopped")
+			break
+		}
+	}
+
+	vm.Running = false
+	monitor.showLocation()
+}
+
+// Undoes count recorded instructions, or runs backwards
+// to a breakpoint when count is zero, and reports where it
+// stopped.
+func (monitor *RisbeeMonitor) reverse(count uint64) {
+	vm := monitor.Vm
+	if vm.Recorder == nil {
+		fmt.Fprintln(monitor.Output, "error: recording is not enabled")
+		return
+	}
+
+	for executed := uint64(0); count == 0 || executed < count; executed++ {
+		if !vm.StepBack() {
+			fmt.Fprintln(monitor.Output, "start of recorded history")
+			break
+		}
+
+		monitor.exited = false
+		monitor.fault = ""
+
+		if count == 0 && monitor.breaks[vm.Pc] {
+			fmt.Fprintf(monitor.Output, "breakpoint at %s\n", monitor.describe(vm.Pc))
+			break
+		}
+	}
+
+	monitor.showLocation()
+}
+
+// Registers a monitor watchpoint with the VM.
+func (monitor *RisbeeMonitor) addWatch(watch *monitorWatch) {
+	kind := uint64(0)
+	if watch.read {
+		kind |= RISBEE_WATCH_READ
+	}
+
+	if watch.write {
+		kind |= RISBEE_WATCH_WRITE
+	}
+
+	watch.id = monitor.Vm.AddWatchpoint(watch.address, watch.length, kind, monitor.watchHit)
+}
+
+// Notes the first watchpoint hit while resuming.
+func (monitor *RisbeeMonitor) watchHit(vm *RisbeeVm, Event RisbeeWatchEvent) {
+	if monitor.hit != "" {
+		return
+	}
+
+	if !Event.Write {
+		monitor.hit = fmt.Sprintf("read of %d bytes at %s by pc %s: 0x%x",
+			Event.Size, monitor.describe(Event.Address),
+			monitor.describe(Event.Pc), Event.NewValue)
+		return
+	}
+
+	monitor.hit = fmt.Sprintf("write of %d bytes at %s by pc %s: 0x%x -> 0x%x",
+		Event.Size, monitor.describe(Event.Address),
+		monitor.describe(Event.Pc), Event.OldValue, Event.NewValue)
+}
+
+// Prints the current program counter and instruction.
+func (monitor *RisbeeMonitor) showLocation() {
+	vm := monitor.Vm
+	if !vm.inMemory(vm.Pc, 4) {
+		fmt.Fprintf(monitor.Output, "pc %s (outside memory)\n", monitor.describe(vm.Pc))
+		return
+	}
+
+	inst := uint32LittleEndian(vm.Memory[vm.Pc:])
+	fmt.Fprintf(monitor.Output, "pc %s: %08x  %s\n",
+		monitor.describe(vm.Pc), inst, Disassemble(inst, vm.Pc))
+}
+
+// Prints all registers with their ABI names.
+func (monitor *RisbeeMonitor) showRegisters() {
+	vm := monitor.Vm
+
+	for index, name := range RisbeeRegisterNames {
+		separator := "  "
+		if index%4 == 3 {
+			separator = "\n"
+		}
+
+		fmt.Fprintf(monitor.Output, "%-4s 0x%016x%s", name, vm.Registers[index], separator)
+	}
+
+	fmt.Fprintf(monitor.Output, "pc   0x%016x\n", vm.Pc)
+}
+
+// Prints memory as hex and ASCII, 16 bytes per line.
+func (monitor *RisbeeMonitor) hexDump(args []string) error {
+	address, err := monitor.location(args[0])
+	if err != nil {
+		return err
+	}
+
+	length := uint64(64)
+	if len(args) > 1 {
+		if length, err = strconv.ParseUint(args[1], 0, 64); err != nil {
+			return err
+		}
+	}
+
+	if address >= uint64(len(monitor.Vm.Memory)) {
+		return ErrMemoryOutOfRange
+	}
+
+	length = min(length, uint64(len(monitor.Vm.Memory))-address)
+
+	data := monitor.Vm.Memory[address : address+length]
+	for offset := 0; offset < len(data); offset += 16 {
+		line := data[offset:min(offset+16, len(data))]
+		fmt.Fprintf(monitor.Output, "%08x  ", address+uint64(offset))
+
+		for index := 0; index < 16; index++ {
+			if index < len(line) {
+				fmt.Fprintf(monitor.Output, "%02x ", line[index])
+			} else {
+				fmt.Fprint(monitor.Output, "   ")
+			}
+		}
+
+		text := []byte(string(line))
+		for index, char := range text {
+			if char < 0x20 || char > 0x7E {
+				text[index] = '.'
+			}
+		}
+
+		fmt.Fprintf(monitor.Output, " |%s|\n", text)
+	}
+
+	return nil
+}
+
+// Disassembles instructions starting at a location.
+func (monitor *RisbeeMonitor) disassemble(args []string) error {
+	vm := monitor.Vm
+	address, count := vm.Pc, uint64(10)
+
+	var err error
+	if len(args) > 0 {
+		if address, err = monitor.location(args[0]); err != nil {
+			return err
+		}
+	}
+
+	if len(args) > 1 {
+		if count, err = strconv.ParseUint(args[1], 0, 64); err != nil {
+			return err
+		}
+	}
+
+	for ; count > 0 && vm.inMemory(address, 4); count-- {
+		if symbol, ok := vm.SymbolAt(address); ok && symbol.Address == address {
+			fmt.Fprintf(monitor.Output, "%s:\n", symbol.Name)
+		}
+
+		marker := "  "
+		if address == vm.Pc {
+			marker = "=>"
+		}
+
+		inst := uint32LittleEndian(vm.Memory[address:])
+		fmt.Fprintf(monitor.Output, "%s %8x:  %08x  %s\n",
+			marker, address, inst, Disassemble(inst, address))
+
+		address += 4
+	}
+
+	return nil
+}
+
+// Resolves a location: a number, a register, a symbol, or a
+// symbol or register followed by +offset or -offset.
+func (monitor *RisbeeMonitor) location(text string) (uint64, error) {
+	base, offset, sign := text, "", uint64(1)
+	if index := strings.LastIndexAny(text, "+-"); index > 0 {
+		base, offset = text[:index], text[index+1:]
+		if text[index] == '-' {
+			sign = ^uint64(0)
+		}
+	}
+
+	var value uint64
+	if number, err := strconv.ParseUint(base, 0, 64); err == nil {
+		value = number
+	} else if base == "pc" {
+		value = monitor.Vm.Pc
+	} else if index, ok := registerIndex(base); ok {
+		value = monitor.Vm.Registers[index]
+	} else if address, ok := monitor.Vm.LookupSymbol(base); ok {
+		value = address
+	} else {
+		return 0, fmt.Errorf("unknown location %s", base)
+	}
+
+	if offset != "" {
+		delta, err := strconv.ParseUint(offset, 0, 64)
+		if err != nil {
+			return 0, err
+		}
+
+		value += sign * delta
+	}
+
+	return value, nil
+}
+
+// Formats an address, with its symbol if one covers it.
+func (monitor *RisbeeMonitor) describe(address uint64) string {
+	symbol, ok := monitor.Vm.SymbolAt(address)
+	switch {
+	case !ok:
+		return fmt.Sprintf("0x%x", address)
+
+	case symbol.Address == address:
+		return fmt.Sprintf("0x%x <%s>", address, symbol.Name)
+	}
+
+	return fmt.Sprintf("0x%x <%s+0x%x>", address, symbol.Name, address-symbol.Address)
+}
+
+// Names the kind of a watchpoint.
+func watchName(watch monitorWatch) string {
+	switch {
+	case watch.read && watch.write:
+		return "awatch"
+
+	case watch.read:
+		return "rwatch"
+	}
+
+	return "watch"
+}
+
+// Looks up a register by ABI name or as x0–x31.
+func registerIndex(name string) (int, bool) {
+	for index, abiName := range RisbeeRegisterNames {
+		if name == abiName || name == "x"+strconv.Itoa(index) {
+			return index, true
+		}
+	}
+
+	if name == "fp" {
+		return 8, true
+	}
+
+	return 0, false
+}
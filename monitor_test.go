@@ -0,0 +1,44 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// A fault inside the monitor reaches the VM's own panic
+// callback, and the original callback is back afterwards.
+func TestMonitorChainsPanicCallback(t *testing.T) {
+	var messages []string
+	vm := &RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(message string) {
+		messages = append(messages, message)
+	})
+	vm.LoadFromBytes(make([]byte, 4))
+
+	var output bytes.Buffer
+	monitor := &RisbeeMonitor{
+		Vm:     vm,
+		Input:  strings.NewReader("continue\n"),
+		Output: &output,
+	}
+
+	if err := monitor.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 1 || !strings.Contains(output.String(), "program faulted") {
+		t.Fatalf("messages %q, output %q", messages, output.String())
+	}
+
+	vm.PanicCallback("after")
+	if len(messages) != 2 {
+		t.Fatal("panic callback not restored")
+	}
+}
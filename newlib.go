@@ -0,0 +1,214 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// Syscall codes used by the C runtime support layer in
+// scripts/crt0.s and scripts/syscalls.c. Exit reuses the
+// built-in code 0. Handlers return a negative errno on
+// failure, which the C stubs store into errno.
+const (
+	RISBEE_NEWLIB_SYS_WRITE  = 0x20 // write(fd, buf, count)
+	RISBEE_NEWLIB_SYS_READ   = 0x21 // read(fd, buf, count)
+	RISBEE_NEWLIB_SYS_CLOSE  = 0x22 // close(fd)
+	RISBEE_NEWLIB_SYS_FSTAT  = 0x23 // fstat(fd), returns st_mode
+	RISBEE_NEWLIB_SYS_ISATTY = 0x24 // isatty(fd)
+	RISBEE_NEWLIB_SYS_LSEEK  = 0x25 // lseek(fd, offset, whence)
+	RISBEE_NEWLIB_SYS_SBRK   = 0x26 // sbrk(increment, _end)
+)
+
+// Error numbers understood by newlib and picolibc.
+const (
+	RISBEE_NEWLIB_EBADF  = 9  // Bad file descriptor
+	RISBEE_NEWLIB_ENOMEM = 12 // Out of memory
+	RISBEE_NEWLIB_EFAULT = 14 // Bad address
+	RISBEE_NEWLIB_ESPIPE = 29 // Illegal seek
+)
+
+// RisbeeNewlib implements the host side of the C runtime
+// support layer, which lets guests link against newlib or
+// picolibc for printf, malloc and friends. Only the three
+// standard streams exist; the heap grows from the _end
+// symbol reported by the guest up to StackSize bytes below
+// the top of memory.
+type RisbeeNewlib struct {
+	Stdin      io.Reader // Standard input (defaults to os.Stdin)
+	Stdout     io.Writer // Standard output (defaults to os.Stdout)
+	Stderr     io.Writer // Standard error (defaults to os.Stderr)
+	MemorySize uint64    // Guest memory size (defaults to 4 MiB)
+	StackSize  uint64    // Stack reserved at the memory top (defaults to 256 KiB)
+
+	brk uint64
+}
+
+// Install grows the VM memory to MemorySize so that .bss,
+// heap and stack fit, points the stack pointer at the top
+// of memory and registers the support syscalls. It must be
+// called after the program was loaded.
+//
+// Returns an error if the stack does not fit in memory.
+func (newlib *RisbeeNewlib) Install(vm *RisbeeVm) error {
+	if newlib.MemorySize == 0 {
+		newlib.MemorySize = 4 << 20
+	}
+
+	if newlib.StackSize == 0 {
+		newlib.StackSize = 256 << 10
+	}
+
+	if newlib.StackSize >= newlib.MemorySize {
+		return errors.New("risbee: newlib stack does not fit in memory")
+	}
+
+	if newlib.Stdin == nil {
+		newlib.Stdin = os.Stdin
+	}
+
+	if newlib.Stdout == nil {
+		newlib.Stdout = os.Stdout
+	}
+
+	if newlib.Stderr == nil {
+		newlib.Stderr = os.Stderr
+	}
+
+	if uint64(len(vm.Memory)) < newlib.MemorySize {
+		memory := make([]byte, newlib.MemorySize)
+		copy(memory, vm.Memory)
+
+		vm.setMemory(memory)
+	}
+
+	newlib.brk = 0
+	vm.Registers[2] = uint64(len(vm.Memory)) &^ 15
+
+	vm.SetSystemCall(RISBEE_NEWLIB_SYS_WRITE, newlib.sysWrite)
+	vm.SetSystemCall(RISBEE_NEWLIB_SYS_READ, newlib.sysRead)
+	vm.SetSystemCall(RISBEE_NEWLIB_SYS_CLOSE, newlib.sysClose)
+	vm.SetSystemCall(RISBEE_NEWLIB_SYS_FSTAT, newlib.sysFstat)
+	vm.SetSystemCall(RISBEE_NEWLIB_SYS_ISATTY, newlib.sysIsatty)
+	vm.SetSystemCall(RISBEE_NEWLIB_SYS_LSEEK, newlib.sysLseek)
+	vm.SetSystemCall(RISBEE_NEWLIB_SYS_SBRK, newlib.sysSbrk)
+	return nil
+}
+
+// Converts an error number into the syscall return value.
+func newlibError(errno uint64) uint64 {
+	return -errno
+}
+
+// Returns the guest memory slice for the buffer passed in
+// a1 and a2, or nil if it does not permit the access.
+func newlibBuffer(vm *RisbeeVm, permission uint64) []byte {
+	addr := vm.GetPointerParam(1)
+	size := vm.GetPointerParam(2)
+
+	if vm.checkAccess(addr, size, permission) != nil {
+		return nil
+	}
+
+	return vm.Memory[addr : addr+size]
+}
+
+func (newlib *RisbeeNewlib) sysWrite(vm *RisbeeVm) uint64 {
+	var writer io.Writer
+	switch vm.GetPointerParam(0) {
+	case 1:
+		writer = newlib.Stdout
+
+	case 2:
+		writer = newlib.Stderr
+
+	default:
+		return newlibError(RISBEE_NEWLIB_EBADF)
+	}
+
+	buffer := newlibBuffer(vm, RISBEE_MEM_READ)
+	if buffer == nil {
+		return newlibError(RISBEE_NEWLIB_EFAULT)
+	}
+
+	count, _ := writer.Write(buffer)
+	return uint64(count)
+}
+
+func (newlib *RisbeeNewlib) sysRead(vm *RisbeeVm) uint64 {
+	if vm.GetPointerParam(0) != 0 {
+		return newlibError(RISBEE_NEWLIB_EBADF)
+	}
+
+	buffer := newlibBuffer(vm, RISBEE_MEM_WRITE)
+	if buffer == nil {
+		return newlibError(RISBEE_NEWLIB_EFAULT)
+	}
+
+	count, _ := newlib.Stdin.Read(buffer)
+	return uint64(count)
+}
+
+func (newlib *RisbeeNewlib) sysClose(vm *RisbeeVm) uint64 {
+	if vm.GetPointerParam(0) > 2 {
+		return newlibError(RISBEE_NEWLIB_EBADF)
+	}
+
+	return 0
+}
+
+func (newlib *RisbeeNewlib) sysFstat(vm *RisbeeVm) uint64 {
+	if vm.GetPointerParam(0) > 2 {
+		return newlibError(RISBEE_NEWLIB_EBADF)
+	}
+
+	return 0o020000 // S_IFCHR
+}
+
+func (newlib *RisbeeNewlib) sysIsatty(vm *RisbeeVm) uint64 {
+	if vm.GetPointerParam(0) > 2 {
+		return 0
+	}
+
+	return 1
+}
+
+func (newlib *RisbeeNewlib) sysLseek(vm *RisbeeVm) uint64 {
+	if vm.GetPointerParam(0) > 2 {
+		return newlibError(RISBEE_NEWLIB_EBADF)
+	}
+
+	return newlibError(RISBEE_NEWLIB_ESPIPE)
+}
+
+func (newlib *RisbeeNewlib) sysSbrk(vm *RisbeeVm) uint64 {
+	increment := int64(vm.GetPointerParam(0))
+	if uint64(len(vm.Memory)) <= newlib.StackSize {
+		return newlibError(RISBEE_NEWLIB_ENOMEM)
+	}
+
+	limit := uint64(len(vm.Memory)) - newlib.StackSize
+
+	// The initial break comes from the guest, so keep it
+	// within the heap area.
+	if newlib.brk == 0 {
+		newlib.brk = min(alignUp(min(vm.GetPointerParam(1), limit), 16), limit)
+	}
+	next := newlib.brk + uint64(increment)
+
+	if (increment > 0 && (next > limit || next < newlib.brk)) ||
+		(increment < 0 && next > newlib.brk) {
+		return newlibError(RISBEE_NEWLIB_ENOMEM)
+	}
+
+	previous := newlib.brk
+	newlib.brk = next
+
+	return previous
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nthnn/risbee"
+	"github.com/nthnn/risbee/asm"
+)
+
+// Loads a program assembled from source into a VM with the
+// C runtime support installed, and runs it.
+func runNewlib(t *testing.T, source string, newlib *risbee.RisbeeNewlib) *risbee.RisbeeVm {
+	t.Helper()
+
+	code, err := asm.Assemble(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := &risbee.RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(message string) {
+		t.Errorf("panic: %s", message)
+	})
+
+	vm.LoadFromBytes(code)
+	if err := newlib.Install(vm); err != nil {
+		t.Fatal(err)
+	}
+
+	vm.Run()
+	return vm
+}
+
+// Compares registers, as signed values, against the
+// expected ones.
+func checkSigned(t *testing.T, vm *risbee.RisbeeVm, want map[int]int64) {
+	t.Helper()
+
+	for register, value := range want {
+		if int64(vm.Registers[register]) != value {
+			t.Errorf("x%d = %d, want %d", register, int64(vm.Registers[register]), value)
+		}
+	}
+}
+
+func TestNewlibSbrk(t *testing.T) {
+	newlib := &risbee.RisbeeNewlib{MemorySize: 1 << 20, StackSize: 64 << 10}
+	vm := runNewlib(t, `
+    li a0, 0
+    li a1, 0x2001       # _end, rounded up to 16
+    li a7, 0x26         # sbrk
+    ecall
+    mv s1, a0
+
+    li a0, 4096
+    li a7, 0x26
+    ecall
+    mv s2, a0
+
+    li a0, 0
+    li a7, 0x26
+    ecall
+    mv s3, a0
+
+    li a0, 0xf0000      # past the stack area
+    li a7, 0x26
+    ecall
+    mv s4, a0
+
+    li a0, -4096
+    li a7, 0x26
+    ecall
+    mv s5, a0
+
+    li a0, 0
+    li a7, 0x26
+    ecall
+    mv s6, a0
+
+    li a0, 0
+    li a7, 0
+    ecall
+`, newlib)
+
+	checkSigned(t, vm, map[int]int64{
+		9:  0x2010,
+		18: 0x2010,
+		19: 0x3010,
+		20: -risbee.RISBEE_NEWLIB_ENOMEM,
+		21: 0x3010,
+		22: 0x2010,
+	})
+}
+
+func TestNewlibSbrkInitialBreak(t *testing.T) {
+	newlib := &risbee.RisbeeNewlib{MemorySize: 1 << 20, StackSize: 64 << 10}
+	vm := runNewlib(t, `
+    li a0, 0
+    li a1, -1           # _end outside of memory
+    li a7, 0x26         # sbrk
+    ecall
+    mv s1, a0
+
+    li a0, 16
+    li a7, 0x26
+    ecall
+    mv s2, a0
+
+    li a0, 0
+    li a7, 0
+    ecall
+`, newlib)
+
+	checkSigned(t, vm, map[int]int64{
+		9:  1<<20 - 64<<10,
+		18: -risbee.RISBEE_NEWLIB_ENOMEM,
+	})
+}
+
+func TestNewlibInstallStackTooLarge(t *testing.T) {
+	vm := &risbee.RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(string) {})
+	vm.LoadFromBytes([]byte{0x13, 0, 0, 0})
+
+	newlib := &risbee.RisbeeNewlib{MemorySize: 64 << 10, StackSize: 1 << 20}
+	if err := newlib.Install(vm); err == nil {
+		t.Error("Install accepted a stack larger than memory")
+	}
+}
+
+func TestNewlibStreams(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	newlib := &risbee.RisbeeNewlib{
+		Stdin:  strings.NewReader("input"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+
+	vm := runNewlib(t, `
+    li a0, 0
+    la a1, buffer
+    li a2, 8
+    li a7, 0x21         # read
+    ecall
+    mv s1, a0
+
+    li a0, 1
+    la a1, buffer
+    mv a2, s1
+    li a7, 0x20         # write
+    ecall
+    mv s2, a0
+
+    li a0, 2
+    la a1, message
+    li a2, 5
+    li a7, 0x20
+    ecall
+    mv s3, a0
+
+    li a0, 3
+    la a1, message
+    li a2, 5
+    li a7, 0x20
+    ecall
+    mv s4, a0
+
+    li a0, 1
+    li a1, -8           # outside of memory
+    li a2, 8
+    li a7, 0x20
+    ecall
+    mv s5, a0
+
+    li a0, 1
+    li a7, 0x23         # fstat
+    ecall
+    mv s6, a0
+
+    li a0, 1
+    li a7, 0x24         # isatty
+    ecall
+    mv s7, a0
+
+    li a0, 1
+    li a1, 0
+    li a2, 0
+    li a7, 0x25         # lseek
+    ecall
+    mv s8, a0
+
+    li a0, 5
+    li a7, 0x22         # close
+    ecall
+    mv s9, a0
+
+    li a0, 7
+    li a7, 0            # exit
+    ecall
+
+message:
+    .ascii "error"
+buffer:
+    .zero 8
+`, newlib)
+
+	checkSigned(t, vm, map[int]int64{
+		9:  5,
+		18: 5,
+		19: 5,
+		20: -risbee.RISBEE_NEWLIB_EBADF,
+		21: -risbee.RISBEE_NEWLIB_EFAULT,
+		22: 0o020000,
+		23: 1,
+		24: -risbee.RISBEE_NEWLIB_ESPIPE,
+		25: -risbee.RISBEE_NEWLIB_EBADF,
+	})
+
+	if stdout.String() != "input" || stderr.String() != "error" {
+		t.Errorf("stdout %q, stderr %q", stdout.String(), stderr.String())
+	}
+
+	if vm.ExitCode != 7 {
+		t.Errorf("exit code %d, want 7", vm.ExitCode)
+	}
+}
@@ -0,0 +1,297 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RisbeeProfiler measures where a guest program spends its
+// instructions. With SampleEvery at 0 or 1 every executed
+// instruction is counted; otherwise one instruction in
+// SampleEvery is. Each sample records the guest call stack,
+// unwound through the frame pointer (s0), so programs
+// should be built with -fno-omit-frame-pointer for
+// complete stacks.
+//
+// WriteProfile emits the samples in the pprof format, with
+// functions named after the ELF symbols of the VM, for use
+// with `go tool pprof`.
+type RisbeeProfiler struct {
+	SampleEvery uint64 // Instructions per sample, 0 or 1 for all
+	MaxDepth    int    // Frames unwound per sample, 0 for 64
+
+	counts    map[uint64]uint64
+	stacks    map[string]uint64
+	countdown uint64
+	frames    []uint64
+	key       []byte
+	start     time.Time
+	lock      sync.Mutex
+}
+
+// SetProfiler starts profiling the VM with Profiler,
+// clearing the samples it holds. Passing nil disables
+// profiling.
+func (vm *RisbeeVm) SetProfiler(Profiler *RisbeeProfiler) {
+	if Profiler != nil {
+		Profiler.lock.Lock()
+		Profiler.counts = map[uint64]uint64{}
+		Profiler.stacks = map[string]uint64{}
+		Profiler.countdown = 0
+		Profiler.start = time.Now()
+		Profiler.lock.Unlock()
+	}
+
+	vm.Profiler = Profiler
+}
+
+// Counts returns the number of samples taken at each
+// program counter.
+func (profiler *RisbeeProfiler) Counts() map[uint64]uint64 {
+	profiler.lock.Lock()
+	defer profiler.lock.Unlock()
+
+	counts := make(map[uint64]uint64, len(profiler.counts))
+	for pc, count := range profiler.counts {
+		counts[pc] = count
+	}
+
+	return counts
+}
+
+// Samples the instruction vm is about to execute.
+func (profiler *RisbeeProfiler) sample(vm *RisbeeVm) {
+	if profiler.SampleEvery > 1 {
+		if profiler.countdown > 0 {
+			profiler.countdown--
+			return
+		}
+
+		profiler.countdown = profiler.SampleEvery - 1
+	}
+
+	depth := profiler.MaxDepth
+	if depth <= 0 {
+		depth = 64
+	}
+
+	profiler.frames = vm.callStack(profiler.frames[:0], depth)
+	profiler.key = profiler.key[:0]
+
+	for _, pc := range profiler.frames {
+		profiler.key = binary.LittleEndian.AppendUint64(profiler.key, pc)
+	}
+
+	profiler.lock.Lock()
+	profiler.counts[vm.Pc]++
+	profiler.stacks[string(profiler.key)]++
+	profiler.lock.Unlock()
+}
+
+// SaveProfile writes the profile of vm to a file.
+func (profiler *RisbeeProfiler) SaveProfile(vm *RisbeeVm, Path string) error {
+	file, err := os.Create(Path)
+	if err != nil {
+		return err
+	}
+
+	if err := profiler.WriteProfile(vm, file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// WriteProfile writes the samples as a gzip-compressed
+// pprof protocol buffer, resolving function names through
+// the symbols of vm. Every program counter becomes its own
+// location, so that `go tool pprof -addresses` can show
+// instruction-level costs.
+func (profiler *RisbeeProfiler) WriteProfile(vm *RisbeeVm, Writer io.Writer) error {
+	profiler.lock.Lock()
+	defer profiler.lock.Unlock()
+
+	period := max(profiler.SampleEvery, 1)
+	builder := profileBuilder{
+		strings:   map[string]uint64{"": 0},
+		functions: map[string]uint64{},
+		locations: map[uint64]uint64{},
+		table:     []string{""},
+	}
+
+	var profile profileBuffer
+	for _, sampleType := range [][2]string{
+		{"samples", "count"},
+		{"instructions", "count"},
+	} {
+		var valueType profileBuffer
+		valueType.uint(1, builder.text(sampleType[0]))
+		valueType.uint(2, builder.text(sampleType[1]))
+		profile.message(1, valueType)
+	}
+
+	keys := make([]string, 0, len(profiler.stacks))
+	for key := range profiler.stacks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		count := profiler.stacks[key]
+		ids := make([]uint64, 0, len(key)/8)
+
+		for offset := 0; offset < len(key); offset += 8 {
+			pc := binary.LittleEndian.Uint64([]byte(key[offset : offset+8]))
+			ids = append(ids, builder.location(vm, pc))
+		}
+
+		var sample profileBuffer
+		sample.packed(1, ids)
+		sample.packed(2, []uint64{count, count * period})
+		profile.message(2, sample)
+	}
+
+	var mapping profileBuffer
+	mapping.uint(1, 1)
+	mapping.uint(3, uint64(len(vm.Memory)))
+	mapping.uint(5, builder.text("risbee"))
+	mapping.uint(7, 1)
+	profile.message(3, mapping)
+
+	var periodType profileBuffer
+	periodType.uint(1, builder.text("instructions"))
+	periodType.uint(2, builder.text("count"))
+
+	profile.data = append(profile.data, builder.locationData.data...)
+	profile.data = append(profile.data, builder.functionData.data...)
+
+	for _, text := range builder.table {
+		profile.bytes(6, []byte(text))
+	}
+
+	profile.uint(9, uint64(profiler.start.UnixNano()))
+	profile.uint(10, uint64(time.Since(profiler.start)))
+	profile.message(11, periodType)
+	profile.uint(12, period)
+
+	compressor := gzip.NewWriter(Writer)
+	if _, err := compressor.Write(profile.data); err != nil {
+		return fmt.Errorf("cannot write profile: %w", err)
+	}
+
+	return compressor.Close()
+}
+
+// Collects the locations, functions and strings of a pprof
+// profile while its samples are encoded.
+type profileBuilder struct {
+	strings      map[string]uint64
+	functions    map[string]uint64
+	locations    map[uint64]uint64
+	table        []string
+	locationData profileBuffer
+	functionData profileBuffer
+}
+
+// Returns the string table index of text.
+func (builder *profileBuilder) text(text string) uint64 {
+	if index, ok := builder.strings[text]; ok {
+		return index
+	}
+
+	index := uint64(len(builder.table))
+	builder.strings[text] = index
+	builder.table = append(builder.table, text)
+
+	return index
+}
+
+// Returns the location ID of a program counter, adding
+// the location and its function on first use.
+func (builder *profileBuilder) location(vm *RisbeeVm, pc uint64) uint64 {
+	if id, ok := builder.locations[pc]; ok {
+		return id
+	}
+
+	id := uint64(len(builder.locations) + 1)
+	builder.locations[pc] = id
+
+	var location profileBuffer
+	location.uint(1, id)
+	location.uint(2, 1)
+	location.uint(3, pc)
+
+	if symbol, ok := vm.SymbolAt(pc); ok {
+		var line profileBuffer
+		line.uint(1, builder.function(symbol.Name))
+		location.message(4, line)
+	}
+
+	builder.locationData.message(4, location)
+	return id
+}
+
+// Returns the function ID of a symbol name, adding the
+// function on first use.
+func (builder *profileBuilder) function(name string) uint64 {
+	if id, ok := builder.functions[name]; ok {
+		return id
+	}
+
+	id := uint64(len(builder.functions) + 1)
+	builder.functions[name] = id
+
+	var function profileBuffer
+	function.uint(1, id)
+	function.uint(2, builder.text(name))
+	function.uint(3, builder.text(name))
+	builder.functionData.message(5, function)
+
+	return id
+}
+
+// A minimal protocol buffer encoder for pprof profiles.
+type profileBuffer struct {
+	data []byte
+}
+
+// Appends a varint field.
+func (buffer *profileBuffer) uint(field uint64, value uint64) {
+	buffer.data = binary.AppendUvarint(buffer.data, field<<3)
+	buffer.data = binary.AppendUvarint(buffer.data, value)
+}
+
+// Appends a length-delimited field.
+func (buffer *profileBuffer) bytes(field uint64, value []byte) {
+	buffer.data = binary.AppendUvarint(buffer.data, field<<3|2)
+	buffer.data = binary.AppendUvarint(buffer.data, uint64(len(value)))
+	buffer.data = append(buffer.data, value...)
+}
+
+// Appends an embedded message field.
+func (buffer *profileBuffer) message(field uint64, value profileBuffer) {
+	buffer.bytes(field, value.data)
+}
+
+// Appends a packed repeated varint field.
+func (buffer *profileBuffer) packed(field uint64, values []uint64) {
+	var packed []byte
+	for _, value := range values {
+		packed = binary.AppendUvarint(packed, value)
+	}
+
+	buffer.bytes(field, packed)
+}
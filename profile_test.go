@@ -0,0 +1,280 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/nthnn/risbee"
+	"github.com/nthnn/risbee/asm"
+)
+
+// Calls work ten times, which loops a hundred times.
+const profileSource = `
+main:
+    li s1, 10
+again:
+    call work
+    addi s1, s1, -1
+    bnez s1, again
+    li a0, 0
+    li a7, 0
+    ecall
+
+work:
+    li t0, 100
+loop:
+    addi t0, t0, -1
+    bnez t0, loop
+    ret
+`
+
+// Runs profileSource under a profiler sampling every
+// SampleEvery instructions, with main and work as symbols.
+func runProfiled(t *testing.T, sampleEvery uint64) (*risbee.RisbeeVm, *risbee.RisbeeProfiler, *asm.Program) {
+	t.Helper()
+
+	program, err := asm.AssembleAt(profileSource, asm.DefaultBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := &risbee.RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(message string) {
+		t.Errorf("panic: %s", message)
+	})
+	vm.LoadFromBytes(program.Code)
+
+	for _, name := range []string{"main", "work"} {
+		vm.Symbols = append(vm.Symbols, risbee.RisbeeSymbol{
+			Name:    name,
+			Address: program.Symbols[name],
+		})
+	}
+	sort.Slice(vm.Symbols, func(i, j int) bool {
+		return vm.Symbols[i].Address < vm.Symbols[j].Address
+	})
+
+	profiler := &risbee.RisbeeProfiler{SampleEvery: sampleEvery}
+	vm.SetProfiler(profiler)
+	vm.Run()
+
+	return vm, profiler, program
+}
+
+func TestProfilerCounts(t *testing.T) {
+	vm, profiler, program := runProfiled(t, 0)
+	counts := profiler.Counts()
+
+	want := map[string]uint64{
+		"main":  1,
+		"again": 10,
+		"work":  10,
+		"loop":  1000,
+	}
+
+	for label, count := range want {
+		if got := counts[program.Symbols[label]]; got != count {
+			t.Errorf("%s sampled %d times, want %d", label, got, count)
+		}
+	}
+
+	var total uint64
+	for _, count := range counts {
+		total += count
+	}
+
+	if total != vm.Instret || total != 2064 {
+		t.Errorf("%d samples for %d instructions, want 2064", total, vm.Instret)
+	}
+}
+
+// A decoded pprof profile, reduced to what the tests check.
+type decodedProfile struct {
+	samples   [][2]uint64       // Sample and instruction counts
+	period    uint64            // Instructions per sample
+	functions map[string]uint64 // Sample counts by leaf function
+}
+
+// A field of an encoded protocol buffer message.
+type protoField struct {
+	number  uint64 // Field number
+	value   uint64 // Varint value, or payload length
+	payload []byte // Contents of length-delimited fields
+}
+
+// Splits a protocol buffer message into its fields.
+func protoFields(t *testing.T, data []byte) []protoField {
+	t.Helper()
+
+	var fields []protoField
+
+	for len(data) > 0 {
+		key, size := binary.Uvarint(data)
+		if size <= 0 {
+			t.Fatal("malformed field key")
+		}
+		data = data[size:]
+
+		value, size := binary.Uvarint(data)
+		if size <= 0 {
+			t.Fatal("malformed field value")
+		}
+		data = data[size:]
+
+		field := protoField{number: key >> 3, value: value}
+
+		switch key & 7 {
+		case 0:
+		case 2:
+			field.payload = data[:value]
+			data = data[value:]
+
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// Decodes a packed repeated varint field.
+func protoPacked(data []byte) []uint64 {
+	var values []uint64
+	for len(data) > 0 {
+		value, size := binary.Uvarint(data)
+		values = append(values, value)
+		data = data[size:]
+	}
+
+	return values
+}
+
+// Decompresses and decodes a profile written by
+// WriteProfile.
+func decodeProfile(t *testing.T, data []byte) decodedProfile {
+	t.Helper()
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var strings []string
+	var samples [][]uint64
+	var values [][]uint64
+	locations := map[uint64]uint64{}     // Location ID to function ID
+	functionNames := map[uint64]uint64{} // Function ID to string index
+	profile := decodedProfile{functions: map[string]uint64{}}
+
+	for _, field := range protoFields(t, raw) {
+		switch field.number {
+		case 2:
+			for _, sample := range protoFields(t, field.payload) {
+				switch sample.number {
+				case 1:
+					samples = append(samples, protoPacked(sample.payload))
+
+				case 2:
+					values = append(values, protoPacked(sample.payload))
+				}
+			}
+
+		case 4:
+			var id, function uint64
+			for _, location := range protoFields(t, field.payload) {
+				switch location.number {
+				case 1:
+					id = location.value
+
+				case 4:
+					function = protoFields(t, location.payload)[0].value
+				}
+			}
+			locations[id] = function
+
+		case 5:
+			var id, name uint64
+			for _, function := range protoFields(t, field.payload) {
+				switch function.number {
+				case 1:
+					id = function.value
+
+				case 2:
+					name = function.value
+				}
+			}
+			functionNames[id] = name
+
+		case 6:
+			strings = append(strings, string(field.payload))
+
+		case 12:
+			profile.period = field.value
+		}
+	}
+
+	for index, sample := range samples {
+		name := strings[functionNames[locations[sample[0]]]]
+		profile.samples = append(profile.samples, [2]uint64{values[index][0], values[index][1]})
+		profile.functions[name] += values[index][0]
+	}
+
+	return profile
+}
+
+func TestProfilerWriteProfile(t *testing.T) {
+	for _, sampleEvery := range []uint64{1, 4} {
+		vm, profiler, _ := runProfiled(t, sampleEvery)
+
+		var output bytes.Buffer
+		if err := profiler.WriteProfile(vm, &output); err != nil {
+			t.Fatal(err)
+		}
+
+		profile := decodeProfile(t, output.Bytes())
+		if profile.period != sampleEvery {
+			t.Errorf("period %d, want %d", profile.period, sampleEvery)
+		}
+
+		var samples, instructions uint64
+		for _, values := range profile.samples {
+			if values[1] != values[0]*sampleEvery {
+				t.Errorf("sample of %d counts %d instructions with SampleEvery %d",
+					values[0], values[1], sampleEvery)
+			}
+
+			samples += values[0]
+			instructions += values[1]
+		}
+
+		if want := (vm.Instret + sampleEvery - 1) / sampleEvery; samples != want {
+			t.Errorf("SampleEvery %d: %d samples, want %d", sampleEvery, samples, want)
+		}
+
+		if instructions < vm.Instret || instructions >= vm.Instret+sampleEvery {
+			t.Errorf("SampleEvery %d: %d instructions for %d executed",
+				sampleEvery, instructions, vm.Instret)
+		}
+
+		if sampleEvery == 1 && (profile.functions["main"] != 44 || profile.functions["work"] != 2020) {
+			t.Errorf("samples by function %v, want main 44 and work 2020", profile.functions)
+		}
+	}
+}
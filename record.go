@@ -0,0 +1,535 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+)
+
+// RisbeeMemoryWrite is a change of guest memory made by a
+// recorded instruction. Changes made by syscall handlers or
+// by devices are attributed to the ECALL or store that
+// caused them.
+type RisbeeMemoryWrite struct {
+	Instret uint64 // Instructions executed before the writer
+	Pc      uint64 // Address of the writing instruction
+	Address uint64 // First byte written
+	Old     []byte // Contents before the write
+	New     []byte // Contents after the write
+}
+
+// RisbeeRecorder keeps the execution history of a VM so
+// that it can be stepped backwards. Every instruction logs
+// the registers and memory it changed, and a full snapshot
+// of the VM is taken every SnapshotInterval instructions.
+// With MaxSteps set, whole snapshot intervals are dropped
+// from the start of the history as long as at least that
+// many instructions remain.
+//
+// Only VM state is recorded: device state and host-side
+// edits made between steps are not undone. Executing an
+// instruction after stepping back discards the undone
+// part of the history.
+//
+// Syscall handlers may write anywhere in guest memory, so
+// every ECALL copies the whole memory beforehand and
+// compares it afterwards, which costs time proportional
+// to the memory size. Stores to devices only do so for
+// devices that do not implement RisbeeDmaDevice; the
+// others have just the ranges they report watched.
+type RisbeeRecorder struct {
+	SnapshotInterval uint64 // Instructions between snapshots, 0 for 65536
+	MaxSteps         uint64 // Instructions kept, 0 for unlimited
+
+	steps     []recordStep
+	snapshots []recordSnapshot
+	position  int
+	current   *recordStep
+	before    [32]uint64
+	memory    []byte
+	watched   []RisbeeMemoryRegion
+	whole     bool
+	diffing   bool
+}
+
+// A register changed by a recorded instruction.
+type recordRegister struct {
+	index uint64
+	old   uint64
+	new   uint64
+}
+
+// The state a recorded instruction changed, before and
+// after it executed.
+type recordStep struct {
+	instret    uint64
+	pc         uint64
+	nextPc     uint64
+	registers  []recordRegister
+	writes     []RisbeeMemoryWrite
+	csrs       map[uint64]uint64
+	csrsAfter  map[uint64]uint64
+	memorySize int
+	sizeAfter  int
+	exitCode   int
+	exitAfter  int
+	suspended  bool
+	suspAfter  bool
+}
+
+// A full copy of the VM state taken before steps[index].
+type recordSnapshot struct {
+	index     int
+	instret   uint64
+	pc        uint64
+	registers [32]uint64
+	memory    []byte
+	csrs      map[uint64]uint64
+	exitCode  int
+	suspended bool
+}
+
+// SetRecorder enables execution recording on the VM and
+// clears the history of Recorder. Passing nil disables it.
+func (vm *RisbeeVm) SetRecorder(Recorder *RisbeeRecorder) {
+	if Recorder != nil {
+		Recorder.steps = nil
+		Recorder.snapshots = nil
+		Recorder.position = 0
+	}
+
+	vm.Recorder = Recorder
+}
+
+// StepBack undoes the last recorded instruction.
+//
+// Returns false if there is no recorded history left.
+func (vm *RisbeeVm) StepBack() bool {
+	recorder := vm.Recorder
+	if recorder == nil || recorder.position == 0 {
+		return false
+	}
+
+	recorder.position--
+	recorder.undo(vm, &recorder.steps[recorder.position])
+
+	return true
+}
+
+// ReverseContinue steps backwards until the program counter
+// reaches one of the given breakpoints or the start of the
+// recorded history.
+//
+// Returns true if a breakpoint was reached.
+func (vm *RisbeeVm) ReverseContinue(Breakpoints ...uint64) bool {
+	for vm.StepBack() {
+		if slices.Contains(Breakpoints, vm.Pc) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReplayTo moves the VM to the point in the recorded history
+// where Instret instructions had executed, backwards or
+// forwards, without running any guest code.
+//
+// Returns false if that point was not recorded.
+func (vm *RisbeeVm) ReplayTo(Instret uint64) bool {
+	recorder := vm.Recorder
+	if recorder == nil || len(recorder.steps) == 0 {
+		return false
+	}
+
+	first := recorder.steps[0].instret
+	if Instret < first || Instret-first > uint64(len(recorder.steps)) {
+		return false
+	}
+
+	target := int(Instret - first)
+	if target < recorder.position {
+		snapshot := recorder.snapshotBefore(target)
+		if snapshot != nil && target-snapshot.index < recorder.position-target {
+			snapshot.restore(vm)
+			recorder.position = snapshot.index
+		}
+	}
+
+	for recorder.position > target {
+		recorder.position--
+		recorder.undo(vm, &recorder.steps[recorder.position])
+	}
+
+	for recorder.position < target {
+		recorder.redo(vm, &recorder.steps[recorder.position])
+		recorder.position++
+	}
+
+	return true
+}
+
+// LastWriter finds the most recent recorded instruction
+// that changed the byte at Address.
+//
+// Returns the write, or false if none was recorded.
+func (vm *RisbeeVm) LastWriter(Address uint64) (RisbeeMemoryWrite, bool) {
+	if vm.Recorder == nil {
+		return RisbeeMemoryWrite{}, false
+	}
+
+	for index := vm.Recorder.position - 1; index >= 0; index-- {
+		writes := vm.Recorder.steps[index].writes
+
+		for write := len(writes) - 1; write >= 0; write-- {
+			length := uint64(max(len(writes[write].Old), len(writes[write].New)))
+			if Address >= writes[write].Address && Address-writes[write].Address < length {
+				return writes[write], true
+			}
+		}
+	}
+
+	return RisbeeMemoryWrite{}, false
+}
+
+// Prepares the record of the instruction about to execute.
+func (recorder *RisbeeRecorder) begin(vm *RisbeeVm) {
+	if recorder.position < len(recorder.steps) {
+		recorder.truncate()
+	}
+
+	interval := recorder.SnapshotInterval
+	if interval == 0 {
+		interval = 65536
+	}
+
+	last := recorder.snapshots
+	if len(last) == 0 || uint64(len(recorder.steps)-last[len(last)-1].index) >= interval {
+		recorder.snapshot(vm)
+	}
+
+	recorder.steps = append(recorder.steps, recordStep{
+		instret:    vm.Instret,
+		pc:         vm.Pc,
+		memorySize: len(vm.Memory),
+		exitCode:   vm.ExitCode,
+		suspended:  vm.suspended.Load(),
+	})
+
+	recorder.current = &recorder.steps[len(recorder.steps)-1]
+	recorder.before = vm.Registers
+
+	if vm.inMemory(vm.Pc, 4) &&
+		uint32LittleEndian(vm.Memory[vm.Pc:])&0x7F == RISBEE_OPINST_CALL {
+		recorder.current.csrs = maps.Clone(vm.Csrs)
+
+		// Syscall handlers may write guest memory directly.
+		recorder.watchMemory(vm, nil)
+	}
+}
+
+// Completes the record of the instruction just executed.
+func (recorder *RisbeeRecorder) end(vm *RisbeeVm) {
+	step := recorder.current
+	recorder.current = nil
+
+	for index := 1; index < len(vm.Registers); index++ {
+		if vm.Registers[index] != recorder.before[index] {
+			step.registers = append(step.registers, recordRegister{
+				index: uint64(index),
+				old:   recorder.before[index],
+				new:   vm.Registers[index],
+			})
+		}
+	}
+
+	if recorder.diffing {
+		recorder.diffing = false
+		recorder.diffMemory(vm, step)
+	}
+
+	if step.csrs != nil {
+		step.csrsAfter = maps.Clone(vm.Csrs)
+	}
+
+	step.nextPc = vm.Pc
+	step.sizeAfter = len(vm.Memory)
+	step.exitAfter = vm.ExitCode
+	step.suspAfter = vm.suspended.Load()
+
+	recorder.position = len(recorder.steps)
+	recorder.trim()
+}
+
+// Notes a store to memory made by the instruction being
+// recorded, given the previous contents.
+func (recorder *RisbeeRecorder) recordStore(
+	vm *RisbeeVm,
+	addr uint64,
+	size uint64,
+	old uint64,
+) {
+	step := recorder.current
+	if step == nil || recorder.diffing {
+		return
+	}
+
+	write := RisbeeMemoryWrite{
+		Instret: step.instret,
+		Pc:      step.pc,
+		Address: addr,
+		Old:     make([]byte, size),
+		New:     bytes.Clone(vm.Memory[addr : addr+size]),
+	}
+
+	for index := range write.Old {
+		write.Old[index] = byte(old >> (8 * index))
+	}
+
+	step.writes = append(step.writes, write)
+}
+
+// Copies the given ranges of guest memory, or all of it
+// when ranges is nil, so that changes made behind the VM's
+// back during the current instruction, by syscall handlers
+// or device DMA, can be found afterwards.
+func (recorder *RisbeeRecorder) watchMemory(
+	vm *RisbeeVm,
+	ranges []RisbeeMemoryRegion,
+) {
+	if recorder.current == nil || recorder.diffing {
+		return
+	}
+
+	recorder.whole = ranges == nil
+	if recorder.whole {
+		ranges = []RisbeeMemoryRegion{{Size: uint64(len(vm.Memory))}}
+	}
+
+	recorder.memory = recorder.memory[:0]
+	recorder.watched = recorder.watched[:0]
+
+	for _, region := range ranges {
+		start := min(region.Start, uint64(len(vm.Memory)))
+		end := start + min(region.Size, uint64(len(vm.Memory))-start)
+
+		recorder.memory = append(recorder.memory, vm.Memory[start:end]...)
+		recorder.watched = append(recorder.watched, RisbeeMemoryRegion{
+			Start: start,
+			Size:  end - start,
+		})
+	}
+
+	recorder.diffing = true
+}
+
+// Records every byte run that differs between the copies
+// taken by watchMemory and the current memory. When all of
+// memory was watched, growing or shrinking it is recorded
+// as well.
+func (recorder *RisbeeRecorder) diffMemory(vm *RisbeeVm, step *recordStep) {
+	copied := recorder.memory
+	size := uint64(len(vm.Memory))
+
+	for _, region := range recorder.watched {
+		old := copied[:region.Size]
+		copied = copied[region.Size:]
+
+		end := min(region.Start+region.Size, size)
+		if recorder.whole {
+			end = size
+		}
+
+		var new []byte
+		if region.Start < end {
+			new = vm.Memory[region.Start:end]
+		}
+
+		diffBytes(step, region.Start, old, new)
+	}
+}
+
+// Records the byte runs that differ between old and new,
+// two versions of guest memory at base, in pages so that
+// unchanged memory is skipped quickly.
+func diffBytes(step *recordStep, base uint64, old []byte, new []byte) {
+	const page = 4096
+
+	record := func(start int, end int, oldEnd int) {
+		step.writes = append(step.writes, RisbeeMemoryWrite{
+			Instret: step.instret,
+			Pc:      step.pc,
+			Address: base + uint64(start),
+			Old:     bytes.Clone(old[start:oldEnd]),
+			New:     bytes.Clone(new[start:end]),
+		})
+	}
+
+	size := min(len(old), len(new))
+	for index := 0; index < size; {
+		if index%page == 0 && index+page <= size &&
+			bytes.Equal(old[index:index+page], new[index:index+page]) {
+			index += page
+			continue
+		}
+
+		if index%64 == 0 && index+64 <= size &&
+			bytes.Equal(old[index:index+64], new[index:index+64]) {
+			index += 64
+			continue
+		}
+
+		if old[index] == new[index] {
+			index++
+			continue
+		}
+
+		start := index
+		for index < size && old[index] != new[index] {
+			index++
+		}
+
+		record(start, index, index)
+	}
+
+	if len(new) != len(old) {
+		record(size, len(new), len(old))
+	}
+}
+
+// Takes a full snapshot before the next step.
+func (recorder *RisbeeRecorder) snapshot(vm *RisbeeVm) {
+	recorder.snapshots = append(recorder.snapshots, recordSnapshot{
+		index:     len(recorder.steps),
+		instret:   vm.Instret,
+		pc:        vm.Pc,
+		registers: vm.Registers,
+		memory:    bytes.Clone(vm.Memory),
+		csrs:      maps.Clone(vm.Csrs),
+		exitCode:  vm.ExitCode,
+		suspended: vm.suspended.Load(),
+	})
+}
+
+// Returns the latest snapshot taken at or before the given
+// step, or nil if there is none.
+func (recorder *RisbeeRecorder) snapshotBefore(index int) *recordSnapshot {
+	for snapshot := len(recorder.snapshots) - 1; snapshot >= 0; snapshot-- {
+		if recorder.snapshots[snapshot].index <= index {
+			return &recorder.snapshots[snapshot]
+		}
+	}
+
+	return nil
+}
+
+// Discards the history after the current position.
+func (recorder *RisbeeRecorder) truncate() {
+	recorder.steps = recorder.steps[:recorder.position]
+
+	for len(recorder.snapshots) > 0 &&
+		recorder.snapshots[len(recorder.snapshots)-1].index > recorder.position {
+		recorder.snapshots = recorder.snapshots[:len(recorder.snapshots)-1]
+	}
+}
+
+// Drops the oldest snapshot interval while the history is
+// longer than MaxSteps, so that it always begins at a
+// snapshot.
+func (recorder *RisbeeRecorder) trim() {
+	if recorder.MaxSteps == 0 {
+		return
+	}
+
+	for len(recorder.snapshots) > 1 &&
+		uint64(len(recorder.steps)-recorder.snapshots[1].index) >= recorder.MaxSteps {
+		drop := recorder.snapshots[1].index
+
+		recorder.steps = slices.Delete(recorder.steps, 0, drop)
+		recorder.snapshots = slices.Delete(recorder.snapshots, 0, 1)
+		recorder.position -= drop
+
+		for index := range recorder.snapshots {
+			recorder.snapshots[index].index -= drop
+		}
+	}
+}
+
+// Restores the VM state from before a step.
+func (recorder *RisbeeRecorder) undo(vm *RisbeeVm, step *recordStep) {
+	if len(vm.Memory) != step.memorySize {
+		vm.Memory = resizeMemory(vm.Memory, step.memorySize)
+	}
+
+	for index := len(step.writes) - 1; index >= 0; index-- {
+		copy(vm.Memory[step.writes[index].Address:], step.writes[index].Old)
+	}
+
+	for _, register := range step.registers {
+		vm.Registers[register.index] = register.old
+	}
+
+	if step.csrs != nil {
+		vm.Csrs = maps.Clone(step.csrs)
+	}
+
+	vm.Pc = step.pc
+	vm.Instret = step.instret
+	vm.ExitCode = step.exitCode
+	vm.suspended.Store(step.suspended)
+}
+
+// Applies a recorded step again.
+func (recorder *RisbeeRecorder) redo(vm *RisbeeVm, step *recordStep) {
+	if len(vm.Memory) != step.sizeAfter {
+		vm.Memory = resizeMemory(vm.Memory, step.sizeAfter)
+	}
+
+	for _, write := range step.writes {
+		copy(vm.Memory[write.Address:], write.New)
+	}
+
+	for _, register := range step.registers {
+		vm.Registers[register.index] = register.new
+	}
+
+	if step.csrsAfter != nil {
+		vm.Csrs = maps.Clone(step.csrsAfter)
+	}
+
+	vm.Pc = step.nextPc
+	vm.Instret = step.instret + 1
+	vm.ExitCode = step.exitAfter
+	vm.suspended.Store(step.suspAfter)
+}
+
+// Restores the VM state captured by a snapshot.
+func (snapshot *recordSnapshot) restore(vm *RisbeeVm) {
+	vm.Memory = resizeMemory(vm.Memory, len(snapshot.memory))
+	copy(vm.Memory, snapshot.memory)
+
+	vm.Registers = snapshot.registers
+	vm.Csrs = maps.Clone(snapshot.csrs)
+	vm.Pc = snapshot.pc
+	vm.Instret = snapshot.instret
+	vm.ExitCode = snapshot.exitCode
+	vm.suspended.Store(snapshot.suspended)
+}
+
+// Returns memory resized to size bytes, keeping its contents.
+func resizeMemory(memory []byte, size int) []byte {
+	if size <= len(memory) {
+		return memory[:size]
+	}
+
+	resized := make([]byte, size)
+	copy(resized, memory)
+
+	return resized
+}
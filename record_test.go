@@ -0,0 +1,97 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// Returns a VM running program at 0x3800, with memory
+// below it free for the test.
+func newRecordedVm(t *testing.T, program ...uint32) *RisbeeVm {
+	vm := &RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(message string) {
+		t.Errorf("panic: %s", message)
+	})
+
+	vm.Memory = make([]byte, 0x4000)
+	for index, inst := range program {
+		putUint32(vm.Memory[0x3800+4*index:], inst)
+	}
+
+	vm.Pc = 0x3800
+	vm.Running = true
+	vm.SetRecorder(&RisbeeRecorder{})
+
+	return vm
+}
+
+// A syscall handler writing guest memory directly is
+// undone by stepping back over its ECALL.
+func TestRecorderSyscallWrites(t *testing.T) {
+	vm := newRecordedVm(t,
+		0x00100893, // li a7, 1
+		0x00000073, // ecall
+	)
+
+	vm.SetSystemCall(1, func(vm *RisbeeVm) uint64 {
+		copy(vm.Memory[0x2000:], "written")
+		return 0
+	})
+
+	vm.Step()
+	vm.Step()
+
+	if vm.Recorder.memory == nil || len(vm.Recorder.memory) != len(vm.Memory) {
+		t.Fatalf("ECALL watched %d bytes", len(vm.Recorder.memory))
+	}
+
+	vm.StepBack()
+	if !bytes.Equal(vm.Memory[0x2000:0x2007], make([]byte, 7)) {
+		t.Fatalf("memory %q", vm.Memory[0x2000:0x2007])
+	}
+}
+
+// A virtio request completed under recording watches only
+// the used ring and the buffers the device may write.
+func TestRecorderDeviceDma(t *testing.T) {
+	image, err := os.ReadFile("testdata/disk.img")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := newRecordedVm(t,
+		0x100002B7, // lui t0, 0x10000
+		0x0402A823, // sw zero, 0x50(t0)
+	)
+
+	var block RisbeeVirtioBlock
+	block.InitializeFromBytes(image, true)
+	virtioSetup(&block, vm, RISBEE_VIRTIO_BLK_T_IN, 1, make([]byte, 512))
+	vm.AttachDevice(0x10000000, 0x1000, &block)
+
+	vm.Step()
+	vm.Step()
+
+	if vm.Memory[testVirtioStatus] != RISBEE_VIRTIO_BLK_S_OK ||
+		!bytes.Equal(vm.Memory[testVirtioData:testVirtioData+512], image[512:1024]) {
+		t.Fatal("request not served")
+	}
+
+	if watched := len(vm.Recorder.memory); watched != 4+8*8+512+1 {
+		t.Fatalf("notification watched %d bytes", watched)
+	}
+
+	vm.StepBack()
+	if vm.Memory[testVirtioStatus] != 0xFF ||
+		!bytes.Equal(vm.Memory[testVirtioData:testVirtioData+512], make([]byte, 512)) ||
+		uint16LittleEndian(vm.Memory[testVirtioUsed+2:]) != 0 {
+		t.Fatal("request not undone")
+	}
+}
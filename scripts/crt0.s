@@ -0,0 +1,32 @@
+# C runtime startup for newlib/picolibc guests.
+#
+# The host (RisbeeNewlib.Install) points sp at the top of
+# memory. This stub sets up gp, clears .bss, runs static
+# constructors, calls main and passes its result to exit.
+
+.section .init, "ax"
+.global _start
+
+_start:
+    .option push
+    .option norelax
+    la      gp, __global_pointer$
+    .option pop
+
+    la      a0, __bss_start
+    la      a1, _end
+1:
+    bgeu    a0, a1, 2f
+    sb      zero, 0(a0)
+    addi    a0, a0, 1
+    j       1b
+2:
+    call    __libc_init_array
+
+    li      a0, 0
+    li      a1, 0
+    li      a2, 0
+    call    main
+    call    exit
+3:
+    j       3b
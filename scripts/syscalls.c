@@ -0,0 +1,118 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+/*
+ * System call stubs binding newlib and picolibc to the Risbee
+ * host. The syscall codes match the RISBEE_NEWLIB_SYS_*
+ * constants in newlib.go; handlers return a negative errno
+ * on failure. Link this file together with crt0.s.
+ */
+
+#include <errno.h>
+#include <stddef.h>
+#include <sys/stat.h>
+
+#undef errno
+extern int errno;
+
+#define RISBEE_SYS_EXIT   0x00
+#define RISBEE_SYS_WRITE  0x20
+#define RISBEE_SYS_READ   0x21
+#define RISBEE_SYS_CLOSE  0x22
+#define RISBEE_SYS_FSTAT  0x23
+#define RISBEE_SYS_ISATTY 0x24
+#define RISBEE_SYS_LSEEK  0x25
+#define RISBEE_SYS_SBRK   0x26
+
+extern char _end[];
+
+static inline long risbee_syscall(long code, long a0, long a1, long a2) {
+    register long r0 asm("a0") = a0;
+    register long r1 asm("a1") = a1;
+    register long r2 asm("a2") = a2;
+    register long scid asm("a7") = code;
+
+    asm volatile ("scall"
+        : "+r"(r0)
+        : "r"(r1), "r"(r2), "r"(scid)
+        : "memory");
+    return r0;
+}
+
+static long risbee_result(long result) {
+    if(result < 0) {
+        errno = (int) -result;
+        return -1;
+    }
+
+    return result;
+}
+
+void _exit(int status) {
+    risbee_syscall(RISBEE_SYS_EXIT, status, 0, 0);
+    for(;;);
+}
+
+int _write(int fd, const void* buf, size_t count) {
+    return risbee_result(risbee_syscall(RISBEE_SYS_WRITE, fd, (long) buf, count));
+}
+
+int _read(int fd, void* buf, size_t count) {
+    return risbee_result(risbee_syscall(RISBEE_SYS_READ, fd, (long) buf, count));
+}
+
+int _close(int fd) {
+    return risbee_result(risbee_syscall(RISBEE_SYS_CLOSE, fd, 0, 0));
+}
+
+int _fstat(int fd, struct stat* st) {
+    long mode = risbee_result(risbee_syscall(RISBEE_SYS_FSTAT, fd, 0, 0));
+    if(mode < 0)
+        return -1;
+
+    st->st_mode = (mode_t) mode;
+    st->st_blksize = 0;
+    return 0;
+}
+
+int _isatty(int fd) {
+    return (int) risbee_syscall(RISBEE_SYS_ISATTY, fd, 0, 0);
+}
+
+long _lseek(int fd, long offset, int whence) {
+    return risbee_result(risbee_syscall(RISBEE_SYS_LSEEK, fd, offset, whence));
+}
+
+void* _sbrk(ptrdiff_t increment) {
+    long result = risbee_syscall(RISBEE_SYS_SBRK, increment, (long) _end, 0);
+    if(result < 0) {
+        errno = (int) -result;
+        return (void*) -1;
+    }
+
+    return (void*) result;
+}
+
+int _kill(int pid, int sig) {
+    (void) pid;
+    (void) sig;
+
+    errno = EINVAL;
+    return -1;
+}
+
+int _getpid(void) {
+    return 1;
+}
+
+/* picolibc's POSIX console calls the unprefixed names. */
+int write(int fd, const void* buf, size_t count) __attribute__((weak, alias("_write")));
+int read(int fd, void* buf, size_t count) __attribute__((weak, alias("_read")));
+int close(int fd) __attribute__((weak, alias("_close")));
+int fstat(int fd, struct stat* st) __attribute__((weak, alias("_fstat")));
+int isatty(int fd) __attribute__((weak, alias("_isatty")));
+long lseek(int fd, long offset, int whence) __attribute__((weak, alias("_lseek")));
+void* sbrk(ptrdiff_t increment) __attribute__((weak, alias("_sbrk")));
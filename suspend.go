@@ -0,0 +1,49 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+// Suspend pauses the VM at the current ECALL. It is meant
+// to be called by a syscall handler that cannot complete
+// synchronously, typically as `return vm.Suspend()`: Run
+// then returns and releases the goroutine, and the result
+// of the syscall is supplied later through Resume, which
+// may be handed to another goroutine right away. The value
+// returned by the handler is discarded.
+func (vm *RisbeeVm) Suspend() uint64 {
+	vm.suspended.Store(true)
+	vm.Stop()
+
+	return 0
+}
+
+// IsSuspended reports whether the VM is paused at an ECALL
+// waiting for Resume. It is safe to call from any
+// goroutine.
+func (vm *RisbeeVm) IsSuspended() bool {
+	return vm.suspended.Load()
+}
+
+// Resume completes a suspended syscall with Value as its
+// result in a0 and continues execution on the calling
+// goroutine until the VM stops or suspends again. It may
+// be called from any goroutine, even before the suspending
+// Run has returned; it then waits for Run to finish. It
+// does nothing if the VM is not suspended.
+func (vm *RisbeeVm) Resume(Value uint64) {
+	vm.runLock.Lock()
+	defer vm.runLock.Unlock()
+
+	if !vm.suspended.Load() {
+		return
+	}
+
+	vm.Registers[10] = Value
+	vm.suspended.Store(false)
+
+	vm.Running = true
+	vm.loop()
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nthnn/risbee"
+	"github.com/nthnn/risbee/asm"
+)
+
+// Loads a program whose syscall 1 is answered by handler.
+func newSuspendVm(t *testing.T, source string, handler risbee.RisbeeVmSyscallFn) *risbee.RisbeeVm {
+	t.Helper()
+
+	code, err := asm.Assemble(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := &risbee.RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(message string) {
+		t.Errorf("panic: %s", message)
+	})
+
+	vm.LoadFromBytes(code)
+	vm.SetSystemCall(1, handler)
+
+	return vm
+}
+
+func TestSuspendResume(t *testing.T) {
+	done := make(chan struct{})
+	vm := newSuspendVm(t, `
+    li a7, 1
+    ecall
+    addi a0, a0, 1
+    li a7, 0
+    ecall
+`, func(vm *risbee.RisbeeVm) uint64 {
+		// Resume waits for Run to return.
+		go func() {
+			vm.Resume(41)
+			close(done)
+		}()
+
+		return vm.Suspend()
+	})
+
+	vm.Run()
+	<-done
+
+	if vm.IsSuspended() || vm.Registers[10] != 42 {
+		t.Fatalf("suspended %v, a0 %d", vm.IsSuspended(), vm.Registers[10])
+	}
+}
+
+func TestCallSuspended(t *testing.T) {
+	vm := newSuspendVm(t, `
+    li a7, 0
+    ecall
+function:
+    li a7, 1
+    ecall
+    ret
+`, func(vm *risbee.RisbeeVm) uint64 {
+		return vm.Suspend()
+	})
+
+	vm.Registers[10] = 7
+	if _, _, err := vm.Call(0x1008); !errors.Is(err, risbee.ErrCallSuspended) {
+		t.Fatalf("got %v", err)
+	}
+
+	if vm.IsSuspended() || vm.Pc != 0x1000 || vm.Registers[10] != 7 {
+		t.Fatalf("suspended %v, pc 0x%x, a0 %d", vm.IsSuspended(), vm.Pc, vm.Registers[10])
+	}
+}
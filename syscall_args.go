@@ -0,0 +1,357 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// ErrMemoryOutOfRange is returned when a guest pointer
+// does not refer to a valid range of VM memory.
+var ErrMemoryOutOfRange = errors.New("risbee: guest memory access out of range")
+
+// RisbeeErrno is an error number reported to the guest.
+// Syscall handlers return it negated in a0, following the
+// Linux convention.
+type RisbeeErrno uint64
+
+// Common error numbers for syscall handlers.
+const (
+	RISBEE_EIO          RisbeeErrno = 5  // I/O error
+	RISBEE_EBADF        RisbeeErrno = 9  // Bad file descriptor
+	RISBEE_EAGAIN       RisbeeErrno = 11 // Try again
+	RISBEE_ENOMEM       RisbeeErrno = 12 // Out of memory
+	RISBEE_EFAULT       RisbeeErrno = 14 // Bad address
+	RISBEE_EINVAL       RisbeeErrno = 22 // Invalid argument
+	RISBEE_ENAMETOOLONG RisbeeErrno = 36 // Name too long
+	RISBEE_ENOSYS       RisbeeErrno = 38 // Function not implemented
+)
+
+// RISBEE_STRING_MAX is the longest string, terminator
+// included, that SyscallFromFunc reads for a string
+// parameter.
+const RISBEE_STRING_MAX = 4096
+
+func (errno RisbeeErrno) Error() string {
+	return fmt.Sprintf("risbee: errno %d", uint64(errno))
+}
+
+// GetInt32Param retrieves the syscall parameter from
+// register a0+Index as a sign-extended 32-bit integer.
+func (vm *RisbeeVm) GetInt32Param(Index uint64) int32 {
+	return int32(vm.GetPointerParam(Index))
+}
+
+// GetUint32Param retrieves the syscall parameter from
+// register a0+Index as an unsigned 32-bit integer.
+func (vm *RisbeeVm) GetUint32Param(Index uint64) uint32 {
+	return uint32(vm.GetPointerParam(Index))
+}
+
+// GetInt64Param retrieves the syscall parameter from
+// register a0+Index as a signed 64-bit integer.
+func (vm *RisbeeVm) GetInt64Param(Index uint64) int64 {
+	return int64(vm.GetPointerParam(Index))
+}
+
+// GetFloat32Param retrieves the syscall parameter from
+// register a0+Index as a float. Risbee has no floating
+// point registers, so guests pass floats as bit patterns
+// in integer registers (soft-float lp64 ABI).
+func (vm *RisbeeVm) GetFloat32Param(Index uint64) float32 {
+	return math.Float32frombits(uint32(vm.GetPointerParam(Index)))
+}
+
+// GetFloat64Param retrieves the syscall parameter from
+// register a0+Index as a double, passed as bit pattern.
+func (vm *RisbeeVm) GetFloat64Param(Index uint64) float64 {
+	return math.Float64frombits(vm.GetPointerParam(Index))
+}
+
+// GetBufferParam reads the guest buffer described by the
+// pointer in a0+Index and the length in the following
+// register, and returns a copy of its contents.
+func (vm *RisbeeVm) GetBufferParam(Index uint64) ([]byte, error) {
+	return vm.ReadMemory(
+		vm.GetPointerParam(Index),
+		vm.GetPointerParam(Index+1),
+	)
+}
+
+// PutBufferParam copies Data into the guest buffer
+// described by the pointer in a0+Index and the capacity in
+// the following register, truncating Data to the capacity.
+//
+// Returns the number of bytes copied.
+func (vm *RisbeeVm) PutBufferParam(Index uint64, Data []byte) (int, error) {
+	size := min(vm.GetPointerParam(Index+1), uint64(len(Data)))
+	if err := vm.WriteMemory(vm.GetPointerParam(Index), Data[:size]); err != nil {
+		return 0, err
+	}
+
+	return int(size), nil
+}
+
+// ReadStruct decodes a fixed-size value (a struct, array
+// or integer of fixed-size fields, as accepted by
+// encoding/binary) stored little-endian at Pointer. Go
+// structs carry no implicit padding, so padding the C side
+// inserts must appear as explicit fields.
+func (vm *RisbeeVm) ReadStruct(Pointer uint64, Value any) error {
+	size := binary.Size(Value)
+	if size < 0 {
+		return fmt.Errorf("risbee: %T is not a fixed-size value", Value)
+	}
+
+	data, err := vm.ReadMemory(Pointer, uint64(size))
+	if err != nil {
+		return err
+	}
+
+	_, err = binary.Decode(data, binary.LittleEndian, Value)
+	return err
+}
+
+// WriteStruct encodes a fixed-size value little-endian
+// into guest memory at Pointer.
+func (vm *RisbeeVm) WriteStruct(Pointer uint64, Value any) error {
+	size := binary.Size(Value)
+	if size < 0 {
+		return fmt.Errorf("risbee: %T is not a fixed-size value", Value)
+	}
+
+	data := make([]byte, size)
+	if _, err := binary.Encode(data, binary.LittleEndian, Value); err != nil {
+		return err
+	}
+
+	return vm.WriteMemory(Pointer, data)
+}
+
+// SetReturnValues stores a second return value in a1 and
+// returns the first one, so that a handler can end with
+// `return vm.SetReturnValues(lo, hi)` to return both a0
+// and a1.
+func (vm *RisbeeVm) SetReturnValues(A0 uint64, A1 uint64) uint64 {
+	vm.Registers[11] = A1
+	return A0
+}
+
+// SyscallResult converts a value and an error into the
+// a0 result of a syscall. A nil error yields the value; a
+// RisbeeErrno yields its negation; memory access errors
+// map to -EFAULT and any other error to -EIO.
+func SyscallResult(Value uint64, Err error) uint64 {
+	if Err == nil {
+		return Value
+	}
+
+	var errno RisbeeErrno
+	switch {
+	case errors.As(Err, &errno):
+	case errors.Is(Err, ErrMemoryOutOfRange),
+		errors.Is(Err, ErrMemoryPermission):
+		errno = RISBEE_EFAULT
+
+	case errors.Is(Err, ErrStringTooLong):
+		errno = RISBEE_ENAMETOOLONG
+
+	default:
+		errno = RISBEE_EIO
+	}
+
+	return -uint64(errno)
+}
+
+var (
+	vmType    = reflect.TypeFor[*RisbeeVm]()
+	errorType = reflect.TypeFor[error]()
+	bytesType = reflect.TypeFor[[]byte]()
+)
+
+// SyscallFromFunc turns an ordinary Go function into a
+// syscall handler, decoding its arguments from a0–a7 in
+// order. Supported parameters are:
+//
+//   - *RisbeeVm, which consumes no register
+//   - signed and unsigned integers, uintptr and bool
+//   - float32 and float64, passed as bit patterns
+//   - string, read as a NUL-terminated guest string of at
+//     most RISBEE_STRING_MAX bytes; a null or bad pointer
+//     fails the call with EFAULT, a longer string with
+//     ENAMETOOLONG
+//   - []byte, a pointer and a length in two registers
+//
+// The function may return nothing, one or two integer,
+// bool or float values (placed in a0 and a1), and an
+// optional trailing error reported via SyscallResult.
+// SyscallFromFunc panics if the signature is unsupported.
+func SyscallFromFunc(Function any) RisbeeVmSyscallFn {
+	fn := reflect.ValueOf(Function)
+	fnType := fn.Type()
+
+	if fnType.Kind() != reflect.Func {
+		panic(fmt.Sprintf("risbee: SyscallFromFunc needs a function, got %T", Function))
+	}
+
+	registers := 0
+	for index := 0; index < fnType.NumIn(); index++ {
+		in := fnType.In(index)
+
+		switch {
+		case in == vmType:
+		case in == bytesType:
+			registers += 2
+
+		case isScalarKind(in.Kind()) || in.Kind() == reflect.String:
+			registers++
+
+		default:
+			panic(fmt.Sprintf("risbee: unsupported syscall parameter type %s", in))
+		}
+	}
+
+	if registers > 8 {
+		panic("risbee: syscall parameters exceed registers a0–a7")
+	}
+
+	results := fnType.NumOut()
+	hasError := results > 0 && fnType.Out(results-1) == errorType
+	if hasError {
+		results--
+	}
+
+	if results > 2 {
+		panic("risbee: syscall functions return at most two values")
+	}
+
+	for index := 0; index < results; index++ {
+		if !isScalarKind(fnType.Out(index).Kind()) {
+			panic(fmt.Sprintf("risbee: unsupported syscall result type %s", fnType.Out(index)))
+		}
+	}
+
+	return func(vm *RisbeeVm) uint64 {
+		args := make([]reflect.Value, fnType.NumIn())
+		register := uint64(0)
+
+		for index := range args {
+			in := fnType.In(index)
+
+			switch {
+			case in == vmType:
+				args[index] = reflect.ValueOf(vm)
+
+			case in == bytesType:
+				data, err := vm.GetBufferParam(register)
+				if err != nil {
+					return SyscallResult(0, err)
+				}
+
+				args[index] = reflect.ValueOf(data)
+				register += 2
+
+			case in.Kind() == reflect.String:
+				pointer := vm.GetPointerParam(register)
+				if pointer == 0 {
+					return SyscallResult(0, RISBEE_EFAULT)
+				}
+
+				str, err := vm.ReadCString(pointer, RISBEE_STRING_MAX)
+				if err != nil {
+					return SyscallResult(0, err)
+				}
+
+				args[index] = reflect.ValueOf(str).Convert(in)
+				register++
+
+			default:
+				args[index] = scalarFromRegister(in, vm.GetPointerParam(register))
+				register++
+			}
+		}
+
+		out := fn.Call(args)
+		if hasError && !out[len(out)-1].IsNil() {
+			return SyscallResult(0, out[len(out)-1].Interface().(error))
+		}
+
+		var values [2]uint64
+		for index := 0; index < results; index++ {
+			values[index] = scalarToRegister(out[index])
+		}
+
+		if results == 2 {
+			return vm.SetReturnValues(values[0], values[1])
+		}
+
+		return values[0]
+	}
+}
+
+// Checks whether a kind fits into a single register.
+func isScalarKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr, reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+// Converts a raw register into a scalar argument of type t.
+func scalarFromRegister(t reflect.Type, raw uint64) reflect.Value {
+	value := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.Bool:
+		value.SetBool(raw != 0)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value.SetInt(int64(raw))
+
+	case reflect.Float32:
+		value.SetFloat(float64(math.Float32frombits(uint32(raw))))
+
+	case reflect.Float64:
+		value.SetFloat(math.Float64frombits(raw))
+
+	default:
+		value.SetUint(raw)
+	}
+
+	return value
+}
+
+// Converts a scalar result into its register representation.
+func scalarToRegister(value reflect.Value) uint64 {
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			return 1
+		}
+		return 0
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(value.Int())
+
+	case reflect.Float32:
+		return uint64(math.Float32bits(float32(value.Float())))
+
+	case reflect.Float64:
+		return math.Float64bits(value.Float())
+	}
+
+	return value.Uint()
+}
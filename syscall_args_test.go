@@ -0,0 +1,226 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestTypedParams(t *testing.T) {
+	vm := &RisbeeVm{}
+	vm.Registers[10] = uint64(1<<64 - 5)
+	vm.Registers[11] = 0x1_0000_0007
+	vm.Registers[12] = uint64(math.Float32bits(1.5))
+	vm.Registers[13] = math.Float64bits(-2.25)
+
+	if value := vm.GetInt32Param(0); value != -5 {
+		t.Errorf("GetInt32Param = %d", value)
+	}
+
+	if value := vm.GetInt64Param(0); value != -5 {
+		t.Errorf("GetInt64Param = %d", value)
+	}
+
+	if value := vm.GetUint32Param(1); value != 7 {
+		t.Errorf("GetUint32Param = %d", value)
+	}
+
+	if value := vm.GetFloat32Param(2); value != 1.5 {
+		t.Errorf("GetFloat32Param = %v", value)
+	}
+
+	if value := vm.GetFloat64Param(3); value != -2.25 {
+		t.Errorf("GetFloat64Param = %v", value)
+	}
+}
+
+func TestBufferParams(t *testing.T) {
+	vm := &RisbeeVm{Memory: make([]byte, 0x2000)}
+	copy(vm.Memory[0x1000:], "hello")
+
+	vm.Registers[10] = 0x1000
+	vm.Registers[11] = 5
+	if data, err := vm.GetBufferParam(0); err != nil || string(data) != "hello" {
+		t.Fatalf("GetBufferParam = %q, %v", data, err)
+	}
+
+	vm.Registers[10] = 0x1800
+	vm.Registers[11] = 3
+	if count, err := vm.PutBufferParam(0, []byte("world")); err != nil || count != 3 ||
+		string(vm.Memory[0x1800:0x1805]) != "wor\x00\x00" {
+		t.Fatalf("PutBufferParam = %d, %v", count, err)
+	}
+
+	vm.Registers[10] = 0x1ffe
+	vm.Registers[11] = 8
+	if _, err := vm.GetBufferParam(0); !errors.Is(err, ErrMemoryOutOfRange) {
+		t.Errorf("buffer past memory: %v", err)
+	}
+}
+
+func TestStructs(t *testing.T) {
+	type header struct {
+		Magic   uint32
+		Version uint16
+		_       uint16
+		Size    int64
+	}
+
+	vm := &RisbeeVm{Memory: make([]byte, 0x2000)}
+	in := header{Magic: 0x46464952, Version: 2, Size: -1}
+
+	if err := vm.WriteStruct(0x1000, &in); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{'R', 'I', 'F', 'F', 2, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if string(vm.Memory[0x1000:0x1010]) != string(want) {
+		t.Errorf("encoded as % x", vm.Memory[0x1000:0x1010])
+	}
+
+	var out header
+	if err := vm.ReadStruct(0x1000, &out); err != nil || out != in {
+		t.Errorf("ReadStruct = %+v, %v", out, err)
+	}
+
+	if err := vm.ReadStruct(0x1ff8, &out); !errors.Is(err, ErrMemoryOutOfRange) {
+		t.Errorf("struct past memory: %v", err)
+	}
+
+	if err := vm.WriteStruct(0x1000, []int{1}); err == nil {
+		t.Error("WriteStruct accepted a value without a fixed size")
+	}
+}
+
+func TestSetReturnValues(t *testing.T) {
+	vm := &RisbeeVm{}
+	if a0 := vm.SetReturnValues(1, 2); a0 != 1 || vm.Registers[11] != 2 {
+		t.Errorf("a0 %d, a1 %d", a0, vm.Registers[11])
+	}
+}
+
+func TestSyscallFromFunc(t *testing.T) {
+	vm := &RisbeeVm{Memory: make([]byte, 0x2000)}
+	copy(vm.Memory[0x1000:], "data")
+
+	divide := SyscallFromFunc(func(a int32, b int32) (int32, int32, error) {
+		if b == 0 {
+			return 0, 0, RISBEE_EINVAL
+		}
+
+		return a / b, a % b, nil
+	})
+
+	vm.Registers[10] = uint64(1<<64 - 7)
+	vm.Registers[11] = 2
+	if a0 := divide(vm); int64(a0) != -3 || int64(vm.Registers[11]) != -1 {
+		t.Errorf("divide: a0 %d, a1 %d", int64(a0), int64(vm.Registers[11]))
+	}
+
+	vm.Registers[11] = 0
+	if a0 := divide(vm); a0 != SyscallResult(0, RISBEE_EINVAL) {
+		t.Errorf("divide by zero: a0 %d", int64(a0))
+	}
+
+	mixed := SyscallFromFunc(func(vm *RisbeeVm, data []byte, scale float64, flag bool) float64 {
+		if !flag {
+			return 0
+		}
+
+		return float64(len(data)) * scale
+	})
+
+	vm.Registers[10] = 0x1000
+	vm.Registers[11] = 4
+	vm.Registers[12] = math.Float64bits(0.5)
+	vm.Registers[13] = 1
+	if a0 := mixed(vm); math.Float64frombits(a0) != 2 {
+		t.Errorf("mixed: a0 %v", math.Float64frombits(a0))
+	}
+
+	vm.Registers[10] = 0x1ffe
+	if a0 := mixed(vm); a0 != SyscallResult(0, RISBEE_EFAULT) {
+		t.Errorf("bad buffer: a0 %d", int64(a0))
+	}
+}
+
+// Parameters fill a0–a7: a []byte takes two registers and
+// the VM none.
+func TestSyscallFromFuncRegisterLimit(t *testing.T) {
+	accepted := []any{
+		func(a, b, c, d, e, f, g, h uint64) {},
+		func(vm *RisbeeVm, a, b, c, d, e, f, g, h uint64) {},
+		func(data []byte, a, b, c, d, e, f uint64) {},
+	}
+
+	rejected := []any{
+		func(a, b, c, d, e, f, g, h, i uint64) {},
+		func(data []byte, a, b, c, d, e, f, g uint64) {},
+		func(a, b, c, d []byte, e uint64) {},
+		func(values []uint64) {},
+		func() (uint64, uint64, uint64) { return 0, 0, 0 },
+		func() string { return "" },
+		42,
+	}
+
+	for index, function := range accepted {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					t.Errorf("accepted function %d panicked: %v", index, err)
+				}
+			}()
+
+			SyscallFromFunc(function)
+		}()
+	}
+
+	for index, function := range rejected {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("rejected function %d did not panic", index)
+				}
+			}()
+
+			SyscallFromFunc(function)
+		}()
+	}
+}
+
+func TestSyscallFromFuncString(t *testing.T) {
+	var got string
+	handler := SyscallFromFunc(func(path string) uint64 {
+		got = path
+		return 0
+	})
+
+	vm := &RisbeeVm{Memory: make([]byte, 0x4000)}
+	copy(vm.Memory[0x1000:], "/etc/hosts\x00")
+
+	vm.Registers[10] = 0x1000
+	if result := handler(vm); result != 0 || got != "/etc/hosts" {
+		t.Fatalf("got %q, result %d", got, int64(result))
+	}
+
+	got = ""
+	vm.Registers[10] = 0
+	if result := handler(vm); result != SyscallResult(0, RISBEE_EFAULT) || got != "" {
+		t.Fatalf("null pointer: got %q, result %d", got, int64(result))
+	}
+
+	for index := 0x2000; index < 0x4000; index++ {
+		vm.Memory[index] = 'a'
+	}
+
+	vm.Registers[10] = 0x2000
+	if result := handler(vm); result != SyscallResult(0, RISBEE_ENAMETOOLONG) {
+		t.Fatalf("long string: result %d", int64(result))
+	}
+}
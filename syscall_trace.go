@@ -0,0 +1,134 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Output formats of RisbeeSyscallTracer.
+const (
+	RISBEE_TRACE_TEXT = iota // strace-like text, one call per line
+	RISBEE_TRACE_JSON        // JSON lines, one object per call
+)
+
+// RisbeeSyscallRecord describes one handled ECALL.
+type RisbeeSyscallRecord struct {
+	Pc        uint64    `json:"pc"`        // Address of the ECALL
+	Instret   uint64    `json:"instret"`   // Instructions executed before it
+	Code      uint64    `json:"code"`      // Syscall code from a7
+	Name      string    `json:"name"`      // Qualified name, if known
+	Args      [8]uint64 `json:"args"`      // Registers a0–a7 on entry
+	Result    uint64    `json:"result"`    // Value returned in a0, 0 if suspended
+	Suspended bool      `json:"suspended"` // Handler suspended the VM
+}
+
+// RisbeeSyscallTracer records every syscall handled by a
+// VM. Each record is written to Writer in the chosen
+// Format and passed to Callback; either may be nil. A
+// tracer may be shared by several VMs.
+type RisbeeSyscallTracer struct {
+	Writer   io.Writer                 // Destination of the trace
+	Format   int                       // RISBEE_TRACE_TEXT or RISBEE_TRACE_JSON
+	Callback func(RisbeeSyscallRecord) // Called for every record
+
+	lock sync.Mutex
+}
+
+// SetSyscallTracer enables syscall tracing on the VM.
+// Passing nil disables it.
+func (vm *RisbeeVm) SetSyscallTracer(Tracer *RisbeeSyscallTracer) {
+	vm.SyscallTracer = Tracer
+}
+
+// Returns the name of a syscall code as known to the
+// VM: the dispatcher's registered name, "exit" for the
+// built-in exit, or "syscall_<code>" otherwise.
+func (vm *RisbeeVm) syscallName(code uint64) string {
+	if code == 0 {
+		return "exit"
+	}
+
+	info := RisbeeSyscallInfo{Code: code}
+	if vm.Dispatcher != nil {
+		if registered, ok := vm.Dispatcher.Lookup(code); ok {
+			info = registered
+		}
+	}
+
+	return info.FullName()
+}
+
+// Runs a syscall and records it.
+//
+// Returns the result of the syscall.
+func (tracer *RisbeeSyscallTracer) trace(vm *RisbeeVm, code uint64) uint64 {
+	record := RisbeeSyscallRecord{
+		Pc:      vm.Pc,
+		Instret: vm.Instret,
+		Code:    code,
+		Name:    vm.syscallName(code),
+	}
+	copy(record.Args[:], vm.Registers[10:18])
+
+	record.Result = vm.dispatchSyscall(code)
+	record.Suspended = vm.suspended.Load()
+
+	// The result of a suspended call is only known once
+	// it is resumed; whatever the handler returned is
+	// discarded.
+	if record.Suspended {
+		record.Result = 0
+	}
+
+	tracer.emit(record)
+	return record.Result
+}
+
+// Writes a record in the configured format and hands it
+// to the callback.
+func (tracer *RisbeeSyscallTracer) emit(record RisbeeSyscallRecord) {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+
+	if tracer.Writer != nil {
+		if tracer.Format == RISBEE_TRACE_JSON {
+			line, _ := json.Marshal(record)
+			tracer.Writer.Write(append(line, '\n'))
+		} else {
+			io.WriteString(tracer.Writer, record.String()+"\n")
+		}
+	}
+
+	if tracer.Callback != nil {
+		tracer.Callback(record)
+	}
+}
+
+// String formats the record the way strace prints a call,
+// prefixed with its instruction count and PC. Results are
+// shown signed, so that -errno values read naturally.
+func (record RisbeeSyscallRecord) String() string {
+	result := fmt.Sprintf("%d", int64(record.Result))
+	if record.Suspended {
+		result = "? <suspended>"
+	} else if record.Result > 9 && int64(record.Result) > 0 {
+		result += fmt.Sprintf(" (0x%x)", record.Result)
+	}
+
+	args := record.Args
+	return fmt.Sprintf(
+		"[%8d] 0x%08x %s(0x%x, 0x%x, 0x%x, 0x%x, 0x%x, 0x%x, 0x%x) = %s",
+		record.Instret, record.Pc, record.Name,
+		args[0], args[1], args[2], args[3],
+		args[4], args[5], args[6],
+		result,
+	)
+}
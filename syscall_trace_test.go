@@ -0,0 +1,141 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nthnn/risbee"
+)
+
+// Makes syscalls returning a small value, a large value
+// and an error, then exits with code 3.
+const traceSource = `
+    li a0, 1
+    li a1, 2
+    li a7, 5
+    ecall
+    li a7, 6
+    ecall
+    li a7, 7
+    ecall
+    li a0, 3
+    li a7, 0
+    ecall
+`
+
+// Runs traceSource with the tracer installed.
+func runTraced(t *testing.T, tracer *risbee.RisbeeSyscallTracer) {
+	t.Helper()
+
+	vm := newSuspendVm(t, traceSource, func(*risbee.RisbeeVm) uint64 { return 0 })
+	vm.SetSystemCall(5, func(*risbee.RisbeeVm) uint64 { return 7 })
+	vm.SetSystemCall(6, func(*risbee.RisbeeVm) uint64 { return 0x100 })
+	vm.SetSystemCall(7, func(*risbee.RisbeeVm) uint64 {
+		return risbee.SyscallResult(0, risbee.RISBEE_EBADF)
+	})
+
+	vm.SetSyscallTracer(tracer)
+	vm.Run()
+}
+
+func TestSyscallTraceText(t *testing.T) {
+	var output bytes.Buffer
+	runTraced(t, &risbee.RisbeeSyscallTracer{Writer: &output})
+
+	want := strings.Join([]string{
+		"[       3] 0x0000100c syscall_5(0x1, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0) = 7",
+		"[       5] 0x00001014 syscall_6(0x7, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0) = 256 (0x100)",
+		"[       7] 0x0000101c syscall_7(0x100, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0) = -9",
+		"[      10] 0x00001028 exit(0x3, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0) = 3",
+		"",
+	}, "\n")
+
+	if output.String() != want {
+		t.Errorf("trace\n%s\nwant\n%s", output.String(), want)
+	}
+}
+
+func TestSyscallTraceJson(t *testing.T) {
+	var output bytes.Buffer
+	var records []risbee.RisbeeSyscallRecord
+
+	runTraced(t, &risbee.RisbeeSyscallTracer{
+		Writer: &output,
+		Format: risbee.RISBEE_TRACE_JSON,
+		Callback: func(record risbee.RisbeeSyscallRecord) {
+			records = append(records, record)
+		},
+	})
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 4 || len(records) != 4 {
+		t.Fatalf("%d lines and %d records, want 4", len(lines), len(records))
+	}
+
+	want := `{"pc":4108,"instret":3,"code":5,"name":"syscall_5",` +
+		`"args":[1,2,0,0,0,0,0,5],"result":7,"suspended":false}`
+	if lines[0] != want {
+		t.Errorf("record\n%s\nwant\n%s", lines[0], want)
+	}
+
+	results := []uint64{7, 0x100, risbee.SyscallResult(0, risbee.RISBEE_EBADF), 3}
+	for index, line := range lines {
+		var record risbee.RisbeeSyscallRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+
+		if record != records[index] {
+			t.Errorf("line %d decodes to %+v, callback got %+v", index, record, records[index])
+		}
+
+		if record.Result != results[index] {
+			t.Errorf("line %d: result %d, want %d", index, record.Result, results[index])
+		}
+	}
+}
+
+func TestSyscallTraceSuspended(t *testing.T) {
+	var output bytes.Buffer
+	var records []risbee.RisbeeSyscallRecord
+
+	vm := newSuspendVm(t, `
+    li a7, 1
+    ecall
+    li a7, 0
+    ecall
+`, func(vm *risbee.RisbeeVm) uint64 {
+		vm.Suspend()
+		return 99
+	})
+
+	vm.SetSyscallTracer(&risbee.RisbeeSyscallTracer{
+		Writer: &output,
+		Callback: func(record risbee.RisbeeSyscallRecord) {
+			records = append(records, record)
+		},
+	})
+
+	vm.Run()
+	if len(records) != 1 || !records[0].Suspended || records[0].Result != 0 {
+		t.Fatalf("records %+v", records)
+	}
+
+	want := "[       1] 0x00001004 syscall_1(0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0) = ? <suspended>\n"
+	if output.String() != want {
+		t.Errorf("trace %q, want %q", output.String(), want)
+	}
+
+	vm.Resume(5)
+	if len(records) != 2 || records[1].Name != "exit" || records[1].Result != 5 {
+		t.Errorf("after Resume: records %+v", records)
+	}
+}
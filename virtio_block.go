@@ -0,0 +1,617 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Register offsets of the virtio-mmio (version 2) transport.
+const (
+	RISBEE_VIRTIO_MMIO_MAGIC_VALUE         = 0x000 // Magic value "virt"
+	RISBEE_VIRTIO_MMIO_VERSION             = 0x004 // Transport version (2)
+	RISBEE_VIRTIO_MMIO_DEVICE_ID           = 0x008 // Virtio subsystem device ID
+	RISBEE_VIRTIO_MMIO_VENDOR_ID           = 0x00C // Virtio subsystem vendor ID
+	RISBEE_VIRTIO_MMIO_DEVICE_FEATURES     = 0x010 // Device feature bits
+	RISBEE_VIRTIO_MMIO_DEVICE_FEATURES_SEL = 0x014 // Device feature word selection
+	RISBEE_VIRTIO_MMIO_DRIVER_FEATURES     = 0x020 // Driver feature bits
+	RISBEE_VIRTIO_MMIO_DRIVER_FEATURES_SEL = 0x024 // Driver feature word selection
+	RISBEE_VIRTIO_MMIO_QUEUE_SEL           = 0x030 // Virtqueue index selection
+	RISBEE_VIRTIO_MMIO_QUEUE_NUM_MAX       = 0x034 // Maximum virtqueue size
+	RISBEE_VIRTIO_MMIO_QUEUE_NUM           = 0x038 // Virtqueue size
+	RISBEE_VIRTIO_MMIO_QUEUE_READY         = 0x044 // Virtqueue ready bit
+	RISBEE_VIRTIO_MMIO_QUEUE_NOTIFY        = 0x050 // Queue notifier
+	RISBEE_VIRTIO_MMIO_INTERRUPT_STATUS    = 0x060 // Interrupt status
+	RISBEE_VIRTIO_MMIO_INTERRUPT_ACK       = 0x064 // Interrupt acknowledge
+	RISBEE_VIRTIO_MMIO_STATUS              = 0x070 // Device status
+	RISBEE_VIRTIO_MMIO_QUEUE_DESC_LOW      = 0x080 // Descriptor table address, low word
+	RISBEE_VIRTIO_MMIO_QUEUE_DESC_HIGH     = 0x084 // Descriptor table address, high word
+	RISBEE_VIRTIO_MMIO_QUEUE_DRIVER_LOW    = 0x090 // Available ring address, low word
+	RISBEE_VIRTIO_MMIO_QUEUE_DRIVER_HIGH   = 0x094 // Available ring address, high word
+	RISBEE_VIRTIO_MMIO_QUEUE_DEVICE_LOW    = 0x0A0 // Used ring address, low word
+	RISBEE_VIRTIO_MMIO_QUEUE_DEVICE_HIGH   = 0x0A4 // Used ring address, high word
+	RISBEE_VIRTIO_MMIO_CONFIG_GENERATION   = 0x0FC // Configuration atomicity value
+	RISBEE_VIRTIO_MMIO_CONFIG              = 0x100 // Device-specific configuration space
+	RISBEE_VIRTIO_MMIO_SIZE                = 0x200 // Size of the register window
+)
+
+// Virtio block device constants.
+const (
+	RISBEE_VIRTIO_MAGIC        = 0x74726976 // "virt" in little-endian
+	RISBEE_VIRTIO_VENDOR       = 0x45425352 // "RSBE" in little-endian
+	RISBEE_VIRTIO_BLOCK_ID     = 2          // Block device ID
+	RISBEE_VIRTIO_QUEUE_SIZE   = 128        // Maximum descriptors per queue
+	RISBEE_VIRTIO_SECTOR_SIZE  = 512        // Sector size in bytes
+	RISBEE_VIRTIO_BLK_F_RO     = 1 << 5     // Device is read-only
+	RISBEE_VIRTIO_BLK_F_BLK_SZ = 1 << 6     // Block size is reported
+	RISBEE_VIRTIO_BLK_F_FLUSH  = 1 << 9     // Flush command is supported
+	RISBEE_VIRTIO_F_VERSION_1  = 1 << 32    // Compliant with virtio 1.x
+)
+
+// Virtio block request types and status codes.
+const (
+	RISBEE_VIRTIO_BLK_T_IN     = 0 // Read sectors
+	RISBEE_VIRTIO_BLK_T_OUT    = 1 // Write sectors
+	RISBEE_VIRTIO_BLK_T_FLUSH  = 4 // Flush volatile caches
+	RISBEE_VIRTIO_BLK_T_GET_ID = 8 // Get device ID string
+
+	RISBEE_VIRTIO_BLK_S_OK     = 0 // Request succeeded
+	RISBEE_VIRTIO_BLK_S_IOERR  = 1 // Request failed
+	RISBEE_VIRTIO_BLK_S_UNSUPP = 2 // Request not supported
+)
+
+// RisbeeBlockBackend is the storage behind a block device.
+type RisbeeBlockBackend interface {
+	io.ReaderAt
+	io.WriterAt
+	Size() int64
+}
+
+// RisbeeVirtioBlock is a virtio-mmio block device backed by
+// a host file or an in-memory byte slice. Attach it to a VM
+// with AttachDevice using RISBEE_VIRTIO_MMIO_SIZE as window
+// size. Completion is signaled through the used ring and the
+// interrupt status register, which guests are expected to poll.
+type RisbeeVirtioBlock struct {
+	ReadOnly bool   // Reject write requests from the guest
+	Id       string // Device ID returned for GET_ID requests
+
+	backend RisbeeBlockBackend
+	file    *os.File
+	lock    sync.Mutex
+
+	status          uint32
+	featuresSel     uint32
+	driverFeatures  uint64
+	driverSel       uint32
+	interruptStatus uint32
+
+	queueNum    uint32
+	queueReady  uint32
+	queueDesc   uint64
+	queueDriver uint64
+	queueDevice uint64
+	lastAvail   uint16
+}
+
+// memoryBlockBackend serves block requests from a byte slice.
+type memoryBlockBackend struct {
+	data []byte
+}
+
+func (backend *memoryBlockBackend) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > int64(len(backend.data)) {
+		return 0, io.EOF
+	}
+
+	return copy(p, backend.data[off:]), nil
+}
+
+func (backend *memoryBlockBackend) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > int64(len(backend.data)) {
+		return 0, io.ErrShortWrite
+	}
+
+	return copy(backend.data[off:], p), nil
+}
+
+func (backend *memoryBlockBackend) Size() int64 {
+	return int64(len(backend.data))
+}
+
+// fileBlockBackend serves block requests from a host file.
+type fileBlockBackend struct {
+	*os.File
+	size int64
+}
+
+func (backend *fileBlockBackend) Size() int64 {
+	return backend.size
+}
+
+// InitializeFromBytes backs the device with an in-memory
+// disk image. Guest writes modify the slice in place unless
+// the device is read-only.
+func (block *RisbeeVirtioBlock) InitializeFromBytes(
+	Data []byte,
+	ReadOnly bool,
+) {
+	block.InitializeFromBackend(
+		&memoryBlockBackend{data: Data},
+		ReadOnly,
+	)
+}
+
+// InitializeFromFile backs the device with a host disk image.
+// The file is opened read-only when ReadOnly is set.
+//
+// Returns an error if the file cannot be opened.
+func (block *RisbeeVirtioBlock) InitializeFromFile(
+	Path string,
+	ReadOnly bool,
+) error {
+	flags := os.O_RDWR
+	if ReadOnly {
+		flags = os.O_RDONLY
+	}
+
+	file, err := os.OpenFile(Path, flags, 0)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	block.InitializeFromBackend(
+		&fileBlockBackend{File: file, size: info.Size()},
+		ReadOnly,
+	)
+
+	block.file = file
+	return nil
+}
+
+// InitializeFromBackend backs the device with a custom
+// storage implementation.
+func (block *RisbeeVirtioBlock) InitializeFromBackend(
+	Backend RisbeeBlockBackend,
+	ReadOnly bool,
+) {
+	block.lock.Lock()
+	defer block.lock.Unlock()
+
+	block.backend = Backend
+	block.file = nil
+	block.ReadOnly = ReadOnly
+
+	if block.Id == "" {
+		block.Id = "risbee-virtio-blk"
+	}
+
+	block.reset()
+}
+
+// Close releases the host file backing the device, if any.
+func (block *RisbeeVirtioBlock) Close() error {
+	block.lock.Lock()
+	defer block.lock.Unlock()
+
+	if block.file == nil {
+		return nil
+	}
+
+	err := block.file.Close()
+	block.file = nil
+
+	return err
+}
+
+// Capacity returns the device size in 512-byte sectors.
+func (block *RisbeeVirtioBlock) Capacity() uint64 {
+	if block.backend == nil {
+		return 0
+	}
+
+	return uint64(block.backend.Size()) / RISBEE_VIRTIO_SECTOR_SIZE
+}
+
+// Returns the feature bits offered to the driver.
+func (block *RisbeeVirtioBlock) features() uint64 {
+	features := uint64(RISBEE_VIRTIO_F_VERSION_1 |
+		RISBEE_VIRTIO_BLK_F_BLK_SZ |
+		RISBEE_VIRTIO_BLK_F_FLUSH)
+
+	if block.ReadOnly {
+		features |= RISBEE_VIRTIO_BLK_F_RO
+	}
+
+	return features
+}
+
+// Resets the transport state after the driver writes
+// zero to the status register.
+func (block *RisbeeVirtioBlock) reset() {
+	block.status = 0
+	block.featuresSel = 0
+	block.driverFeatures = 0
+	block.driverSel = 0
+	block.interruptStatus = 0
+
+	block.queueNum = 0
+	block.queueReady = 0
+	block.queueDesc = 0
+	block.queueDriver = 0
+	block.queueDevice = 0
+	block.lastAvail = 0
+}
+
+// Read implements RisbeeDevice.
+func (block *RisbeeVirtioBlock) Read(
+	vm *RisbeeVm,
+	Offset uint64,
+	Size uint64,
+) uint64 {
+	block.lock.Lock()
+	defer block.lock.Unlock()
+
+	if Offset >= RISBEE_VIRTIO_MMIO_CONFIG {
+		return block.readConfig(Offset-RISBEE_VIRTIO_MMIO_CONFIG, Size)
+	}
+
+	switch Offset {
+	case RISBEE_VIRTIO_MMIO_MAGIC_VALUE:
+		return RISBEE_VIRTIO_MAGIC
+
+	case RISBEE_VIRTIO_MMIO_VERSION:
+		return 2
+
+	case RISBEE_VIRTIO_MMIO_DEVICE_ID:
+		return RISBEE_VIRTIO_BLOCK_ID
+
+	case RISBEE_VIRTIO_MMIO_VENDOR_ID:
+		return RISBEE_VIRTIO_VENDOR
+
+	case RISBEE_VIRTIO_MMIO_DEVICE_FEATURES:
+		return (block.features() >> (32 * uint64(block.featuresSel&1))) &
+			0xFFFFFFFF
+
+	case RISBEE_VIRTIO_MMIO_QUEUE_NUM_MAX:
+		return RISBEE_VIRTIO_QUEUE_SIZE
+
+	case RISBEE_VIRTIO_MMIO_QUEUE_READY:
+		return uint64(block.queueReady)
+
+	case RISBEE_VIRTIO_MMIO_INTERRUPT_STATUS:
+		return uint64(block.interruptStatus)
+
+	case RISBEE_VIRTIO_MMIO_STATUS:
+		return uint64(block.status)
+	}
+
+	return 0
+}
+
+// Reads from the block device configuration space, whose
+// layout starts with the 64-bit capacity followed by the
+// block size at offset 0x14.
+func (block *RisbeeVirtioBlock) readConfig(
+	offset uint64,
+	size uint64,
+) uint64 {
+	var config [0x18]byte
+
+	putUint64(config[0x00:], block.Capacity())
+	putUint32(config[0x14:], RISBEE_VIRTIO_SECTOR_SIZE)
+
+	if offset+size > uint64(len(config)) {
+		return 0
+	}
+
+	var val uint64
+	for index := uint64(0); index < size; index++ {
+		val |= uint64(config[offset+index]) << (8 * index)
+	}
+
+	return val
+}
+
+// Write implements RisbeeDevice.
+func (block *RisbeeVirtioBlock) Write(
+	vm *RisbeeVm,
+	Offset uint64,
+	Size uint64,
+	Value uint64,
+) {
+	block.lock.Lock()
+	defer block.lock.Unlock()
+
+	val := uint32(Value)
+	switch Offset {
+	case RISBEE_VIRTIO_MMIO_DEVICE_FEATURES_SEL:
+		block.featuresSel = val
+
+	case RISBEE_VIRTIO_MMIO_DRIVER_FEATURES:
+		shift := 32 * uint64(block.driverSel&1)
+		block.driverFeatures &^= 0xFFFFFFFF << shift
+		block.driverFeatures |= uint64(val) << shift
+
+	case RISBEE_VIRTIO_MMIO_DRIVER_FEATURES_SEL:
+		block.driverSel = val
+
+	case RISBEE_VIRTIO_MMIO_QUEUE_NUM:
+		if val <= RISBEE_VIRTIO_QUEUE_SIZE {
+			block.queueNum = val
+		}
+
+	case RISBEE_VIRTIO_MMIO_QUEUE_READY:
+		block.queueReady = val & 1
+
+	case RISBEE_VIRTIO_MMIO_QUEUE_NOTIFY:
+		if val == 0 && block.queueReady != 0 {
+			block.processQueue(vm)
+		}
+
+	case RISBEE_VIRTIO_MMIO_INTERRUPT_ACK:
+		block.interruptStatus &^= val
+
+	case RISBEE_VIRTIO_MMIO_STATUS:
+		if val == 0 {
+			block.reset()
+		} else {
+			block.status = val
+		}
+
+	case RISBEE_VIRTIO_MMIO_QUEUE_DESC_LOW:
+		block.queueDesc = setLowWord(block.queueDesc, val)
+
+	case RISBEE_VIRTIO_MMIO_QUEUE_DESC_HIGH:
+		block.queueDesc = setHighWord(block.queueDesc, val)
+
+	case RISBEE_VIRTIO_MMIO_QUEUE_DRIVER_LOW:
+		block.queueDriver = setLowWord(block.queueDriver, val)
+
+	case RISBEE_VIRTIO_MMIO_QUEUE_DRIVER_HIGH:
+		block.queueDriver = setHighWord(block.queueDriver, val)
+
+	case RISBEE_VIRTIO_MMIO_QUEUE_DEVICE_LOW:
+		block.queueDevice = setLowWord(block.queueDevice, val)
+
+	case RISBEE_VIRTIO_MMIO_QUEUE_DEVICE_HIGH:
+		block.queueDevice = setHighWord(block.queueDevice, val)
+	}
+}
+
+// DmaRanges implements RisbeeDmaDevice: a queue
+// notification may write the used ring and the writable
+// buffers of every request made available since the last
+// one.
+func (block *RisbeeVirtioBlock) DmaRanges(
+	vm *RisbeeVm,
+	Offset uint64,
+	Size uint64,
+	Value uint64,
+) []RisbeeMemoryRegion {
+	if Offset != RISBEE_VIRTIO_MMIO_QUEUE_NOTIFY {
+		return nil
+	}
+
+	block.lock.Lock()
+	defer block.lock.Unlock()
+
+	num := uint64(block.queueNum)
+	avail := dmaSlice(vm, block.queueDriver, 4+2*num)
+	if uint32(Value) != 0 || block.queueReady == 0 || num == 0 || avail == nil {
+		return nil
+	}
+
+	ranges := []RisbeeMemoryRegion{{Start: block.queueDevice, Size: 4 + 8*num}}
+	availIdx := uint16LittleEndian(avail[2:])
+
+	for next := block.lastAvail; next != availIdx; next++ {
+		index := uint64(uint16LittleEndian(avail[4+2*(uint64(next)%num):]))
+
+		for count := 0; count < RISBEE_VIRTIO_QUEUE_SIZE && index < num; count++ {
+			desc := dmaSlice(vm, block.queueDesc+16*index, 16)
+			if desc == nil {
+				break
+			}
+
+			flags := uint16LittleEndian(desc[12:])
+			if flags&2 != 0 {
+				ranges = append(ranges, RisbeeMemoryRegion{
+					Start: uint64LittleEndian(desc[0:]),
+					Size:  uint64(uint32LittleEndian(desc[8:])),
+				})
+			}
+
+			if flags&1 == 0 {
+				break
+			}
+			index = uint64(uint16LittleEndian(desc[14:]))
+		}
+	}
+
+	return ranges
+}
+
+// setLowWord replaces the lower 32 bits of a 64-bit address.
+func setLowWord(addr uint64, val uint32) uint64 {
+	return (addr &^ 0xFFFFFFFF) | uint64(val)
+}
+
+// setHighWord replaces the upper 32 bits of a 64-bit address.
+func setHighWord(addr uint64, val uint32) uint64 {
+	return (addr & 0xFFFFFFFF) | uint64(val)<<32
+}
+
+// Returns the guest memory slice [addr, addr+size) for
+// device DMA, or nil if it is out of range.
+func dmaSlice(vm *RisbeeVm, addr uint64, size uint64) []byte {
+	if !vm.inMemory(addr, size) {
+		return nil
+	}
+
+	return vm.Memory[addr : addr+size]
+}
+
+// Consumes every request the driver made available since
+// the last notification and publishes the completions in
+// the used ring.
+func (block *RisbeeVirtioBlock) processQueue(vm *RisbeeVm) {
+	num := uint64(block.queueNum)
+	if num == 0 {
+		return
+	}
+
+	avail := dmaSlice(vm, block.queueDriver, 4+2*num)
+	used := dmaSlice(vm, block.queueDevice, 4+8*num)
+	if avail == nil || used == nil {
+		block.status |= 0x40 // DEVICE_NEEDS_RESET
+		return
+	}
+
+	availIdx := uint16LittleEndian(avail[2:])
+	usedIdx := uint16LittleEndian(used[2:])
+
+	for block.lastAvail != availIdx {
+		slot := 4 + 2*(uint64(block.lastAvail)%num)
+		head := uint16LittleEndian(avail[slot:])
+
+		written, ok := block.processRequest(vm, head)
+		if !ok {
+			block.status |= 0x40
+			return
+		}
+
+		entry := 4 + 8*(uint64(usedIdx)%num)
+		putUint32(used[entry:], uint32(head))
+		putUint32(used[entry+4:], written)
+
+		usedIdx++
+		block.lastAvail++
+	}
+
+	putUint16(used[2:], usedIdx)
+	block.interruptStatus |= 1
+}
+
+// Handles the request whose descriptor chain starts at head.
+// Readable descriptors carry the request header and, for
+// writes, the payload; writable descriptors receive the read
+// payload followed by the one-byte status.
+//
+// Returns the number of bytes written into guest memory and
+// whether the descriptor chain was well-formed.
+func (block *RisbeeVirtioBlock) processRequest(
+	vm *RisbeeVm,
+	head uint16,
+) (uint32, bool) {
+	var readable []byte
+	var writable [][]byte
+
+	index := uint64(head)
+	for count := 0; count < RISBEE_VIRTIO_QUEUE_SIZE; count++ {
+		desc := dmaSlice(vm, block.queueDesc+16*index, 16)
+		if desc == nil || index >= uint64(block.queueNum) {
+			return 0, false
+		}
+
+		addr := uint64LittleEndian(desc[0:])
+		size := uint64(uint32LittleEndian(desc[8:]))
+		flags := uint16LittleEndian(desc[12:])
+
+		buffer := dmaSlice(vm, addr, size)
+		if buffer == nil {
+			return 0, false
+		}
+
+		if flags&2 != 0 {
+			writable = append(writable, buffer)
+		} else {
+			readable = append(readable, buffer...)
+		}
+
+		if flags&1 == 0 {
+			break
+		}
+		index = uint64(uint16LittleEndian(desc[14:]))
+	}
+
+	if len(readable) < 16 || len(writable) == 0 {
+		return 0, false
+	}
+
+	last := writable[len(writable)-1]
+	if len(last) == 0 {
+		return 0, false
+	}
+
+	statusByte := &last[len(last)-1]
+	writable[len(writable)-1] = last[:len(last)-1]
+
+	if block.backend == nil {
+		*statusByte = RISBEE_VIRTIO_BLK_S_IOERR
+		return 1, true
+	}
+
+	requestType := uint32LittleEndian(readable[0:])
+	offset := int64(uint64LittleEndian(readable[8:]) *
+		RISBEE_VIRTIO_SECTOR_SIZE)
+
+	var written uint32
+	status := byte(RISBEE_VIRTIO_BLK_S_OK)
+
+	switch requestType {
+	case RISBEE_VIRTIO_BLK_T_IN:
+		for _, buffer := range writable {
+			count, err := block.backend.ReadAt(buffer, offset)
+			written += uint32(count)
+			offset += int64(count)
+
+			if err != nil && !(errors.Is(err, io.EOF) && count == len(buffer)) {
+				status = RISBEE_VIRTIO_BLK_S_IOERR
+				break
+			}
+		}
+
+	case RISBEE_VIRTIO_BLK_T_OUT:
+		if block.ReadOnly {
+			status = RISBEE_VIRTIO_BLK_S_IOERR
+			break
+		}
+
+		if _, err := block.backend.WriteAt(readable[16:], offset); err != nil {
+			status = RISBEE_VIRTIO_BLK_S_IOERR
+		}
+
+	case RISBEE_VIRTIO_BLK_T_FLUSH:
+		if syncer, ok := block.backend.(interface{ Sync() error }); ok &&
+			!block.ReadOnly {
+			if syncer.Sync() != nil {
+				status = RISBEE_VIRTIO_BLK_S_IOERR
+			}
+		}
+
+	case RISBEE_VIRTIO_BLK_T_GET_ID:
+		if len(writable) > 0 {
+			written = uint32(copy(writable[0], block.Id))
+		}
+
+	default:
+		status = RISBEE_VIRTIO_BLK_S_UNSUPP
+	}
+
+	*statusByte = status
+	return written + 1, true
+}
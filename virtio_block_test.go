@@ -0,0 +1,158 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// Guest addresses of the virtqueue used by the tests.
+const (
+	testVirtioDesc   = 0x1000
+	testVirtioAvail  = 0x1100
+	testVirtioUsed   = 0x1200
+	testVirtioHeader = 0x1300
+	testVirtioData   = 0x2000
+	testVirtioStatus = 0x3000
+)
+
+// Submits one request to the device the way a driver would:
+// a header, a data buffer and a status byte chained through
+// three descriptors of a freshly set up queue.
+//
+// Returns the status byte and the data buffer afterwards.
+func virtioRequest(
+	block *RisbeeVirtioBlock,
+	requestType uint32,
+	sector uint64,
+	data []byte,
+) (byte, []byte) {
+	vm := &RisbeeVm{Memory: make([]byte, 0x4000)}
+	virtioSetup(block, vm, requestType, sector, data)
+	block.Write(vm, RISBEE_VIRTIO_MMIO_QUEUE_NOTIFY, 4, 0)
+
+	return vm.Memory[testVirtioStatus], vm.Memory[testVirtioData : testVirtioData+uint64(len(data))]
+}
+
+// Places a request in the memory of vm and sets up the
+// queue, leaving only the notification to the caller.
+func virtioSetup(
+	block *RisbeeVirtioBlock,
+	vm *RisbeeVm,
+	requestType uint32,
+	sector uint64,
+	data []byte,
+) {
+	memory := vm.Memory
+
+	putUint32(memory[testVirtioHeader:], requestType)
+	putUint64(memory[testVirtioHeader+8:], sector)
+	copy(memory[testVirtioData:], data)
+	memory[testVirtioStatus] = 0xFF
+
+	dataFlags := uint16(1)
+	if requestType == RISBEE_VIRTIO_BLK_T_IN {
+		dataFlags |= 2
+	}
+
+	descriptors := []struct {
+		addr, size uint64
+		flags      uint16
+	}{
+		{testVirtioHeader, 16, 1},
+		{testVirtioData, uint64(len(data)), dataFlags},
+		{testVirtioStatus, 1, 2},
+	}
+
+	for index, desc := range descriptors {
+		entry := memory[testVirtioDesc+16*index:]
+		putUint64(entry[0:], desc.addr)
+		putUint32(entry[8:], uint32(desc.size))
+		putUint16(entry[12:], desc.flags)
+		putUint16(entry[14:], uint16(index+1))
+	}
+
+	putUint16(memory[testVirtioAvail+2:], 1)
+	putUint16(memory[testVirtioAvail+4:], 0)
+
+	block.Write(vm, RISBEE_VIRTIO_MMIO_STATUS, 4, 0)
+	block.Write(vm, RISBEE_VIRTIO_MMIO_QUEUE_NUM, 4, 8)
+	block.Write(vm, RISBEE_VIRTIO_MMIO_QUEUE_DESC_LOW, 4, testVirtioDesc)
+	block.Write(vm, RISBEE_VIRTIO_MMIO_QUEUE_DRIVER_LOW, 4, testVirtioAvail)
+	block.Write(vm, RISBEE_VIRTIO_MMIO_QUEUE_DEVICE_LOW, 4, testVirtioUsed)
+	block.Write(vm, RISBEE_VIRTIO_MMIO_QUEUE_READY, 4, 1)
+}
+
+func TestVirtioBlockReadImage(t *testing.T) {
+	image, err := os.ReadFile("testdata/disk.img")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var block RisbeeVirtioBlock
+	if err := block.InitializeFromFile("testdata/disk.img", true); err != nil {
+		t.Fatal(err)
+	}
+	defer block.Close()
+
+	if block.Capacity() != 4 {
+		t.Fatalf("capacity %d, want 4", block.Capacity())
+	}
+
+	status, data := virtioRequest(&block, RISBEE_VIRTIO_BLK_T_IN, 2, make([]byte, 1024))
+	if status != RISBEE_VIRTIO_BLK_S_OK {
+		t.Fatalf("status %d", status)
+	}
+
+	if !bytes.Equal(data, image[1024:2048]) {
+		t.Fatalf("read %q", data[:32])
+	}
+
+	status, _ = virtioRequest(&block, RISBEE_VIRTIO_BLK_T_IN, 3, make([]byte, 1024))
+	if status != RISBEE_VIRTIO_BLK_S_IOERR {
+		t.Fatalf("read past the end: status %d", status)
+	}
+}
+
+func TestVirtioBlockWrite(t *testing.T) {
+	image, err := os.ReadFile("testdata/disk.img")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var block RisbeeVirtioBlock
+	block.InitializeFromBytes(image, false)
+
+	payload := bytes.Repeat([]byte{0xA5}, 512)
+	if status, _ := virtioRequest(&block, RISBEE_VIRTIO_BLK_T_OUT, 1, payload); status != RISBEE_VIRTIO_BLK_S_OK {
+		t.Fatalf("status %d", status)
+	}
+
+	if !bytes.Equal(image[512:1024], payload) {
+		t.Fatal("write did not reach the image")
+	}
+
+	block.ReadOnly = true
+	if status, _ := virtioRequest(&block, RISBEE_VIRTIO_BLK_T_OUT, 0, payload); status != RISBEE_VIRTIO_BLK_S_IOERR {
+		t.Fatalf("read-only write: status %d", status)
+	}
+
+	if bytes.Equal(image[:512], payload) {
+		t.Fatal("read-only image was modified")
+	}
+}
+
+func TestVirtioBlockWithoutBackend(t *testing.T) {
+	var block RisbeeVirtioBlock
+
+	status, _ := virtioRequest(&block, RISBEE_VIRTIO_BLK_T_IN, 0, make([]byte, 512))
+	if status != RISBEE_VIRTIO_BLK_S_IOERR {
+		t.Fatalf("status %d", status)
+	}
+}
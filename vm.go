@@ -6,6 +6,11 @@
 
 package risbee
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
 // RisbeeVmSyscallFn represents the signature of a syscall handler function.
 type RisbeeVmSyscallFn func(vm *RisbeeVm) uint64
 
@@ -19,8 +24,30 @@ type RisbeeVm struct {
 	ExitCode      int                          // Exit code of the VM
 	Running       bool                         // VM running status
 	SysCalls      map[uint64]RisbeeVmSyscallFn // Registered syscalls
+	Fallback      RisbeeSyscallFallback        // Handler for unregistered syscalls
+	Csrs          map[uint64]uint64            // Control and status registers
+	Devices       []RisbeeDeviceMapping        // Memory-mapped devices
+	Protections   []RisbeeMemoryRegion         // Memory access restrictions
+	Watchpoints   []RisbeeWatchpoint           // Watched memory ranges
+	Symbols       []RisbeeSymbol               // Symbols of the loaded ELF, by address
+	Lines         []RisbeeLine                 // Line table of the loaded ELF, by address
+	Dispatcher    *RisbeeSyscallDispatcher     // Optional syscall dispatcher
+	SyscallTracer *RisbeeSyscallTracer         // Optional syscall tracer
+	ExecTracer    *RisbeeExecTracer            // Optional instruction tracer
+	Recorder      *RisbeeRecorder              // Optional execution recorder
+	Profiler      *RisbeeProfiler              // Optional instruction profiler
+	Coverage      *RisbeeCoverage              // Optional coverage collector
+	Fault         *RisbeeFault                 // Last fault, nil if none
+	Engine        int                          // Execution engine (RISBEE_ENGINE_*)
+	Instret       uint64                       // Instructions executed so far
+	MaxImageSize  uint64                       // Largest ELF image LoadElf accepts, 0 for the default
 	ExitCallback  func(uint64)                 // Exit system call callback function
 	PanicCallback func(string)                 // Panic callback function
+
+	runLock   sync.Mutex     // Held while Run or Resume executes
+	suspended atomic.Bool    // Paused at an ECALL awaiting Resume
+	decoded   decodeCache    // Pre-decoded instructions
+	machine   *RisbeeMachine // Machine sharing the memory, if a hart
 }
 
 // This function initializes the Risbee virtual machine
@@ -37,7 +64,14 @@ func (vm *RisbeeVm) Initialize(
 	vm.Pc = 4096
 	vm.ExitCode = 0
 	vm.Running = false
+	vm.suspended.Store(false)
+	vm.Instret = 0
+	vm.Fault = nil
+	vm.decoded.reset()
 	vm.SysCalls = map[uint64]RisbeeVmSyscallFn{}
+	vm.Csrs = map[uint64]uint64{
+		RISBEE_CSR_MHARTID: 0,
+	}
 
 	vm.ExitCallback = exitCallback
 	vm.PanicCallback = panicCallback
@@ -67,7 +101,7 @@ func (vm *RisbeeVm) LoadFromBytes(Data []byte) bool {
 		return false
 	}
 
-	vm.Memory = make([]byte, loadOffset+size)
+	vm.setMemory(make([]byte, loadOffset+size))
 	vm.Registers[2] = uint64(size)
 
 	copy(vm.Memory[loadOffset:loadOffset+size], Data)
@@ -77,12 +111,52 @@ func (vm *RisbeeVm) LoadFromBytes(Data []byte) bool {
 // This function starts the execution of the Risbee virtual machine
 // instance and executes the loaded program, if any, and handles any
 // system calls or instructions encountered during execution until
-// the program exits or an error occurs.
+// the program exits or an error occurs. It returns right away
+// while the VM is suspended; use Resume to continue instead.
 func (vm *RisbeeVm) Run() {
+	vm.runLock.Lock()
+	defer vm.runLock.Unlock()
+
+	if vm.suspended.Load() {
+		return
+	}
+
 	vm.Running = true
-	for vm.Running {
-		inst := vm.fetch()
-		vm.execute(inst)
+	vm.loop()
+}
+
+// Step fetches and executes exactly one instruction at the
+// current program counter. It is used by Run and by hosts that
+// need to interleave the VM with other work, such as the
+// round-robin scheduler of RisbeeMachine.
+func (vm *RisbeeVm) Step() {
+	if vm.Profiler != nil {
+		vm.Profiler.sample(vm)
+	}
+
+	if vm.Recorder != nil {
+		vm.Recorder.begin(vm)
+	}
+
+	pc := vm.Pc
+
+	if vm.ExecTracer != nil {
+		vm.ExecTracer.step(vm)
+	} else if vm.Engine == RISBEE_ENGINE_SWITCH {
+		if inst, ok := vm.fetch(); ok {
+			vm.execute(inst)
+		}
+	} else {
+		vm.executeDecoded()
+	}
+
+	vm.Instret++
+	if vm.Recorder != nil {
+		vm.Recorder.end(vm)
+	}
+
+	if vm.Coverage != nil {
+		vm.Coverage.record(vm, pc)
 	}
 }
 
@@ -107,7 +181,7 @@ func (vm *RisbeeVm) GetStringPointer(Pointer uint64) string {
 	var str string
 	if Pointer == 0 {
 		str = "(null)"
-	} else {
+	} else if Pointer < uint64(len(vm.Memory)) {
 		mem := vm.Memory
 		start := Pointer
 		end := Pointer
@@ -131,6 +205,15 @@ func (vm *RisbeeVm) SetSystemCall(
 	vm.SysCalls[Address] = Callback
 }
 
+// SetSyscallFallback sets the handler for syscall codes
+// that have no registered handler, which otherwise panic
+// the VM. Passing nil restores that behavior.
+func (vm *RisbeeVm) SetSyscallFallback(
+	Fallback RisbeeSyscallFallback,
+) {
+	vm.Fallback = Fallback
+}
+
 // GetSystemCall retrieves a registered syscall
 // handler by address (code).
 //
@@ -157,6 +240,12 @@ func (vm *RisbeeVm) setExitCode(exitCode int) {
 // message and performs any necessary cleanup before
 // terminating the program.
 func (vm *RisbeeVm) panic(message string) {
+	vm.Fault = vm.newFault(message)
+
+	if vm.ExecTracer != nil {
+		vm.ExecTracer.fault()
+	}
+
 	if vm.PanicCallback != nil {
 		vm.PanicCallback(message)
 	}
@@ -171,19 +260,17 @@ func (vm *RisbeeVm) panic(message string) {
 // the specified Risbee virtual machine instance vm. It returns the fetched
 // instruction for execution by the virtual machine.
 //
-// Returns the next instruction to be executed.
-func (vm *RisbeeVm) fetch() uint32 {
-	pc := int(vm.Pc)
-	if pc < 0 || pc+4 > len(vm.Memory) {
-		vm.PanicCallback("PC out of range")
-		vm.Stop()
-
-		return 0
+// Returns the next instruction to be executed, and false
+// if the program counter is out of range, which panics.
+func (vm *RisbeeVm) fetch() (uint32, bool) {
+	if !vm.inMemory(vm.Pc, 4) {
+		vm.panic("PC out of range.")
+		return 0, false
 	}
 
 	return uint32LittleEndian(
 		vm.Memory[vm.Pc : vm.Pc+4],
-	)
+	), true
 }
 
 // Handles a system call in a Risbee virtual machine instance.
@@ -197,18 +284,26 @@ func (vm *RisbeeVm) fetch() uint32 {
 //
 // Returns the result of the system call execution.
 func (vm *RisbeeVm) handleSyscall(code uint64) uint64 {
-	if code == 0 {
-		exitCode := int(vm.GetPointerParam(0))
-		vm.setExitCode(exitCode)
+	if vm.SyscallTracer != nil {
+		return vm.SyscallTracer.trace(vm, code)
+	}
 
-		if vm.ExitCallback != nil {
-			vm.ExitCallback(uint64(exitCode))
-			vm.Stop()
-		}
+	return vm.dispatchSyscall(code)
+}
 
-		return uint64(exitCode)
+// Runs the handler for a system call code: the dispatcher
+// if one is set, the built-in exit, or the SysCalls map.
+//
+// Returns the value to be placed in a0.
+func (vm *RisbeeVm) dispatchSyscall(code uint64) uint64 {
+	if vm.Dispatcher != nil {
+		return vm.Dispatcher.Dispatch(vm, code)
+	} else if code == 0 {
+		return syscallExit(vm)
 	} else if fn, ok := vm.SysCalls[code]; ok {
 		return fn(vm)
+	} else if vm.Fallback != nil {
+		return vm.Fallback(vm, code)
 	} else {
 		vm.panic("Invalid system call.")
 	}
@@ -216,6 +311,22 @@ func (vm *RisbeeVm) handleSyscall(code uint64) uint64 {
 	return 0
 }
 
+// Handles the built-in exit syscall, code 0, with the exit
+// code in a0.
+//
+// Returns the exit code.
+func syscallExit(vm *RisbeeVm) uint64 {
+	exitCode := int(vm.GetPointerParam(0))
+	vm.setExitCode(exitCode)
+
+	if vm.ExitCallback != nil {
+		vm.ExitCallback(uint64(exitCode))
+		vm.Stop()
+	}
+
+	return uint64(exitCode)
+}
+
 // Executes the given instruction.
 //
 // Parameters:
@@ -236,35 +347,25 @@ func (vm *RisbeeVm) execute(inst uint32) {
 		var val int64
 		switch functionCode3 {
 		case RISBEE_FC3_LB:
-			val = int64(int8(vm.Memory[addr]))
+			val = int64(int8(vm.load(addr, 1)))
 
 		case RISBEE_FC3_LHW:
-			val = int64(int16(uint16LittleEndian(
-				vm.Memory[addr:],
-			)))
+			val = int64(int16(vm.load(addr, 2)))
 
 		case RISBEE_FC3_LW:
-			val = int64(int32(uint32LittleEndian(
-				vm.Memory[addr:],
-			)))
+			val = int64(int32(vm.load(addr, 4)))
 
 		case RISBEE_FC3_LDW:
-			val = int64(uint64LittleEndian(
-				vm.Memory[addr:],
-			))
+			val = int64(vm.load(addr, 8))
 
 		case RISBEE_FC3_LBU:
-			val = int64(vm.Memory[addr])
+			val = int64(vm.load(addr, 1))
 
 		case RISBEE_FC3_LHU:
-			val = int64(uint16LittleEndian(
-				vm.Memory[addr:],
-			))
+			val = int64(vm.load(addr, 2))
 
 		case RISBEE_FC3_LRES:
-			val = int64(uint32LittleEndian(
-				vm.Memory[addr:],
-			))
+			val = int64(vm.load(addr, 4))
 
 		default:
 			vm.panic("Invalid load instruction.")
@@ -288,25 +389,16 @@ func (vm *RisbeeVm) execute(inst uint32) {
 
 		switch functionCode3 {
 		case RISBEE_FC3_SB:
-			vm.Memory[addr] = byte(val)
+			vm.store(addr, 1, val)
 
 		case RISBEE_FC3_SHW:
-			putUint16(
-				vm.Memory[addr:],
-				uint16(val),
-			)
+			vm.store(addr, 2, val)
 
 		case RISBEE_FC3_SW:
-			putUint32(
-				vm.Memory[addr:],
-				uint32(val),
-			)
+			vm.store(addr, 4, val)
 
 		case RISBEE_FC3_SDW:
-			putUint64(
-				vm.Memory[addr:],
-				val,
-			)
+			vm.store(addr, 8, val)
 
 		default:
 			vm.panic("Invalid store instruction.")
@@ -728,12 +820,26 @@ func (vm *RisbeeVm) execute(inst uint32) {
 		// No-op for now (memory ordering not needed temporarily)
 
 	case RISBEE_OPINST_CALL:
+		functionCode3 := (inst >> 12) & 0x7
 		functionCode11 := (inst >> 20) & 0xFFF
 
+		if functionCode3 != RISBEE_FC3_PRIV {
+			vm.executeCsr(
+				functionCode3,
+				uint64(functionCode11),
+				rd, rs1,
+			)
+			break
+		}
+
 		switch functionCode11 {
 		case 0x0:
 			code := vm.Registers[17]
-			vm.Registers[10] = vm.handleSyscall(code)
+			result := vm.handleSyscall(code)
+
+			if !vm.suspended.Load() {
+				vm.Registers[10] = result
+			}
 
 		case 0x1:
 			vm.ExitCode = -1
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+#ifndef RISBEE_WASI_H
+#define RISBEE_WASI_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+/* Syscall codes, kept in sync with wasi/wasi.go. */
+#define RISBEE_WASI_ARGS_SIZES_GET      0x400
+#define RISBEE_WASI_ARGS_GET            0x401
+#define RISBEE_WASI_ENVIRON_SIZES_GET   0x402
+#define RISBEE_WASI_ENVIRON_GET         0x403
+#define RISBEE_WASI_FD_READ             0x404
+#define RISBEE_WASI_FD_WRITE            0x405
+#define RISBEE_WASI_FD_CLOSE            0x406
+#define RISBEE_WASI_FD_SEEK             0x407
+#define RISBEE_WASI_FD_PRESTAT_GET      0x408
+#define RISBEE_WASI_FD_PRESTAT_DIR_NAME 0x409
+#define RISBEE_WASI_PATH_OPEN           0x40A
+#define RISBEE_WASI_CLOCK_TIME_GET      0x40B
+#define RISBEE_WASI_RANDOM_GET          0x40C
+#define RISBEE_WASI_PROC_EXIT           0x40D
+
+/* Error numbers. */
+#define RISBEE_WASI_ERRNO_SUCCESS    0
+#define RISBEE_WASI_ERRNO_ACCES      2
+#define RISBEE_WASI_ERRNO_BADF       8
+#define RISBEE_WASI_ERRNO_EXIST      20
+#define RISBEE_WASI_ERRNO_FAULT      21
+#define RISBEE_WASI_ERRNO_INVAL      28
+#define RISBEE_WASI_ERRNO_IO         29
+#define RISBEE_WASI_ERRNO_ISDIR      31
+#define RISBEE_WASI_ERRNO_NOENT      44
+#define RISBEE_WASI_ERRNO_NOTCAPABLE 76
+
+/* path_open flags. */
+#define RISBEE_WASI_OFLAGS_CREAT     (1 << 0)
+#define RISBEE_WASI_OFLAGS_DIRECTORY (1 << 1)
+#define RISBEE_WASI_OFLAGS_EXCL      (1 << 2)
+#define RISBEE_WASI_OFLAGS_TRUNC     (1 << 3)
+#define RISBEE_WASI_FDFLAGS_APPEND   (1 << 0)
+#define RISBEE_WASI_FDFLAGS_WRITE    (1 << 8)
+
+/* Clocks and seek origins. */
+#define RISBEE_WASI_CLOCK_REALTIME  0
+#define RISBEE_WASI_CLOCK_MONOTONIC 1
+#define RISBEE_WASI_WHENCE_SET      0
+#define RISBEE_WASI_WHENCE_CUR      1
+#define RISBEE_WASI_WHENCE_END      2
+
+/* Standard descriptors; preopened directories start at 3. */
+#define RISBEE_WASI_STDIN   0
+#define RISBEE_WASI_STDOUT  1
+#define RISBEE_WASI_STDERR  2
+#define RISBEE_WASI_PREOPEN 3
+
+typedef uint16_t risbee_wasi_errno_t;
+typedef uint32_t risbee_wasi_fd_t;
+
+typedef struct {
+    void* buf;
+    size_t len;
+} risbee_wasi_iovec_t;
+
+static inline long risbee_wasi_call(
+    long code, long a0, long a1, long a2,
+    long a3, long a4, long a5
+) {
+    register long r0 asm("a0") = a0;
+    register long r1 asm("a1") = a1;
+    register long r2 asm("a2") = a2;
+    register long r3 asm("a3") = a3;
+    register long r4 asm("a4") = a4;
+    register long r5 asm("a5") = a5;
+    register long scid asm("a7") = code;
+
+    asm volatile ("scall"
+        : "+r"(r0)
+        : "r"(r1), "r"(r2), "r"(r3), "r"(r4), "r"(r5), "r"(scid)
+        : "memory");
+    return r0;
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_args_sizes_get(uint32_t* argc, uint32_t* argv_buf_size) {
+    return risbee_wasi_call(RISBEE_WASI_ARGS_SIZES_GET, (long) argc, (long) argv_buf_size, 0, 0, 0, 0);
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_args_get(char** argv, char* argv_buf) {
+    return risbee_wasi_call(RISBEE_WASI_ARGS_GET, (long) argv, (long) argv_buf, 0, 0, 0, 0);
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_environ_sizes_get(uint32_t* count, uint32_t* buf_size) {
+    return risbee_wasi_call(RISBEE_WASI_ENVIRON_SIZES_GET, (long) count, (long) buf_size, 0, 0, 0, 0);
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_environ_get(char** environ, char* environ_buf) {
+    return risbee_wasi_call(RISBEE_WASI_ENVIRON_GET, (long) environ, (long) environ_buf, 0, 0, 0, 0);
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_fd_read(
+    risbee_wasi_fd_t fd, const risbee_wasi_iovec_t* iovs, size_t iovs_len, size_t* nread
+) {
+    return risbee_wasi_call(RISBEE_WASI_FD_READ, fd, (long) iovs, iovs_len, (long) nread, 0, 0);
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_fd_write(
+    risbee_wasi_fd_t fd, const risbee_wasi_iovec_t* iovs, size_t iovs_len, size_t* nwritten
+) {
+    return risbee_wasi_call(RISBEE_WASI_FD_WRITE, fd, (long) iovs, iovs_len, (long) nwritten, 0, 0);
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_fd_close(risbee_wasi_fd_t fd) {
+    return risbee_wasi_call(RISBEE_WASI_FD_CLOSE, fd, 0, 0, 0, 0, 0);
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_fd_seek(
+    risbee_wasi_fd_t fd, int64_t offset, int whence, uint64_t* newoffset
+) {
+    return risbee_wasi_call(RISBEE_WASI_FD_SEEK, fd, offset, whence, (long) newoffset, 0, 0);
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_fd_prestat_get(risbee_wasi_fd_t fd, uint32_t* name_len) {
+    return risbee_wasi_call(RISBEE_WASI_FD_PRESTAT_GET, fd, (long) name_len, 0, 0, 0, 0);
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_fd_prestat_dir_name(risbee_wasi_fd_t fd, char* path, size_t path_len) {
+    return risbee_wasi_call(RISBEE_WASI_FD_PRESTAT_DIR_NAME, fd, (long) path, path_len, 0, 0, 0);
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_path_open(
+    risbee_wasi_fd_t dirfd, const char* path, size_t path_len,
+    uint32_t oflags, uint32_t fdflags, risbee_wasi_fd_t* fd
+) {
+    return risbee_wasi_call(RISBEE_WASI_PATH_OPEN, dirfd, (long) path, path_len, oflags, fdflags, (long) fd);
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_clock_time_get(int clock_id, uint64_t precision, uint64_t* time) {
+    return risbee_wasi_call(RISBEE_WASI_CLOCK_TIME_GET, clock_id, precision, (long) time, 0, 0, 0);
+}
+
+static inline risbee_wasi_errno_t risbee_wasi_random_get(void* buf, size_t buf_len) {
+    return risbee_wasi_call(RISBEE_WASI_RANDOM_GET, (long) buf, buf_len, 0, 0, 0, 0);
+}
+
+static inline void risbee_wasi_proc_exit(int code) {
+    risbee_wasi_call(RISBEE_WASI_PROC_EXIT, code, 0, 0, 0, 0, 0);
+    __builtin_unreachable();
+}
+
+#endif
@@ -0,0 +1,565 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+// Package wasi provides a reusable set of capability-based host
+// syscalls for Risbee guests, modeled after WASI preview1. The
+// host explicitly grants program arguments, environment, standard
+// streams, preopened directories, clocks and randomness; anything
+// not granted is reported to the guest as ERRNO_NOTCAPABLE or
+// ERRNO_BADF. Guests use the matching C header risbee_wasi.h.
+package wasi
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/nthnn/risbee"
+)
+
+// Syscall codes (placed in a7) of the WASI-like host API.
+// They must stay in sync with risbee_wasi.h.
+const (
+	SYS_ARGS_SIZES_GET      = 0x400 // args_sizes_get(argc*, argv_buf_size*)
+	SYS_ARGS_GET            = 0x401 // args_get(argv**, argv_buf*)
+	SYS_ENVIRON_SIZES_GET   = 0x402 // environ_sizes_get(count*, buf_size*)
+	SYS_ENVIRON_GET         = 0x403 // environ_get(environ**, environ_buf*)
+	SYS_FD_READ             = 0x404 // fd_read(fd, iovs*, iovs_len, nread*)
+	SYS_FD_WRITE            = 0x405 // fd_write(fd, iovs*, iovs_len, nwritten*)
+	SYS_FD_CLOSE            = 0x406 // fd_close(fd)
+	SYS_FD_SEEK             = 0x407 // fd_seek(fd, offset, whence, newoffset*)
+	SYS_FD_PRESTAT_GET      = 0x408 // fd_prestat_get(fd, name_len*)
+	SYS_FD_PRESTAT_DIR_NAME = 0x409 // fd_prestat_dir_name(fd, path*, path_len)
+	SYS_PATH_OPEN           = 0x40A // path_open(dirfd, path*, path_len, oflags, fdflags, fd*)
+	SYS_CLOCK_TIME_GET      = 0x40B // clock_time_get(clock_id, precision, time*)
+	SYS_RANDOM_GET          = 0x40C // random_get(buf*, buf_len)
+	SYS_PROC_EXIT           = 0x40D // proc_exit(code)
+)
+
+// Error numbers returned in a0, matching WASI preview1.
+const (
+	ERRNO_SUCCESS    = 0  // No error
+	ERRNO_ACCES      = 2  // Permission denied
+	ERRNO_BADF       = 8  // Bad file descriptor
+	ERRNO_EXIST      = 20 // File exists
+	ERRNO_FAULT      = 21 // Bad address
+	ERRNO_INVAL      = 28 // Invalid argument
+	ERRNO_IO         = 29 // I/O error
+	ERRNO_ISDIR      = 31 // Is a directory
+	ERRNO_NOENT      = 44 // No such file or directory
+	ERRNO_NOTCAPABLE = 76 // Capability not granted
+)
+
+// Flags of path_open, matching WASI preview1.
+const (
+	OFLAGS_CREAT     = 1 << 0 // Create the file if it does not exist
+	OFLAGS_DIRECTORY = 1 << 1 // Fail unless the path is a directory
+	OFLAGS_EXCL      = 1 << 2 // Fail if the file already exists
+	OFLAGS_TRUNC     = 1 << 3 // Truncate the file to size zero
+
+	FDFLAGS_APPEND = 1 << 0 // Append writes to the end of the file
+	FDFLAGS_WRITE  = 1 << 8 // Open for writing (Risbee extension of fdflags)
+)
+
+// Clock identifiers of clock_time_get.
+const (
+	CLOCK_REALTIME  = 0 // Wall clock time
+	CLOCK_MONOTONIC = 1 // Monotonic time since the host was installed
+)
+
+// Preopen grants the guest access to one host directory.
+type Preopen struct {
+	GuestPath string // Name the guest sees, e.g. "/data"
+	HostPath  string // Host directory backing it
+	ReadOnly  bool   // Deny path_open with write access
+}
+
+// Host holds the capabilities granted to one guest. Zero values
+// grant nothing: a nil stream is a closed descriptor, and clocks
+// and randomness are only available when explicitly allowed.
+type Host struct {
+	Args        []string  // Program arguments
+	Env         []string  // Environment as KEY=VALUE strings
+	Stdin       io.Reader // Descriptor 0, if granted
+	Stdout      io.Writer // Descriptor 1, if granted
+	Stderr      io.Writer // Descriptor 2, if granted
+	Preopens    []Preopen // Directories available from descriptor 3 on
+	AllowClock  bool      // Grant clock_time_get
+	AllowRandom bool      // Grant random_get
+
+	fds   map[uint64]*descriptor
+	start time.Time
+}
+
+// descriptor is an entry of the guest file descriptor table.
+type descriptor struct {
+	reader   io.Reader
+	writer   io.Writer
+	file     *os.File
+	root     *os.Root
+	preopen  *Preopen
+	writable bool
+}
+
+// Install opens the preopened directories and registers the
+// host syscalls on the VM.
+//
+// Returns an error if a preopened directory cannot be opened.
+func (host *Host) Install(vm *risbee.RisbeeVm) error {
+	host.start = time.Now()
+	host.fds = map[uint64]*descriptor{}
+
+	if host.Stdin != nil {
+		host.fds[0] = &descriptor{reader: host.Stdin}
+	}
+
+	if host.Stdout != nil {
+		host.fds[1] = &descriptor{writer: host.Stdout, writable: true}
+	}
+
+	if host.Stderr != nil {
+		host.fds[2] = &descriptor{writer: host.Stderr, writable: true}
+	}
+
+	for index := range host.Preopens {
+		preopen := &host.Preopens[index]
+
+		root, err := os.OpenRoot(preopen.HostPath)
+		if err != nil {
+			host.Close()
+			return err
+		}
+
+		host.fds[uint64(3+index)] = &descriptor{
+			root:    root,
+			preopen: preopen,
+		}
+	}
+
+	vm.SetSystemCall(SYS_ARGS_SIZES_GET, host.argsSizesGet)
+	vm.SetSystemCall(SYS_ARGS_GET, host.argsGet)
+	vm.SetSystemCall(SYS_ENVIRON_SIZES_GET, host.environSizesGet)
+	vm.SetSystemCall(SYS_ENVIRON_GET, host.environGet)
+	vm.SetSystemCall(SYS_FD_READ, host.fdRead)
+	vm.SetSystemCall(SYS_FD_WRITE, host.fdWrite)
+	vm.SetSystemCall(SYS_FD_CLOSE, host.fdClose)
+	vm.SetSystemCall(SYS_FD_SEEK, host.fdSeek)
+	vm.SetSystemCall(SYS_FD_PRESTAT_GET, host.fdPrestatGet)
+	vm.SetSystemCall(SYS_FD_PRESTAT_DIR_NAME, host.fdPrestatDirName)
+	vm.SetSystemCall(SYS_PATH_OPEN, host.pathOpen)
+	vm.SetSystemCall(SYS_CLOCK_TIME_GET, host.clockTimeGet)
+	vm.SetSystemCall(SYS_RANDOM_GET, host.randomGet)
+	vm.SetSystemCall(SYS_PROC_EXIT, host.procExit)
+
+	return nil
+}
+
+// Close releases every file and directory the guest
+// still has open.
+func (host *Host) Close() error {
+	var errs []error
+	for fd, desc := range host.fds {
+		if desc.file != nil {
+			errs = append(errs, desc.file.Close())
+		}
+
+		if desc.root != nil {
+			errs = append(errs, desc.root.Close())
+		}
+
+		delete(host.fds, fd)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Checks whether [addr, addr+size) lies within guest memory,
+// so that host-side buffers are never sized by a bogus length.
+func fits(vm *risbee.RisbeeVm, addr uint64, size uint64) bool {
+	return addr+size >= addr && addr+size <= uint64(len(vm.Memory))
+}
+
+// Stores a little-endian 32- or 64-bit value into guest memory.
+//
+// Returns false if the access is not permitted.
+func store(vm *risbee.RisbeeVm, addr uint64, size uint64, value uint64) bool {
+	if size == 4 {
+		return vm.WriteUint32(addr, uint32(value)) == nil
+	}
+
+	return vm.WriteUint64(addr, value) == nil
+}
+
+// Loads a little-endian 64-bit value from guest memory.
+func load(vm *risbee.RisbeeVm, addr uint64) (uint64, bool) {
+	value, err := vm.ReadUint64(addr)
+	return value, err == nil
+}
+
+// Returns the total size of the NUL-terminated strings.
+func stringsSize(list []string) uint64 {
+	var size uint64
+	for _, str := range list {
+		size += uint64(len(str)) + 1
+	}
+
+	return size
+}
+
+// Writes the list sizes for args_sizes_get and environ_sizes_get.
+func sizesGet(vm *risbee.RisbeeVm, list []string) uint64 {
+	if !store(vm, vm.GetPointerParam(0), 4, uint64(len(list))) ||
+		!store(vm, vm.GetPointerParam(1), 4, stringsSize(list)) {
+		return ERRNO_FAULT
+	}
+
+	return ERRNO_SUCCESS
+}
+
+// Copies a string list into the guest for args_get and
+// environ_get: pointers go to a0, string data to a1.
+func listGet(vm *risbee.RisbeeVm, list []string) uint64 {
+	pointers := vm.GetPointerParam(0)
+	data := vm.GetPointerParam(1)
+
+	var strings []byte
+	for index, str := range list {
+		pointer := data + uint64(len(strings))
+		if !store(vm, pointers+uint64(index)*8, 8, pointer) {
+			return ERRNO_FAULT
+		}
+
+		strings = append(strings, str...)
+		strings = append(strings, 0)
+	}
+
+	if vm.WriteMemory(data, strings) != nil {
+		return ERRNO_FAULT
+	}
+
+	return ERRNO_SUCCESS
+}
+
+func (host *Host) argsSizesGet(vm *risbee.RisbeeVm) uint64 {
+	return sizesGet(vm, host.Args)
+}
+
+func (host *Host) argsGet(vm *risbee.RisbeeVm) uint64 {
+	return listGet(vm, host.Args)
+}
+
+func (host *Host) environSizesGet(vm *risbee.RisbeeVm) uint64 {
+	return sizesGet(vm, host.Env)
+}
+
+func (host *Host) environGet(vm *risbee.RisbeeVm) uint64 {
+	return listGet(vm, host.Env)
+}
+
+// Walks the iovec array at a1 (a2 entries of a 64-bit
+// pointer and a 64-bit length) and transfers each buffer,
+// into guest memory if toGuest is set and out of it
+// otherwise. The total number of bytes is stored at a3.
+func transferIovecs(
+	vm *risbee.RisbeeVm,
+	toGuest bool,
+	transfer func([]byte) (int, error),
+) uint64 {
+	iovs := vm.GetPointerParam(1)
+	count := vm.GetPointerParam(2)
+
+	var total uint64
+	for index := uint64(0); index < count; index++ {
+		base, ok1 := load(vm, iovs+index*16)
+		size, ok2 := load(vm, iovs+index*16+8)
+		if !ok1 || !ok2 {
+			return ERRNO_FAULT
+		}
+
+		var buf []byte
+		if toGuest && fits(vm, base, size) {
+			buf = make([]byte, size)
+		} else if data, err := vm.ReadMemory(base, size); err == nil && !toGuest {
+			buf = data
+		} else {
+			return ERRNO_FAULT
+		}
+
+		done, err := transfer(buf)
+		total += uint64(done)
+
+		if toGuest && vm.WriteMemory(base, buf[:done]) != nil {
+			return ERRNO_FAULT
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return ERRNO_IO
+		} else if done < len(buf) {
+			break
+		}
+	}
+
+	if !store(vm, vm.GetPointerParam(3), 8, total) {
+		return ERRNO_FAULT
+	}
+
+	return ERRNO_SUCCESS
+}
+
+func (host *Host) fdRead(vm *risbee.RisbeeVm) uint64 {
+	desc, ok := host.fds[vm.GetPointerParam(0)]
+	if !ok || desc.root != nil {
+		return ERRNO_BADF
+	}
+
+	if desc.file != nil {
+		return transferIovecs(vm, true, desc.file.Read)
+	}
+
+	if desc.reader == nil {
+		return ERRNO_BADF
+	}
+
+	return transferIovecs(vm, true, desc.reader.Read)
+}
+
+func (host *Host) fdWrite(vm *risbee.RisbeeVm) uint64 {
+	desc, ok := host.fds[vm.GetPointerParam(0)]
+	if !ok || !desc.writable {
+		return ERRNO_BADF
+	}
+
+	if desc.file != nil {
+		return transferIovecs(vm, false, desc.file.Write)
+	}
+
+	return transferIovecs(vm, false, desc.writer.Write)
+}
+
+func (host *Host) fdClose(vm *risbee.RisbeeVm) uint64 {
+	fd := vm.GetPointerParam(0)
+
+	desc, ok := host.fds[fd]
+	if !ok {
+		return ERRNO_BADF
+	}
+
+	if desc.file != nil {
+		desc.file.Close()
+	}
+
+	if desc.root != nil {
+		desc.root.Close()
+	}
+
+	delete(host.fds, fd)
+	return ERRNO_SUCCESS
+}
+
+func (host *Host) fdSeek(vm *risbee.RisbeeVm) uint64 {
+	desc, ok := host.fds[vm.GetPointerParam(0)]
+	if !ok || desc.file == nil {
+		return ERRNO_BADF
+	}
+
+	whence := int(vm.GetPointerParam(2))
+	if whence > io.SeekEnd {
+		return ERRNO_INVAL
+	}
+
+	offset, err := desc.file.Seek(int64(vm.GetPointerParam(1)), whence)
+	if err != nil {
+		return ERRNO_INVAL
+	}
+
+	if !store(vm, vm.GetPointerParam(3), 8, uint64(offset)) {
+		return ERRNO_FAULT
+	}
+
+	return ERRNO_SUCCESS
+}
+
+func (host *Host) fdPrestatGet(vm *risbee.RisbeeVm) uint64 {
+	desc, ok := host.fds[vm.GetPointerParam(0)]
+	if !ok || desc.preopen == nil {
+		return ERRNO_BADF
+	}
+
+	size := uint64(len(desc.preopen.GuestPath))
+	if !store(vm, vm.GetPointerParam(1), 4, size) {
+		return ERRNO_FAULT
+	}
+
+	return ERRNO_SUCCESS
+}
+
+func (host *Host) fdPrestatDirName(vm *risbee.RisbeeVm) uint64 {
+	desc, ok := host.fds[vm.GetPointerParam(0)]
+	if !ok || desc.preopen == nil {
+		return ERRNO_BADF
+	}
+
+	name := desc.preopen.GuestPath
+	if size := vm.GetPointerParam(2); size < uint64(len(name)) {
+		name = name[:size]
+	}
+
+	if vm.WriteMemory(vm.GetPointerParam(1), []byte(name)) != nil {
+		return ERRNO_FAULT
+	}
+
+	return ERRNO_SUCCESS
+}
+
+func (host *Host) pathOpen(vm *risbee.RisbeeVm) uint64 {
+	dir, ok := host.fds[vm.GetPointerParam(0)]
+	if !ok || dir.root == nil {
+		return ERRNO_BADF
+	}
+
+	name, err := vm.ReadMemory(vm.GetPointerParam(1), vm.GetPointerParam(2))
+	if err != nil {
+		return ERRNO_FAULT
+	}
+
+	oflags := vm.GetPointerParam(3)
+	fdflags := vm.GetPointerParam(4)
+	writable := fdflags&FDFLAGS_WRITE != 0 ||
+		oflags&(OFLAGS_CREAT|OFLAGS_TRUNC) != 0
+
+	if writable && dir.preopen.ReadOnly {
+		return ERRNO_NOTCAPABLE
+	}
+
+	flags := os.O_RDONLY
+	if writable {
+		flags = os.O_RDWR
+	}
+
+	if oflags&OFLAGS_CREAT != 0 {
+		flags |= os.O_CREATE
+	}
+
+	if oflags&OFLAGS_EXCL != 0 {
+		flags |= os.O_EXCL
+	}
+
+	if oflags&OFLAGS_TRUNC != 0 {
+		flags |= os.O_TRUNC
+	}
+
+	if fdflags&FDFLAGS_APPEND != 0 {
+		flags |= os.O_APPEND
+	}
+
+	file, err := dir.root.OpenFile(string(name), flags, 0o644)
+	if err != nil {
+		return errnoFromError(err)
+	}
+
+	if info, err := file.Stat(); err == nil &&
+		info.IsDir() != (oflags&OFLAGS_DIRECTORY != 0) {
+		file.Close()
+
+		if info.IsDir() {
+			return ERRNO_ISDIR
+		}
+		return ERRNO_NOENT
+	}
+
+	fd := uint64(3 + len(host.Preopens))
+	for host.fds[fd] != nil {
+		fd++
+	}
+
+	if !store(vm, vm.GetPointerParam(5), 4, fd) {
+		file.Close()
+		return ERRNO_FAULT
+	}
+
+	host.fds[fd] = &descriptor{file: file, writable: writable}
+	return ERRNO_SUCCESS
+}
+
+// Maps a host error onto a WASI error number.
+func errnoFromError(err error) uint64 {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return ERRNO_NOENT
+
+	case errors.Is(err, fs.ErrExist):
+		return ERRNO_EXIST
+
+	case errors.Is(err, fs.ErrPermission):
+		return ERRNO_ACCES
+	}
+
+	// Escapes out of the preopened root end up here.
+	return ERRNO_NOTCAPABLE
+}
+
+func (host *Host) clockTimeGet(vm *risbee.RisbeeVm) uint64 {
+	if !host.AllowClock {
+		return ERRNO_NOTCAPABLE
+	}
+
+	var nanos int64
+	switch vm.GetPointerParam(0) {
+	case CLOCK_REALTIME:
+		nanos = time.Now().UnixNano()
+
+	case CLOCK_MONOTONIC:
+		nanos = int64(time.Since(host.start))
+
+	default:
+		return ERRNO_INVAL
+	}
+
+	if !store(vm, vm.GetPointerParam(2), 8, uint64(nanos)) {
+		return ERRNO_FAULT
+	}
+
+	return ERRNO_SUCCESS
+}
+
+func (host *Host) randomGet(vm *risbee.RisbeeVm) uint64 {
+	if !host.AllowRandom {
+		return ERRNO_NOTCAPABLE
+	}
+
+	addr := vm.GetPointerParam(0)
+	size := vm.GetPointerParam(1)
+
+	if !fits(vm, addr, size) {
+		return ERRNO_FAULT
+	}
+
+	random := make([]byte, size)
+	rand.Read(random)
+
+	if vm.WriteMemory(addr, random) != nil {
+		return ERRNO_FAULT
+	}
+
+	return ERRNO_SUCCESS
+}
+
+func (host *Host) procExit(vm *risbee.RisbeeVm) uint64 {
+	exitCode := vm.GetPointerParam(0)
+	vm.ExitCode = int(int32(exitCode))
+
+	if vm.ExitCallback != nil {
+		vm.ExitCallback(exitCode)
+	}
+
+	vm.Stop()
+	return exitCode
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package wasi_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nthnn/risbee"
+	"github.com/nthnn/risbee/asm"
+	"github.com/nthnn/risbee/wasi"
+)
+
+// Runs a program assembled from source with the host
+// installed, and returns the VM once the guest exits.
+func runGuest(t *testing.T, source string, host *wasi.Host) *risbee.RisbeeVm {
+	t.Helper()
+
+	code, err := asm.Assemble(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := &risbee.RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(message string) {
+		t.Errorf("panic: %s", message)
+	})
+
+	vm.LoadFromBytes(code)
+	if err := host.Install(vm); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { host.Close() })
+
+	vm.Run()
+	return vm
+}
+
+// Compares registers against the expected values.
+func checkRegisters(t *testing.T, vm *risbee.RisbeeVm, want map[int]uint64) {
+	t.Helper()
+
+	for register, value := range want {
+		if vm.Registers[register] != value {
+			t.Errorf("x%d = %d, want %d", register, vm.Registers[register], value)
+		}
+	}
+}
+
+// Calls every syscall guarded by a capability on a host
+// that grants nothing.
+const ungrantedSource = `
+    li a0, 0            # CLOCK_REALTIME
+    li a1, 0
+    la a2, buffer
+    li a7, 0x40B        # clock_time_get
+    ecall
+    mv s1, a0
+
+    la a0, buffer
+    li a1, 8
+    li a7, 0x40C        # random_get
+    ecall
+    mv s2, a0
+
+    li a0, 1
+    la a1, iov
+    li a2, 1
+    la a3, buffer
+    li a7, 0x405        # fd_write
+    ecall
+    mv s3, a0
+
+    li a0, 0
+    la a1, iov
+    li a2, 1
+    la a3, buffer
+    li a7, 0x404        # fd_read
+    ecall
+    mv s4, a0
+
+    li a0, 42
+    li a7, 0x406        # fd_close
+    ecall
+    mv s5, a0
+
+    li a0, 42
+    li a1, 0
+    li a2, 0
+    la a3, buffer
+    li a7, 0x407        # fd_seek
+    ecall
+    mv s6, a0
+
+    li a0, 3
+    la a1, buffer
+    li a7, 0x408        # fd_prestat_get
+    ecall
+    mv s7, a0
+
+    li a0, 3
+    la a1, name
+    li a2, 4
+    li a3, 0
+    li a4, 0
+    la a5, buffer
+    li a7, 0x40A        # path_open
+    ecall
+    mv s8, a0
+
+    li a0, 0
+    li a7, 0x40D        # proc_exit
+    ecall
+
+name:
+    .ascii "file"
+    .align 3
+iov:
+    .dword buffer, 8
+buffer:
+    .dword 0
+`
+
+func TestUngranted(t *testing.T) {
+	vm := runGuest(t, ungrantedSource, &wasi.Host{})
+
+	checkRegisters(t, vm, map[int]uint64{
+		9:  wasi.ERRNO_NOTCAPABLE,
+		18: wasi.ERRNO_NOTCAPABLE,
+		19: wasi.ERRNO_BADF,
+		20: wasi.ERRNO_BADF,
+		21: wasi.ERRNO_BADF,
+		22: wasi.ERRNO_BADF,
+		23: wasi.ERRNO_BADF,
+		24: wasi.ERRNO_BADF,
+	})
+}
+
+func TestGrantedClockAndRandom(t *testing.T) {
+	var stdout bytes.Buffer
+	vm := runGuest(t, ungrantedSource, &wasi.Host{
+		Stdout:      &stdout,
+		AllowClock:  true,
+		AllowRandom: true,
+	})
+
+	checkRegisters(t, vm, map[int]uint64{
+		9:  wasi.ERRNO_SUCCESS,
+		18: wasi.ERRNO_SUCCESS,
+		19: wasi.ERRNO_SUCCESS,
+		20: wasi.ERRNO_BADF,
+	})
+
+	if stdout.Len() != 8 {
+		t.Errorf("fd_write wrote %d bytes, want 8", stdout.Len())
+	}
+}
+
+// Opens the path at name from descriptor 3 with the given
+// flags, and leaves the error number in s1 and the new
+// descriptor in s2.
+const pathOpenSource = `
+    li a0, 3
+    la a1, name
+    li a2, %d
+    li a3, %d
+    li a4, %d
+    la a5, fd
+    li a7, 0x40A        # path_open
+    ecall
+    mv s1, a0
+    la t0, fd
+    lw s2, 0(t0)
+
+    li a0, 0
+    li a7, 0x40D        # proc_exit
+    ecall
+
+name:
+    .ascii "%s"
+    .align 2
+fd:
+    .word 0
+`
+
+// Runs path_open of name on a preopen of dir.
+func pathOpen(
+	t *testing.T,
+	dir string,
+	readOnly bool,
+	name string,
+	oflags uint64,
+	fdflags uint64,
+) *risbee.RisbeeVm {
+	t.Helper()
+
+	return runGuest(t, fmt.Sprintf(pathOpenSource, len(name), oflags, fdflags, name), &wasi.Host{
+		Preopens: []wasi.Preopen{{
+			GuestPath: "/data",
+			HostPath:  dir,
+			ReadOnly:  readOnly,
+		}},
+	})
+}
+
+func TestPathOpenReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		oflags  uint64
+		fdflags uint64
+		want    uint64
+	}{
+		{"file", 0, 0, wasi.ERRNO_SUCCESS},
+		{"file", 0, wasi.FDFLAGS_WRITE, wasi.ERRNO_NOTCAPABLE},
+		{"file", wasi.OFLAGS_TRUNC, 0, wasi.ERRNO_NOTCAPABLE},
+		{"new", wasi.OFLAGS_CREAT, 0, wasi.ERRNO_NOTCAPABLE},
+	}
+
+	for _, test := range cases {
+		vm := pathOpen(t, dir, true, test.name, test.oflags, test.fdflags)
+		if errno := vm.Registers[9]; errno != test.want {
+			t.Errorf("%s with oflags %d, fdflags %d: errno %d, want %d",
+				test.name, test.oflags, test.fdflags, errno, test.want)
+		}
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "file")); string(data) != "data" {
+		t.Errorf("file changed to %q", data)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "new")); err == nil {
+		t.Error("file created in a read-only preopen")
+	}
+
+	vm := pathOpen(t, dir, false, "file", 0, wasi.FDFLAGS_WRITE)
+	if vm.Registers[9] != wasi.ERRNO_SUCCESS || vm.Registers[18] != 4 {
+		t.Errorf("writable open: errno %d, fd %d", vm.Registers[9], vm.Registers[18])
+	}
+}
+
+func TestPathOpenEscape(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "root")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := filepath.Join(parent, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(secret, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{
+		"../secret",
+		secret,
+		"link",
+	} {
+		vm := pathOpen(t, dir, false, name, 0, 0)
+		if errno := vm.Registers[9]; errno != wasi.ERRNO_NOTCAPABLE {
+			t.Errorf("%s: errno %d, want NOTCAPABLE", name, errno)
+		}
+	}
+}
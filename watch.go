@@ -0,0 +1,117 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+// Kinds of accesses a watchpoint reacts to.
+const (
+	RISBEE_WATCH_READ   = 1 << 0 // Guest loads
+	RISBEE_WATCH_WRITE  = 1 << 1 // Guest stores
+	RISBEE_WATCH_ACCESS = RISBEE_WATCH_READ | RISBEE_WATCH_WRITE
+)
+
+// RisbeeWatchEvent describes a guest access that touched a
+// watched range. For loads, OldValue and NewValue are both
+// the value read; for stores to devices, OldValue is zero.
+type RisbeeWatchEvent struct {
+	Id       int    // Watchpoint that fired
+	Pc       uint64 // Address of the accessing instruction
+	Address  uint64 // First byte accessed
+	Size     uint64 // Access size in bytes
+	Write    bool   // Whether the access was a store
+	OldValue uint64 // Value before the access
+	NewValue uint64 // Value after the access
+}
+
+// RisbeeWatchCallback is called after a watched access
+// has completed. It may stop the VM.
+type RisbeeWatchCallback func(vm *RisbeeVm, Event RisbeeWatchEvent)
+
+// RisbeeWatchpoint watches a range of guest addresses.
+type RisbeeWatchpoint struct {
+	Id       int                 // Identifier returned by AddWatchpoint
+	Start    uint64              // First watched address
+	Size     uint64              // Size of the range in bytes
+	Kind     uint64              // Watched accesses (RISBEE_WATCH_*)
+	Callback RisbeeWatchCallback // Called for each watched access
+}
+
+// AddWatchpoint calls Callback whenever a guest load or
+// store of the given Kind overlaps [Start, Start+Size).
+// Host accessors such as ReadMemory do not trigger it.
+//
+// Returns an identifier for RemoveWatchpoint.
+func (vm *RisbeeVm) AddWatchpoint(
+	Start uint64,
+	Size uint64,
+	Kind uint64,
+	Callback RisbeeWatchCallback,
+) int {
+	id := 1
+	for _, watchpoint := range vm.Watchpoints {
+		id = max(id, watchpoint.Id+1)
+	}
+
+	vm.Watchpoints = append(vm.Watchpoints, RisbeeWatchpoint{
+		Id:       id,
+		Start:    Start,
+		Size:     Size,
+		Kind:     Kind,
+		Callback: Callback,
+	})
+
+	return id
+}
+
+// RemoveWatchpoint deletes the watchpoint with the given
+// identifier.
+//
+// Returns false if there is no such watchpoint.
+func (vm *RisbeeVm) RemoveWatchpoint(Id int) bool {
+	for index, watchpoint := range vm.Watchpoints {
+		if watchpoint.Id == Id {
+			vm.Watchpoints = append(vm.Watchpoints[:index], vm.Watchpoints[index+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Calls the callbacks of all watchpoints overlapping a
+// completed guest access.
+func (vm *RisbeeVm) fireWatchpoints(
+	addr uint64,
+	size uint64,
+	write bool,
+	old uint64,
+	new uint64,
+) {
+	kind := uint64(RISBEE_WATCH_READ)
+	if write {
+		kind = RISBEE_WATCH_WRITE
+	}
+
+	// Callbacks may add or remove watchpoints.
+	watchpoints := append([]RisbeeWatchpoint(nil), vm.Watchpoints...)
+	for _, watchpoint := range watchpoints {
+		if watchpoint.Kind&kind == 0 ||
+			addr >= watchpoint.Start+watchpoint.Size ||
+			watchpoint.Start >= addr+size {
+			continue
+		}
+
+		watchpoint.Callback(vm, RisbeeWatchEvent{
+			Id:       watchpoint.Id,
+			Pc:       vm.Pc,
+			Address:  addr,
+			Size:     size,
+			Write:    write,
+			OldValue: old,
+			NewValue: new,
+		})
+	}
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2025 Nathanne Isip
+ * This file is part of Risbee (https://github.com/nthnn/risbee)
+ * This code is licensed under MIT license (see LICENSE for details)
+ */
+
+package risbee
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWatchpoints(t *testing.T) {
+	vm := &RisbeeVm{}
+	vm.Initialize(func(uint64) {}, func(string) {})
+	vm.Memory = make([]byte, 0x3000)
+	putUint64(vm.Memory[0x2000:], 0x1122334455667788)
+	vm.ProtectMemory(0x2800, 0x800, RISBEE_MEM_READ)
+
+	var events []RisbeeWatchEvent
+	record := func(vm *RisbeeVm, Event RisbeeWatchEvent) {
+		events = append(events, Event)
+	}
+
+	write := vm.AddWatchpoint(0x2004, 4, RISBEE_WATCH_WRITE, record)
+	read := vm.AddWatchpoint(0x2000, 2, RISBEE_WATCH_READ, record)
+	vm.AddWatchpoint(0x2800, 8, RISBEE_WATCH_WRITE, record)
+
+	vm.Pc = 0x1000
+	vm.store(0x2006, 2, 0xABCDEF)
+	vm.load(0x2000, 8)
+	vm.load(0x2004, 4)
+	vm.store(0x2800, 8, 1)
+
+	want := []RisbeeWatchEvent{
+		{Id: write, Pc: 0x1000, Address: 0x2006, Size: 2, Write: true, OldValue: 0x1122, NewValue: 0xCDEF},
+		{Id: read, Pc: 0x1000, Address: 0x2000, Size: 8, OldValue: 0xCDEF334455667788, NewValue: 0xCDEF334455667788},
+	}
+
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("events %+v", events)
+	}
+
+	if !vm.RemoveWatchpoint(write) || vm.RemoveWatchpoint(write) {
+		t.Fatal("RemoveWatchpoint")
+	}
+
+	events = nil
+	vm.store(0x2004, 4, 0)
+	if len(events) != 0 {
+		t.Fatalf("removed watchpoint fired: %+v", events)
+	}
+}